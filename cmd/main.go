@@ -3,13 +3,19 @@ package main
 import (
 	"service/internal/config"
 	"service/internal/service"
-	"service/internal/service/handlers"
-	"service/internal/service/middlewares"
+	"service/internal/service/events"
+	"service/internal/service/uploads"
+	"service/internal/storage/blob"
+	"service/internal/storage/memory"
 	"service/internal/storage/postgres"
+	"service/internal/storage/replicas"
 
+	"context"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -17,6 +23,64 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
+const (
+	kBlobDriverS3 = "s3"
+)
+
+func newNode(cnf *config.ConfigPostgres) (replicas.Node, error) {
+	if cnf.Driver == postgres.KDriverPgx {
+		return postgres.NewPgx(cnf)
+	}
+
+	return postgres.New(cnf)
+}
+
+// newStorage подключает основную базу и реплики из cnf.Replicas; без реплик возвращает основную базу как есть.
+// driver memory - хранилище в памяти процесса для локального запуска без базы
+func newStorage(driver string, cnf *config.ConfigPostgres, log *slog.Logger) (replicas.Node, error) {
+	if driver == memory.KDriverMemory {
+		return memory.New(), nil
+	}
+
+	primary, err := newNode(cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cnf.Replicas) == 0 {
+		return primary, nil
+	}
+
+	replicaNodes := make([]replicas.Node, 0, len(cnf.Replicas))
+	for i, dsn := range cnf.Replicas {
+		replicaCnf := *cnf
+		replicaCnf.Dsn = dsn
+		replicaCnf.Replicas = nil
+
+		// недоступная при старте реплика не мешает запуску, но и запросов не получит до перезапуска
+		node, err := newNode(&replicaCnf)
+		if err != nil {
+			log.Error("Replica is not available, it gets no reads until restart", slog.Int("replica", i), slog.Any("error", err))
+			continue
+		}
+
+		replicaNodes = append(replicaNodes, node)
+	}
+
+	router := replicas.NewRouter(primary, replicaNodes, cnf.ReadYourWrites, cnf.ReplicaHealthInterval)
+	go router.Run(context.Background())
+
+	return router, nil
+}
+
+func newBlobStore(cnf *config.ConfigBlob) (service.BlobStore, error) {
+	if cnf.Driver == kBlobDriverS3 {
+		return blob.NewS3(&cnf.S3)
+	}
+
+	return blob.NewLocal(&cnf.Local)
+}
+
 type Response struct{
 	User string `json:"name"`
 	Message string `json:"message"`
@@ -26,54 +90,102 @@ type Request struct{
 	User string `json:"user"`
 }
 
-//NOTE: CONFIG_PATH=./config/local_config.yaml go run ./cmd/main.go
+// reapUploads - запуск сборщика файлов из командной строки вместо сервера
+func reapUploads(application *service.Application, dryRun bool) {
+	reaped, err := uploads.NewReaper(application).Reap(context.Background(), dryRun)
+
+	for _, upload := range reaped {
+		toyId := "-"
+		if upload.ToyId != nil {
+			toyId = *upload.ToyId
+		}
+
+		fmt.Printf("%s\ttoy=%s\treleased_at=%s\n", upload.Key, toyId, upload.ReleasedAt.Format(time.RFC3339))
+	}
+
+	if dryRun {
+		fmt.Printf("%d files would be deleted\n", len(reaped))
+	} else {
+		fmt.Printf("%d files deleted\n", len(reaped))
+	}
+
+	if err != nil {
+		application.Log.Error("Uploads reaper failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+//NOTE: CONFIG_PATH=./config/local_config.yaml BLOB_SIGN_SECRET=$(openssl rand -hex 32) CURSOR_SECRET=$(openssl rand -hex 32) go run ./cmd
+//NOTE: CONFIG_PATH=./config/local_config.yaml BLOB_SIGN_SECRET=$(openssl rand -hex 32) go run ./cmd -reap-uploads -dry-run
+//NOTE: CONFIG_PATH=./config/local_config.yaml BLOB_SIGN_SECRET=$(openssl rand -hex 32) CURSOR_SECRET=$(openssl rand -hex 32) go run ./cmd -storage=memory
+//NOTE: CONFIG_PATH=./config/local_config.yaml go run ./cmd migrate up|down [N]|status|redo
 func main() {
-    app := fiber.New()
+	reap := flag.Bool("reap-uploads", false, "delete unreferenced upload files and exit")
+	dryRun := flag.Bool("dry-run", false, "with -reap-uploads: only list files that would be deleted")
+	storageDriver := flag.String("storage", "postgres", "postgres | memory: keep all data in process memory, no database needed")
+	flag.Parse()
 
 	cnf := config.New();
-	storage, err := postgres.New(&cnf.Postgres)
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cnf, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// запас сверх размера файла на остальные поля multipart формы
+	app := fiber.New(fiber.Config{
+		BodyLimit: int(cnf.Server.MaxUploadSize) + 1<<20,
+	})
+	log := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	storage, err := newStorage(*storageDriver, &cnf.Postgres, log)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer storage.Close()
+
+	blobs, err := newBlobStore(&cnf.Blob)
 	if err != nil {
 		panic(err.Error())
 	}
 
 	application := &service.Application{
 		Cnf: cnf,
-		Log: slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		Log: log,
 		Storage: storage,
+		Blobs: blobs,
 		Validator: validator.New(),
+		Events: events.NewHub(),
+	}
+
+	if *reap {
+		reapUploads(application, *dryRun)
+		return
 	}
 
+	// с пустым секретом курсоры пагинации может подделать кто угодно
+	if cnf.Server.CursorSecret == "" {
+		fmt.Fprintln(os.Stderr, "server.cursor_secret is not set, set CURSOR_SECRET")
+		os.Exit(1)
+	}
+
+	go uploads.NewReaper(application).Run(context.Background())
+
+	go func() {
+		if err := storage.ListenEvents(context.Background(), application.Events.Publish); err != nil {
+			application.Log.Error("Events listener stopped", slog.Any("error", err))
+		}
+	}()
+
 	app.Use(logger.New(logger.Config{
 		Format: "${blue}[${time}]${reset} ${cyan}${ip}:${port}${reset} ${method} ${green}${path}${reset} ${status} ${magenta}${latency}${reset} ${white}${reqHeader:User-Agent}${reset}\n",
 	}))
 	app.Use(recover.New())
 
-	app.Static("/upload", cnf.Server.Prefix_upload)
-
-	toysV1Group := app.Group("/v1/toys");
-	toysV1Group.Use(middlewares.AuthMiddleware(application))
-	{
-		toysV1Group.Post("/", handlers.CreateToy(application))
-		toysV1Group.Post("/change", handlers.UpdateToy(application)) // по сути PUT
-		toysV1Group.Post("/list", handlers.GetToysList(application))
-		toysV1Group.Patch("/:toy_id", handlers.UpdateToyStatus(application))
-		toysV1Group.Delete("/:toy_id", handlers.DeleteToy(application))
-		toysV1Group.Get("/:toy_id", handlers.GetToy(application))
-	}
-
-	exchangeV1Group := app.Group("/v1/exchange")
-	exchangeV1Group.Use(middlewares.AuthMiddleware(application))
-	{
-		exchangeV1Group.Post("/", handlers.CreateExchange(application))
-		exchangeV1Group.Get("/:exchange_id", handlers.GetExchange(application))
-		exchangeV1Group.Patch("/:exchange_id", handlers.PatchExchange(application))
-		exchangeV1Group.Post("/list", handlers.GetExchangeList(application))
-	}
-
-	{
-		app.Post("/v1/register", handlers.Register((application)))
-		app.Post("v1/login", handlers.Login(application))
-	}
+	routes(app, application)
 
     app.Listen(fmt.Sprintf("%s:%d", cnf.Server.Host, cnf.Server.Port))
 
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"service/internal/config"
+	"service/internal/storage/postgres"
+	"service/migrations"
+
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	kMigrateUsage = "usage: migrate up | down [N] | status | redo | baseline"
+)
+
+// runMigrate выполняет подкоманду migrate: up - применить все новые миграции,
+// down [N] - откатить N последних (по умолчанию одну), status - список миграций, redo - откатить и применить последнюю,
+// baseline - отметить первую миграцию примененной в базе, созданной из create_entity.sql
+func runMigrate(cnf *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(kMigrateUsage)
+	}
+
+	migrator, err := postgres.NewMigrator(&cnf.Postgres, migrations.FS)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, migration := range done {
+			fmt.Printf("up   %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		if err == nil && len(done) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations: %s", args[1])
+			}
+		}
+
+		done, err := migrator.Down(ctx, steps)
+		for _, migration := range done {
+			fmt.Printf("down %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err
+	case "redo":
+		migration, err := migrator.Redo(ctx)
+		if migration != nil {
+			fmt.Printf("redo %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err
+	case "baseline":
+		migration, err := migrator.Baseline(ctx)
+		if migration != nil {
+			fmt.Printf("baseline %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+
+			if status.Missing {
+				state += " (no scripts in this build)"
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+
+		return nil
+	}
+
+	return errors.New(kMigrateUsage)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"service/internal/service"
+	"service/internal/service/handlers"
+	"service/internal/service/middlewares"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// routes - таблица маршрутов сервиса, общая для main и тестов обработчиков
+func routes(app *fiber.App, application *service.Application) {
+	app.Use(middlewares.RequestContext())
+
+	// файлы из S3 скачиваются по ссылкам S3, сервис отдает только файлы с диска
+	if application.Cnf.Blob.Driver != kBlobDriverS3 {
+		app.Get("/v1/files/*", handlers.GetFile(application))
+	}
+
+	toysV1Group := app.Group("/v1/toys");
+	toysV1Group.Use(middlewares.AuthMiddleware(application))
+	{
+		toysV1Group.Post("/", handlers.CreateToy(application))
+		toysV1Group.Post("/change", handlers.UpdateToy(application)) // по сути PUT
+		toysV1Group.Post("/list", handlers.GetToysList(application))
+		toysV1Group.Patch("/:toy_id", handlers.UpdateToyStatus(application))
+		toysV1Group.Delete("/:toy_id", handlers.DeleteToy(application))
+		toysV1Group.Get("/:toy_id", handlers.GetToy(application))
+		toysV1Group.Get("/:toy_id/history", handlers.GetToyHistory(application))
+		toysV1Group.Post("/:toy_id/photos", handlers.AddToyPhoto(application))
+		toysV1Group.Put("/:toy_id/photos", handlers.ReorderToyPhotos(application))
+		toysV1Group.Delete("/:toy_id/photos/:photo_id", handlers.DeleteToyPhoto(application))
+	}
+
+	exchangeV1Group := app.Group("/v1/exchange")
+	exchangeV1Group.Use(middlewares.AuthMiddleware(application))
+	{
+		exchangeV1Group.Post("/", handlers.CreateExchange(application))
+		exchangeV1Group.Get("/:exchange_id", handlers.GetExchange(application))
+		exchangeV1Group.Patch("/:exchange_id", handlers.PatchExchange(application))
+		exchangeV1Group.Post("/list", handlers.GetExchangeList(application))
+		exchangeV1Group.Post("/:exchange_id/messages", handlers.CreateExchangeMessage(application))
+		exchangeV1Group.Get("/:exchange_id/messages", handlers.GetExchangeMessages(application))
+		exchangeV1Group.Post("/:exchange_id/reviews", handlers.CreateReview(application))
+	}
+
+	usersV1Group := app.Group("/v1/users")
+	usersV1Group.Use(middlewares.AuthMiddleware(application))
+	{
+		usersV1Group.Post("/location", handlers.UpdateUserLocation(application))
+		usersV1Group.Get("/:user_id", handlers.GetUser(application))
+		usersV1Group.Get("/:user_id/reviews", handlers.GetUserReviews(application))
+		usersV1Group.Post("/:user_id/report", handlers.ReportUser(application))
+		usersV1Group.Post("/:user_id/block", handlers.BlockUser(application))
+		usersV1Group.Delete("/:user_id/block", handlers.UnblockUser(application))
+	}
+
+	metricsV1Group := app.Group("/v1/metrics")
+	metricsV1Group.Use(middlewares.AuthMiddleware(application))
+	{
+		metricsV1Group.Get("/db", handlers.GetPoolStats(application))
+	}
+
+	eventsV1Group := app.Group("/v1/events")
+	eventsV1Group.Use(middlewares.AuthMiddleware(application))
+	{
+		eventsV1Group.Get("/", handlers.StreamEvents(application))
+	}
+
+	{
+		app.Get("/v1/categories", handlers.GetCategories(application))
+		app.Post("/v1/register", handlers.Register((application)))
+		app.Post("v1/login", handlers.Login(application))
+	}
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+	"service/internal/service"
+	"service/internal/service/events"
+	"service/internal/storage/blob"
+	"service/internal/storage/memory"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+const (
+	kHeaderUserId = "x_user_id"
+	kHeaderToken  = "x_idempotency_token"
+	kHeaderToyId  = "toy_id"
+)
+
+// brokenStorage - хранилище, у которого отказывают чтения игрушек и категорий
+type brokenStorage struct {
+	service.Storage
+}
+
+var errBroken = errors.New("storage is down")
+
+func (b *brokenStorage) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	return nil, errBroken
+}
+
+func (b *brokenStorage) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	return nil, errBroken
+}
+
+// contextStorage запоминает контекст, с которым обработчик читал категории
+type contextStorage struct {
+	service.Storage
+	ctx context.Context
+}
+
+func (c *contextStorage) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	c.ctx = ctx
+	return c.Storage.SelectCategories(ctx)
+}
+
+// testServer - приложение с маршрутами из routes поверх storage
+type testServer struct {
+	t       *testing.T
+	app     *fiber.App
+	storage service.Storage
+}
+
+func newTestServer(t *testing.T, storage service.Storage) *testServer {
+	t.Helper()
+
+	cnf := &config.Config{
+		Server: config.ConfigServer{MaxUploadSize: 1 << 20, CursorSecret: "cursor-secret"},
+		Blob: config.ConfigBlob{
+			Local: config.ConfigBlobLocal{Dir: t.TempDir(), PublicUrl: "http://localhost/v1/files", SignSecret: "sign-secret"},
+		},
+	}
+
+	blobs, err := blob.NewLocal(&cnf.Blob.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	application := &service.Application{
+		Cnf:       cnf,
+		Storage:   storage,
+		Blobs:     blobs,
+		Log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Validator: validator.New(),
+		Events:    events.NewHub(),
+	}
+
+	app := fiber.New()
+	app.Use(recover.New())
+	routes(app, application)
+
+	return &testServer{t: t, app: app, storage: storage}
+}
+
+// request - запрос к маршруту. body - JSON, form - поля multipart формы, file - содержимое поля file
+type request struct {
+	method  string
+	path    string
+	userId  string
+	token   string
+	headers map[string]string
+	body    string
+	form    map[string]string
+	file    []byte
+}
+
+func (s *testServer) do(req request) (int, []byte) {
+	s.t.Helper()
+
+	var body io.Reader
+	contentType := ""
+
+	switch {
+	case req.form != nil || req.file != nil:
+		buffer := &bytes.Buffer{}
+		writer := multipart.NewWriter(buffer)
+		for key, value := range req.form {
+			writer.WriteField(key, value)
+		}
+
+		if req.file != nil {
+			part, err := writer.CreateFormFile("file", "photo.png")
+			if err != nil {
+				s.t.Fatal(err)
+			}
+			part.Write(req.file)
+		}
+
+		writer.Close()
+		body = buffer
+		contentType = writer.FormDataContentType()
+	case req.body != "":
+		body = strings.NewReader(req.body)
+		contentType = fiber.MIMEApplicationJSON
+	}
+
+	httpReq := httptest.NewRequest(req.method, req.path, body)
+	if contentType != "" {
+		httpReq.Header.Set(fiber.HeaderContentType, contentType)
+	}
+
+	if req.userId != "" {
+		httpReq.Header.Set(kHeaderUserId, req.userId)
+	}
+
+	if req.token != "" {
+		httpReq.Header.Set(kHeaderToken, req.token)
+	}
+
+	for key, value := range req.headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := s.app.Test(httpReq, -1)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", req.method, req.path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return resp.StatusCode, data
+}
+
+func (s *testServer) user(email string) *models.User {
+	s.t.Helper()
+
+	user, err := s.storage.CreateUser(context.Background(), &models.User{
+		UserName:     models.UserName{FirstName: "Иван", LastName: "Иванов"},
+		HashPassword: "hash",
+		Email:        email,
+	})
+	if err != nil || user == nil {
+		s.t.Fatalf("CreateUser: %v, %v", user, err)
+	}
+
+	return user
+}
+
+func (s *testServer) toy(userId string, name string) *models.Toy {
+	s.t.Helper()
+
+	toy, err := s.storage.InsertToy(context.Background(), &models.Toy{
+		UserId:           userId,
+		Name:             name,
+		IdempotencyToken: userId + name,
+		Status:           models.KCreatedToyStatus,
+	})
+	if err != nil || toy == nil {
+		s.t.Fatalf("InsertToy: %v, %v", toy, err)
+	}
+
+	return toy
+}
+
+func (s *testServer) exchange(src *models.Toy, dst *models.Toy) *models.Exchange {
+	s.t.Helper()
+
+	exchange, err := s.storage.InsertExchange(context.Background(), &models.Exchange{
+		SrcToyId:         src.ToyId,
+		DstToyId:         dst.ToyId,
+		IdempotencyToken: src.ToyId + dst.ToyId,
+	}, []models.ExchangeDetails{
+		{ToyId: src.ToyId, UserId: src.UserId},
+		{ToyId: dst.ToyId, UserId: dst.UserId},
+	})
+	if err != nil || exchange == nil {
+		s.t.Fatalf("InsertExchange: %v, %v", exchange, err)
+	}
+
+	return exchange
+}
+
+// testCase - запрос и ожидаемый код ответа
+type testCase struct {
+	name string
+	req  request
+	want int
+}
+
+func (s *testServer) run(cases []testCase) {
+	s.t.Helper()
+
+	for _, tc := range cases {
+		s.t.Run(tc.name, func(t *testing.T) {
+			status, body := s.do(tc.req)
+			if status != tc.want {
+				t.Errorf("%s %s = %d, want %d: %s", tc.req.method, tc.req.path, status, tc.want, body)
+			}
+		})
+	}
+}
+
+func decode[T any](t *testing.T, body []byte) T {
+	t.Helper()
+
+	var value T
+	if err := json.Unmarshal(body, &value); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+
+	return value
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for x := 0; x < 32; x++ {
+		img.Set(x, x, color.RGBA{R: 255, A: 255})
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := png.Encode(buffer, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s := newTestServer(t, memory.New())
+
+	routes := []request{
+		{method: http.MethodPost, path: "/v1/toys/"},
+		{method: http.MethodPost, path: "/v1/toys/change"},
+		{method: http.MethodPost, path: "/v1/toys/list"},
+		{method: http.MethodPatch, path: "/v1/toys/toy_1"},
+		{method: http.MethodDelete, path: "/v1/toys/toy_1"},
+		{method: http.MethodGet, path: "/v1/toys/toy_1"},
+		{method: http.MethodGet, path: "/v1/toys/toy_1/history"},
+		{method: http.MethodPost, path: "/v1/toys/toy_1/photos"},
+		{method: http.MethodPut, path: "/v1/toys/toy_1/photos"},
+		{method: http.MethodDelete, path: "/v1/toys/toy_1/photos/photo_1"},
+		{method: http.MethodPost, path: "/v1/exchange/"},
+		{method: http.MethodGet, path: "/v1/exchange/exchange_1"},
+		{method: http.MethodPatch, path: "/v1/exchange/exchange_1"},
+		{method: http.MethodPost, path: "/v1/exchange/list"},
+		{method: http.MethodPost, path: "/v1/exchange/exchange_1/messages"},
+		{method: http.MethodGet, path: "/v1/exchange/exchange_1/messages"},
+		{method: http.MethodPost, path: "/v1/exchange/exchange_1/reviews"},
+		{method: http.MethodPost, path: "/v1/users/location"},
+		{method: http.MethodGet, path: "/v1/users/user_1"},
+		{method: http.MethodGet, path: "/v1/users/user_1/reviews"},
+		{method: http.MethodPost, path: "/v1/users/user_1/report"},
+		{method: http.MethodPost, path: "/v1/users/user_1/block"},
+		{method: http.MethodDelete, path: "/v1/users/user_1/block"},
+		{method: http.MethodGet, path: "/v1/events/"},
+		{method: http.MethodGet, path: "/v1/metrics/db"},
+	}
+
+	var cases []testCase
+	for _, route := range routes {
+		anonymous := route
+		cases = append(cases, testCase{name: route.method + " " + route.path + " without user", req: anonymous, want: fiber.StatusUnauthorized})
+
+		unknown := route
+		unknown.userId = "unknown_user"
+		cases = append(cases, testCase{name: route.method + " " + route.path + " unknown user", req: unknown, want: fiber.StatusUnauthorized})
+	}
+
+	alice := s.user("alice@example.com")
+	cases = append(cases, testCase{"db metrics", request{method: http.MethodGet, path: "/v1/metrics/db", userId: alice.UserId}, fiber.StatusOK})
+
+	s.run(cases)
+}
+
+func TestPublicRoutes(t *testing.T) {
+	s := newTestServer(t, memory.New())
+
+	s.run([]testCase{
+		{"categories", request{method: http.MethodGet, path: "/v1/categories"}, fiber.StatusOK},
+		{"file without signature", request{method: http.MethodGet, path: "/v1/files/toys/photo.jpg"}, fiber.StatusForbidden},
+		{"file with bad signature", request{method: http.MethodGet, path: "/v1/files/toys/photo.jpg?expires=9999999999&signature=bad"}, fiber.StatusForbidden},
+	})
+}
+
+// TestFilesRouteS3 - с драйвером s3 файлы не отдаются через /v1/files
+func TestFilesRouteS3(t *testing.T) {
+	app := fiber.New()
+	routes(app, &service.Application{
+		Cnf:     &config.Config{Blob: config.ConfigBlob{Driver: kBlobDriverS3}},
+		Storage: memory.New(),
+		Log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	s := &testServer{t: t, app: app}
+	s.run([]testCase{
+		{"file", request{method: http.MethodGet, path: "/v1/files/toys/photo.jpg"}, fiber.StatusNotFound},
+	})
+}
+
+func TestStorageErrors(t *testing.T) {
+	storage := memory.New()
+	s := newTestServer(t, &brokenStorage{Storage: storage})
+	alice := s.user("alice@example.com")
+
+	s.run([]testCase{
+		{"categories", request{method: http.MethodGet, path: "/v1/categories"}, fiber.StatusInternalServerError},
+		{"get toy", request{method: http.MethodGet, path: "/v1/toys/toy_1", userId: alice.UserId}, fiber.StatusInternalServerError},
+		{"toy history", request{method: http.MethodGet, path: "/v1/toys/toy_1/history", userId: alice.UserId}, fiber.StatusInternalServerError},
+	})
+}
+
+func TestRequestContext(t *testing.T) {
+	storage := &contextStorage{Storage: memory.New()}
+	s := newTestServer(t, storage)
+
+	s.run([]testCase{{"categories", request{method: http.MethodGet, path: "/v1/categories"}, fiber.StatusOK}})
+
+	if storage.ctx == nil || !errors.Is(storage.ctx.Err(), context.Canceled) {
+		t.Errorf("storage context after the request = %v, want canceled", storage.ctx)
+	}
+}
+
+func TestRegisterLogin(t *testing.T) {
+	s := newTestServer(t, memory.New())
+
+	register := `{"user_name":{"first_name":"Иван","last_name":"Иванов"},"email":"ivan@example.com","password":"secret","confirm_password":"secret"}`
+
+	s.run([]testCase{
+		{"register", request{method: http.MethodPost, path: "/v1/register", body: register}, fiber.StatusCreated},
+		{"register taken email", request{method: http.MethodPost, path: "/v1/register", body: register}, fiber.StatusConflict},
+		{"register passwords differ", request{method: http.MethodPost, path: "/v1/register",
+			body: `{"user_name":{"first_name":"Иван","last_name":"Иванов"},"email":"other@example.com","password":"secret","confirm_password":"other"}`}, fiber.StatusBadRequest},
+		{"register bad email", request{method: http.MethodPost, path: "/v1/register",
+			body: `{"user_name":{"first_name":"Иван","last_name":"Иванов"},"email":"ivan","password":"secret","confirm_password":"secret"}`}, fiber.StatusBadRequest},
+		{"register without name", request{method: http.MethodPost, path: "/v1/register",
+			body: `{"email":"noname@example.com","password":"secret","confirm_password":"secret"}`}, fiber.StatusBadRequest},
+		{"login", request{method: http.MethodPost, path: "/v1/login", body: `{"email":"ivan@example.com","password":"secret"}`}, fiber.StatusOK},
+		{"login wrong password", request{method: http.MethodPost, path: "/v1/login", body: `{"email":"ivan@example.com","password":"wrong"}`}, fiber.StatusNotFound},
+		{"login unknown email", request{method: http.MethodPost, path: "/v1/login", body: `{"email":"nobody@example.com","password":"secret"}`}, fiber.StatusNotFound},
+		{"login without password", request{method: http.MethodPost, path: "/v1/login", body: `{"email":"ivan@example.com"}`}, fiber.StatusBadRequest},
+		{"login bad json", request{method: http.MethodPost, path: "/v1/login", body: `{`}, fiber.StatusBadRequest},
+	})
+}
+
+func TestToys(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+	toy := s.toy(alice.UserId, "Мяч")
+
+	s.run([]testCase{
+		{"create", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_1",
+			form: map[string]string{"name": "Юла", "tags": "дерево, Дерево", "age_min": "3", "age_max": "6", "condition": "new"}}, fiber.StatusCreated},
+		{"create without name", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_2",
+			form: map[string]string{"description": "без имени"}}, fiber.StatusBadRequest},
+		{"create without token", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId,
+			form: map[string]string{"name": "Юла"}}, fiber.StatusBadRequest},
+		{"create age is not a number", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_3",
+			form: map[string]string{"name": "Юла", "age_min": "три"}}, fiber.StatusBadRequest},
+		{"create age_min over age_max", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_4",
+			form: map[string]string{"name": "Юла", "age_min": "6", "age_max": "3"}}, fiber.StatusBadRequest},
+		{"create lat without lon", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_5",
+			form: map[string]string{"name": "Юла", "lat": "55.7"}}, fiber.StatusBadRequest},
+		{"create unknown condition", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_6",
+			form: map[string]string{"name": "Юла", "condition": "broken"}}, fiber.StatusBadRequest},
+		{"create with broken photo", request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "create_7",
+			form: map[string]string{"name": "Юла"}, file: []byte("not an image")}, fiber.StatusBadRequest},
+
+		{"get", request{method: http.MethodGet, path: "/v1/toys/" + toy.ToyId, userId: bob.UserId}, fiber.StatusOK},
+		{"get unknown", request{method: http.MethodGet, path: "/v1/toys/unknown", userId: bob.UserId}, fiber.StatusNotFound},
+		{"history", request{method: http.MethodGet, path: "/v1/toys/" + toy.ToyId + "/history", userId: bob.UserId}, fiber.StatusOK},
+		{"history unknown", request{method: http.MethodGet, path: "/v1/toys/unknown/history", userId: bob.UserId}, fiber.StatusNotFound},
+
+		{"update", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мячик"}}, fiber.StatusOK},
+		{"update foreign toy", request{method: http.MethodPost, path: "/v1/toys/change", userId: bob.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мячик"}}, fiber.StatusNotFound},
+		{"update without toy_id", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			form: map[string]string{"name": "Мячик"}}, fiber.StatusBadRequest},
+		{"update age_min over age_max", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мячик", "age_min": "6", "age_max": "3"}}, fiber.StatusBadRequest},
+		{"update age range", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мячик", "age_min": "1", "age_max": "3"}}, fiber.StatusOK},
+		// PUT заменяет игрушку целиком: прежний age_max очищается и не конфликтует с новым age_min
+		{"update age_min only", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мячик", "age_min": "6"}}, fiber.StatusOK},
+
+		{"status", request{method: http.MethodPatch, path: "/v1/toys/" + toy.ToyId, userId: alice.UserId, body: `{"status":"exchanging"}`}, fiber.StatusOK},
+		{"status removed is not allowed", request{method: http.MethodPatch, path: "/v1/toys/" + toy.ToyId, userId: alice.UserId, body: `{"status":"removed"}`}, fiber.StatusBadRequest},
+		{"status without body", request{method: http.MethodPatch, path: "/v1/toys/" + toy.ToyId, userId: alice.UserId, body: `{}`}, fiber.StatusBadRequest},
+
+		{"list", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{},"with_total":"exact"}`}, fiber.StatusOK},
+		{"list limit over max", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{},"limit":101}`}, fiber.StatusBadRequest},
+		{"list relevance without text", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{},"sort":{"field":"relevance"}}`}, fiber.StatusBadRequest},
+		{"list distance without near", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{},"sort":{"field":"distance"}}`}, fiber.StatusBadRequest},
+		{"list unknown status", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{"statuses":["lost"]}}`}, fiber.StatusBadRequest},
+		{"list forged cursor", request{method: http.MethodPost, path: "/v1/toys/list", userId: bob.UserId, body: `{"query":{},"cursor":"forged"}`}, fiber.StatusBadRequest},
+
+		{"delete", request{method: http.MethodDelete, path: "/v1/toys/" + toy.ToyId, userId: alice.UserId}, fiber.StatusOK},
+		{"get deleted", request{method: http.MethodGet, path: "/v1/toys/" + toy.ToyId, userId: bob.UserId}, fiber.StatusNotFound},
+	})
+}
+
+func TestCreateToyIsIdempotent(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+
+	create := request{method: http.MethodPost, path: "/v1/toys/", userId: alice.UserId, token: "retry", form: map[string]string{"name": "Юла"}}
+
+	status, body := s.do(create)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create = %d: %s", status, body)
+	}
+	first := decode[models.ReponseToyPost](t, body)
+
+	// повтор с тем же токеном и другими полями возвращает уже созданную игрушку
+	create.form = map[string]string{"name": "Другое имя"}
+	status, body = s.do(create)
+	if status != fiber.StatusCreated {
+		t.Fatalf("retry = %d: %s", status, body)
+	}
+	second := decode[models.ReponseToyPost](t, body)
+
+	if second.Toy.ToyId != first.Toy.ToyId || second.Toy.Name != "Юла" {
+		t.Errorf("retry returned %+v, want toy %s", second.Toy, first.Toy.ToyId)
+	}
+
+	status, body = s.do(request{method: http.MethodPost, path: "/v1/toys/list", userId: alice.UserId,
+		body: `{"query":{"user_ids":["` + alice.UserId + `"]},"with_total":"exact"}`})
+	if list := decode[models.ResponseToysList](t, body); status != fiber.StatusOK || list.Total == nil || list.Total.Count != 1 {
+		t.Errorf("toys after retry = %d: %s, want one toy", status, body)
+	}
+}
+
+func TestToyPhotos(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+	toy := s.toy(alice.UserId, "Мяч")
+
+	status, body := s.do(request{method: http.MethodPost, path: "/v1/toys/" + toy.ToyId + "/photos", userId: alice.UserId, file: pngImage(t)})
+	if status != fiber.StatusCreated {
+		t.Fatalf("add photo = %d: %s", status, body)
+	}
+
+	photos := decode[models.ResponseToyPhotos](t, body).Photos
+	if len(photos) != 1 || !strings.HasPrefix(photos[0].Full, "http://localhost/v1/files/") {
+		t.Fatalf("photos = %+v, want one signed photo", photos)
+	}
+
+	photoId := photos[0].PhotoId
+	photosPath := "/v1/toys/" + toy.ToyId + "/photos"
+
+	s.run([]testCase{
+		{"add without file", request{method: http.MethodPost, path: photosPath, userId: alice.UserId, form: map[string]string{}}, fiber.StatusBadRequest},
+		{"add to foreign toy", request{method: http.MethodPost, path: photosPath, userId: bob.UserId, file: pngImage(t)}, fiber.StatusNotFound},
+		{"add broken image", request{method: http.MethodPost, path: photosPath, userId: alice.UserId, file: []byte("not an image")}, fiber.StatusBadRequest},
+		{"reorder", request{method: http.MethodPut, path: photosPath, userId: alice.UserId, body: `{"photo_ids":["` + photoId + `"]}`}, fiber.StatusOK},
+		{"reorder other photos", request{method: http.MethodPut, path: photosPath, userId: alice.UserId, body: `{"photo_ids":["unknown"]}`}, fiber.StatusBadRequest},
+		{"reorder duplicates", request{method: http.MethodPut, path: photosPath, userId: alice.UserId, body: `{"photo_ids":["` + photoId + `","` + photoId + `"]}`}, fiber.StatusBadRequest},
+		{"reorder foreign toy", request{method: http.MethodPut, path: photosPath, userId: bob.UserId, body: `{"photo_ids":["` + photoId + `"]}`}, fiber.StatusNotFound},
+		{"delete unknown photo", request{method: http.MethodDelete, path: photosPath + "/unknown", userId: alice.UserId}, fiber.StatusNotFound},
+		{"delete", request{method: http.MethodDelete, path: photosPath + "/" + photoId, userId: alice.UserId}, fiber.StatusOK},
+	})
+
+	kept, err := s.storage.InsertToyPhoto(context.Background(), toy.ToyId, alice.UserId, &models.PhotoSet{Thumbnail: "kept_t", Medium: "kept_m", Full: "kept_f"})
+	if err != nil || len(kept) != 1 {
+		t.Fatalf("InsertToyPhoto = %v, %v", kept, err)
+	}
+
+	// игрушка в обмене
+	if _, err := s.storage.UpdateToyStatus(context.Background(), toy.ToyId, alice.UserId, models.KExchangingToyStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	s.run([]testCase{
+		{"add to exchanging toy", request{method: http.MethodPost, path: photosPath, userId: alice.UserId, file: pngImage(t)}, fiber.StatusConflict},
+		{"reorder exchanging toy", request{method: http.MethodPut, path: photosPath, userId: alice.UserId, body: `{"photo_ids":["` + kept[0].PhotoId + `"]}`}, fiber.StatusConflict},
+		{"update exchanging toy with file", request{method: http.MethodPost, path: "/v1/toys/change", userId: alice.UserId,
+			headers: map[string]string{kHeaderToyId: toy.ToyId}, form: map[string]string{"name": "Мяч"}, file: pngImage(t)}, fiber.StatusConflict},
+		{"delete photo of exchanging toy", request{method: http.MethodDelete, path: photosPath + "/" + kept[0].PhotoId, userId: alice.UserId}, fiber.StatusConflict},
+	})
+
+	if stored, err := s.storage.SelectToyById(context.Background(), toy.ToyId); err != nil || stored == nil || len(stored.Photos) != 1 {
+		t.Errorf("exchanging toy = %+v, %v, want the photo unchanged", stored, err)
+	}
+}
+
+func TestExchanges(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+	carol := s.user("carol@example.com")
+
+	aliceToy := s.toy(alice.UserId, "Мяч")
+	bobToy := s.toy(bob.UserId, "Юла")
+	carolToy := s.toy(carol.UserId, "Кубики")
+
+	if err := s.storage.InsertUserBlock(context.Background(), carol.UserId, alice.UserId); err != nil {
+		t.Fatal(err)
+	}
+
+	offer := func(toy1 *models.Toy, toy2 *models.Toy) string {
+		return `{"user_toy_1":{"user_id":"` + toy1.UserId + `","toy_id":"` + toy1.ToyId + `"},` +
+			`"user_toy_2":{"user_id":"` + toy2.UserId + `","toy_id":"` + toy2.ToyId + `"}}`
+	}
+
+	create := request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, token: "exchange_1", body: offer(aliceToy, bobToy)}
+
+	status, body := s.do(create)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create = %d: %s", status, body)
+	}
+	exchangeId := decode[models.ResponseExchangePost](t, body).Exchange.ExchangeId
+
+	// повтор с тем же токеном возвращает тот же обмен
+	status, body = s.do(create)
+	if retry := decode[models.ResponseExchangePost](t, body); status != fiber.StatusCreated || retry.Exchange.ExchangeId != exchangeId {
+		t.Fatalf("retry = %d: %s, want exchange %s", status, body, exchangeId)
+	}
+
+	exchangePath := "/v1/exchange/" + exchangeId
+
+	s.run([]testCase{
+		{"same toys with new token", request{method: http.MethodPost, path: "/v1/exchange/", userId: bob.UserId, token: "exchange_2", body: offer(bobToy, aliceToy)}, fiber.StatusConflict},
+		{"without token", request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, body: offer(aliceToy, bobToy)}, fiber.StatusBadRequest},
+		{"without toys", request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, token: "exchange_3", body: `{}`}, fiber.StatusBadRequest},
+		{"foreign toy", request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, token: "exchange_4",
+			body: offer(&models.Toy{UserId: alice.UserId, ToyId: bobToy.ToyId}, carolToy)}, fiber.StatusBadRequest},
+		{"not a participant", request{method: http.MethodPost, path: "/v1/exchange/", userId: carol.UserId, token: "exchange_5", body: offer(aliceToy, bobToy)}, fiber.StatusBadRequest},
+		{"with self", request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, token: "exchange_6",
+			body: offer(aliceToy, s.toy(alice.UserId, "Кукла"))}, fiber.StatusBadRequest},
+		{"blocked users", request{method: http.MethodPost, path: "/v1/exchange/", userId: alice.UserId, token: "exchange_7", body: offer(aliceToy, carolToy)}, fiber.StatusForbidden},
+
+		{"get", request{method: http.MethodGet, path: exchangePath, userId: alice.UserId}, fiber.StatusOK},
+		{"get unknown", request{method: http.MethodGet, path: "/v1/exchange/unknown", userId: alice.UserId}, fiber.StatusNotFound},
+
+		{"patch", request{method: http.MethodPatch, path: exchangePath, userId: alice.UserId, body: `{"status":"confirm_1"}`}, fiber.StatusOK},
+		{"patch unknown status", request{method: http.MethodPatch, path: exchangePath, userId: alice.UserId, body: `{"status":"success"}`}, fiber.StatusBadRequest},
+		{"patch unknown exchange", request{method: http.MethodPatch, path: "/v1/exchange/unknown", userId: alice.UserId, body: `{"status":"confirm_1"}`}, fiber.StatusNotFound},
+
+		{"list", request{method: http.MethodPost, path: "/v1/exchange/list", userId: alice.UserId, body: `{"query":{"awaiting_my_action":true},"with_total":"exact"}`}, fiber.StatusOK},
+		{"list unknown role", request{method: http.MethodPost, path: "/v1/exchange/list", userId: alice.UserId, body: `{"query":{"role":"owner"}}`}, fiber.StatusBadRequest},
+		{"list unknown sort", request{method: http.MethodPost, path: "/v1/exchange/list", userId: alice.UserId, body: `{"query":{},"sort":{"field":"name"}}`}, fiber.StatusBadRequest},
+		{"list forged cursor", request{method: http.MethodPost, path: "/v1/exchange/list", userId: alice.UserId, body: `{"query":{},"cursor":"forged"}`}, fiber.StatusBadRequest},
+	})
+}
+
+func TestMessages(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+	carol := s.user("carol@example.com")
+	exchange := s.exchange(s.toy(alice.UserId, "Мяч"), s.toy(bob.UserId, "Юла"))
+
+	messagesPath := "/v1/exchange/" + exchange.ExchangeId + "/messages"
+	send := request{method: http.MethodPost, path: messagesPath, userId: alice.UserId, token: "message_1", body: `{"text":"Привет"}`}
+
+	status, body := s.do(send)
+	if status != fiber.StatusCreated {
+		t.Fatalf("send = %d: %s", status, body)
+	}
+	messageId := decode[models.ResponseExchangeMessagePost](t, body).Message.MessageId
+
+	status, body = s.do(send)
+	if retry := decode[models.ResponseExchangeMessagePost](t, body); status != fiber.StatusCreated || retry.Message.MessageId != messageId {
+		t.Fatalf("retry = %d: %s, want message %s", status, body, messageId)
+	}
+
+	s.run([]testCase{
+		{"send empty text", request{method: http.MethodPost, path: messagesPath, userId: alice.UserId, token: "message_2", body: `{"text":""}`}, fiber.StatusBadRequest},
+		{"send without token", request{method: http.MethodPost, path: messagesPath, userId: alice.UserId, body: `{"text":"Привет"}`}, fiber.StatusBadRequest},
+		{"send by outsider", request{method: http.MethodPost, path: messagesPath, userId: carol.UserId, token: "message_3", body: `{"text":"Привет"}`}, fiber.StatusNotFound},
+		{"list", request{method: http.MethodGet, path: messagesPath + "?limit=10", userId: bob.UserId}, fiber.StatusOK},
+		{"list by outsider", request{method: http.MethodGet, path: messagesPath, userId: carol.UserId}, fiber.StatusNotFound},
+		{"list limit over max", request{method: http.MethodGet, path: messagesPath + "?limit=1000", userId: bob.UserId}, fiber.StatusBadRequest},
+		{"list forged cursor", request{method: http.MethodGet, path: messagesPath + "?cursor=forged", userId: bob.UserId}, fiber.StatusBadRequest},
+	})
+}
+
+func TestReviews(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+	carol := s.user("carol@example.com")
+
+	finished := s.exchange(s.toy(alice.UserId, "Мяч"), s.toy(bob.UserId, "Юла"))
+	open := s.exchange(s.toy(alice.UserId, "Кукла"), s.toy(bob.UserId, "Кубики"))
+
+	// обмен завершается напрямую через хранилище, чтобы не отправлять письма о подтверждении
+	for _, status := range []models.ExchangeDetailsStatus{models.KConfirm1ExchangeDetailsStatus, models.KConfirm2ExchangeDetailsStatus} {
+		for _, user := range []*models.User{alice, bob} {
+			if _, err := s.storage.UpdateExchangeWithParticipants(context.Background(), finished.ExchangeId, user.UserId, status); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	reviewPath := "/v1/exchange/" + finished.ExchangeId + "/reviews"
+
+	s.run([]testCase{
+		{"create", request{method: http.MethodPost, path: reviewPath, userId: alice.UserId, body: `{"rating":5,"comment":"Спасибо"}`}, fiber.StatusCreated},
+		{"create again", request{method: http.MethodPost, path: reviewPath, userId: alice.UserId, body: `{"rating":4}`}, fiber.StatusConflict},
+		{"rating over max", request{method: http.MethodPost, path: reviewPath, userId: bob.UserId, body: `{"rating":6}`}, fiber.StatusBadRequest},
+		{"without rating", request{method: http.MethodPost, path: reviewPath, userId: bob.UserId, body: `{}`}, fiber.StatusBadRequest},
+		{"by outsider", request{method: http.MethodPost, path: reviewPath, userId: carol.UserId, body: `{"rating":1}`}, fiber.StatusNotFound},
+		{"unfinished exchange", request{method: http.MethodPost, path: "/v1/exchange/" + open.ExchangeId + "/reviews", userId: alice.UserId, body: `{"rating":5}`}, fiber.StatusBadRequest},
+		{"unknown exchange", request{method: http.MethodPost, path: "/v1/exchange/unknown/reviews", userId: alice.UserId, body: `{"rating":5}`}, fiber.StatusNotFound},
+		{"list", request{method: http.MethodGet, path: "/v1/users/" + bob.UserId + "/reviews", userId: carol.UserId}, fiber.StatusOK},
+		{"list forged cursor", request{method: http.MethodGet, path: "/v1/users/" + bob.UserId + "/reviews?cursor=forged", userId: carol.UserId}, fiber.StatusBadRequest},
+	})
+
+	_, body := s.do(request{method: http.MethodGet, path: "/v1/users/" + bob.UserId, userId: carol.UserId})
+	if profile := decode[models.ResponseUserGet](t, body); profile.User.Rating.Count != 1 || profile.User.Rating.Average != 5 {
+		t.Errorf("rating = %+v, want 5 of 1", profile.User.Rating)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s := newTestServer(t, memory.New())
+	alice := s.user("alice@example.com")
+	bob := s.user("bob@example.com")
+
+	userPath := "/v1/users/" + bob.UserId
+
+	s.run([]testCase{
+		{"get", request{method: http.MethodGet, path: userPath, userId: alice.UserId}, fiber.StatusOK},
+		{"get unknown", request{method: http.MethodGet, path: "/v1/users/unknown", userId: alice.UserId}, fiber.StatusNotFound},
+		{"location", request{method: http.MethodPost, path: "/v1/users/location", userId: alice.UserId, body: `{"lat":55.75,"lon":37.62,"city":"Москва"}`}, fiber.StatusOK},
+		{"location out of range", request{method: http.MethodPost, path: "/v1/users/location", userId: alice.UserId, body: `{"lat":95,"lon":37.62}`}, fiber.StatusBadRequest},
+		{"report", request{method: http.MethodPost, path: userPath + "/report", userId: alice.UserId, body: `{"reason":"спам"}`}, fiber.StatusCreated},
+		{"report without reason", request{method: http.MethodPost, path: userPath + "/report", userId: alice.UserId, body: `{}`}, fiber.StatusBadRequest},
+		{"report unknown", request{method: http.MethodPost, path: "/v1/users/unknown/report", userId: alice.UserId, body: `{"reason":"спам"}`}, fiber.StatusNotFound},
+		{"block", request{method: http.MethodPost, path: userPath + "/block", userId: alice.UserId}, fiber.StatusOK},
+		{"block again", request{method: http.MethodPost, path: userPath + "/block", userId: alice.UserId}, fiber.StatusOK},
+		{"block unknown", request{method: http.MethodPost, path: "/v1/users/unknown/block", userId: alice.UserId}, fiber.StatusNotFound},
+		{"unblock", request{method: http.MethodDelete, path: userPath + "/block", userId: alice.UserId}, fiber.StatusOK},
+	})
+}
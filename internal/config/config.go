@@ -12,8 +12,10 @@ type Config struct {
 	ENV      	string         		`yaml:"env"`
 	Postgres 	ConfigPostgres 		`yaml:"postgres"`
 	Server   	ConfigServer   		`yaml:"server"`
+	Blob 		ConfigBlob 			`yaml:"blob"`
 }
 
+// ConfigPostgres - подключение к базе. Driver: postgres - database/sql с lib/pq, pgx - пул pgxpool
 type ConfigPostgres struct {
 	Driver       	string 			`yaml:"driver"`
 	Host         	string 			`yaml:"host"`
@@ -26,14 +28,54 @@ type ConfigPostgres struct {
 	MaxIdleConns 	int    			`yaml:"max_idle_conns"`
 	MaxIdleTime  	time.Duration 	`yaml:"max_idle_time"`
 	Timeout 		time.Duration	`yaml:"timeout"`
+	// Dsn заменяет host, port, username, password, db_name и sslmode, если задан
+	Dsn 			string 			`yaml:"dsn"`
+	// Replicas - DSN реплик только для чтения, пусто - все запросы идут в основную базу
+	Replicas 		[]string 		`yaml:"replicas"`
+	// ReadYourWrites - сколько после записи чтения пользователя идут в основную базу, а не в реплики.
+	// Действует в пределах экземпляра сервиса, который принял запись
+	ReadYourWrites 	time.Duration 	`yaml:"read_your_writes" env-default:"5s"`
+	// ReplicaHealthInterval - как часто проверяется доступность реплик
+	ReplicaHealthInterval time.Duration `yaml:"replica_health_interval" env-default:"10s"`
 };
 
 type ConfigServer struct {
 	Host 			string 			`yaml:"host"`
 	Port 			int 			`yaml:"port"`
 	Timeout 		time.Duration  	`yaml:"timeout"`
-	Prefix_upload	string			`yaml:"prefix_upload"`
-	PhotoUrl		string			`yaml:"photo_url"`
+	MaxUploadSize	int64			`yaml:"max_upload_size" env-default:"10485760"`
+	CursorSecret	string			`yaml:"cursor_secret" env:"CURSOR_SECRET"`
+};
+
+// ConfigBlob - хранилище загруженных файлов. Driver: local - диск одного инстанса, s3 - S3-совместимое хранилище
+type ConfigBlob struct {
+	Driver 			string 			`yaml:"driver" env-default:"local"`
+	// срок действия ссылок на скачивание
+	UrlTTL 			time.Duration 	`yaml:"url_ttl" env-default:"15m"`
+	// файлы без ссылок удаляются не раньше, чем через GracePeriod, проверка - раз в ReapInterval
+	GracePeriod 	time.Duration 	`yaml:"grace_period" env-default:"24h"`
+	ReapInterval 	time.Duration 	`yaml:"reap_interval" env-default:"1h"`
+	ReapBatchSize 	int64 			`yaml:"reap_batch_size" env-default:"100"`
+	Local 			ConfigBlobLocal `yaml:"local"`
+	S3 				ConfigBlobS3 	`yaml:"s3"`
+};
+
+type ConfigBlobLocal struct {
+	Dir 			string 			`yaml:"dir"`
+	// адрес /v1/files сервиса, по которому отдаются файлы
+	PublicUrl 		string 			`yaml:"public_url"`
+	SignSecret 		string 			`yaml:"sign_secret" env:"BLOB_SIGN_SECRET"`
+};
+
+type ConfigBlobS3 struct {
+	Endpoint 		string 			`yaml:"endpoint"`
+	Region 			string 			`yaml:"region" env-default:"us-east-1"`
+	Bucket 			string 			`yaml:"bucket"`
+	AccessKey 		string 			`yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey 		string 			`yaml:"secret_key" env:"S3_SECRET_KEY"`
+	// bucket в пути (http://host/bucket/key), как у MinIO, а не в имени хоста
+	PathStyle 		bool 			`yaml:"path_style"`
+	Timeout 		time.Duration 	`yaml:"timeout" env-default:"10s"`
 };
 
 func New() *Config {
@@ -0,0 +1,226 @@
+// Package exchange - правила сделки: подтверждения сторон, провал и обмен игрушками.
+// Функции пакета вызываются хранилищем внутри одной транзакции и меняют данные только через Tx
+// Пакет зависит только от models, поэтому его импортируют реализации хранилища, не завися от сервиса
+package exchange
+
+import (
+	"service/internal/models"
+)
+
+// Tx - операции хранилища в рамках текущей транзакции
+type Tx interface {
+	// LockToys блокирует игрушки до конца транзакции в порядке toy_id
+	LockToys(toyIds []string) error
+	// LockExchange блокирует обмен до конца транзакции, nil - обмена нет
+	LockExchange(exchangeId string) (*models.Exchange, error)
+	SelectExchangeDetails(exchangeId string) ([]models.ExchangeDetails, error)
+	// SelectOpenExchangeIds - обмены, где у одной из игрушек статус участника еще не failed/success
+	SelectOpenExchangeIds(toyIds []string) ([]string, error)
+	UpdateExchangeStatus(exchangeId string, status models.ExchangeStatus) error
+	UpdateExchangeDetailsStatus(exchangeId string, userId string, status models.ExchangeDetailsStatus) error
+	// TransferToy передает игрушку новому владельцу по сделке exchangeId и записывает это в историю владения
+	TransferToy(toyId string, userId string, exchangeId string) error
+}
+
+func isCompletedDetails(status models.ExchangeDetailsStatus) bool {
+	return status == models.KFailedExchangeDetailsStatus || status == models.KSuccessExchangeDetailsStatus
+}
+
+func isCompletedExchange(status models.ExchangeStatus) bool {
+	return status == models.KFailedExchangeStatus || status == models.KSuccessExchangeStatus
+}
+
+// setDetailsStatus меняет статус участника; статус завершенного участника не меняется
+func setDetailsStatus(tx Tx, details *models.ExchangeDetails, status models.ExchangeDetailsStatus) (bool, error) {
+	if isCompletedDetails(details.Status) || details.Status == status {
+		return false, nil
+	}
+
+	if err := tx.UpdateExchangeDetailsStatus(details.ExchangeId, details.UserId, status); err != nil {
+		return false, err
+	}
+
+	details.Status = status
+	return true, nil
+}
+
+func setExchangeStatus(tx Tx, exchange *models.Exchange, status models.ExchangeStatus) error {
+	if err := tx.UpdateExchangeStatus(exchange.ExchangeId, status); err != nil {
+		return err
+	}
+
+	exchange.Status = status
+	return nil
+}
+
+// UpdateDetailsStatus - участник меняет свой статус в обмене:
+//   - failed проваливает обмен и всех остальных участников;
+//   - confirm_1 обеих сторон переводит обмен в confirm;
+//   - confirm_2 обеих сторон завершает обмен успехом и меняет игрушки владельцами.
+//
+// Статус участника, уже получившего failed или success, не меняется
+func UpdateDetailsStatus(tx Tx, exchangeId string, userId string, status models.ExchangeDetailsStatus) error {
+	details, err := tx.SelectExchangeDetails(exchangeId)
+	if err != nil || len(details) == 0 {
+		return err
+	}
+
+	if err := lockToys(tx, details); err != nil {
+		return err
+	}
+
+	exchange, err := tx.LockExchange(exchangeId)
+	if err != nil || exchange == nil {
+		return err
+	}
+
+	// статусы могли измениться, пока транзакция ждала блокировку
+	details, err = tx.SelectExchangeDetails(exchangeId)
+	if err != nil {
+		return err
+	}
+
+	var mine *models.ExchangeDetails
+	for i := range details {
+		if details[i].UserId == userId {
+			mine = &details[i]
+		}
+	}
+
+	if mine == nil {
+		return nil
+	}
+
+	changed, err := setDetailsStatus(tx, mine, status)
+	if err != nil || !changed {
+		return err
+	}
+
+	switch status {
+	case models.KFailedExchangeDetailsStatus:
+		return failExchange(tx, exchange, details)
+	case models.KConfirm1ExchangeDetailsStatus:
+		if hasOtherStatus(details, userId, status) {
+			return setExchangeStatus(tx, exchange, models.KConfirmExchangeStatus)
+		}
+	case models.KConfirm2ExchangeDetailsStatus:
+		if hasOtherStatus(details, userId, status) {
+			return completeExchange(tx, exchange, details)
+		}
+	}
+
+	return nil
+}
+
+// RemoveToy проваливает все незавершенные обмены с удаленной игрушкой
+func RemoveToy(tx Tx, toyId string) error {
+	if err := tx.LockToys([]string{toyId}); err != nil {
+		return err
+	}
+
+	return failToyExchanges(tx, []string{toyId}, "")
+}
+
+// lockToys блокирует игрушки сделки раньше самой сделки. Обмен блокируется только под блокировкой
+// хотя бы одной его игрушки, а игрушки - всегда в одном порядке: иначе две сделки с общей игрушкой,
+// завершаясь одновременно, держат каждая свой обмен и ждут чужой в failToyExchanges
+func lockToys(tx Tx, details []models.ExchangeDetails) error {
+	toyIds := make([]string, 0, len(details))
+	for _, participant := range details {
+		toyIds = append(toyIds, participant.ToyId)
+	}
+
+	return tx.LockToys(toyIds)
+}
+
+func hasOtherStatus(details []models.ExchangeDetails, userId string, status models.ExchangeDetailsStatus) bool {
+	for _, other := range details {
+		if other.UserId != userId && other.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failExchange проваливает незавершенных участников и сам обмен
+func failExchange(tx Tx, exchange *models.Exchange, details []models.ExchangeDetails) error {
+	for i := range details {
+		if _, err := setDetailsStatus(tx, &details[i], models.KFailedExchangeDetailsStatus); err != nil {
+			return err
+		}
+	}
+
+	if isCompletedExchange(exchange.Status) {
+		return nil
+	}
+
+	return setExchangeStatus(tx, exchange, models.KFailedExchangeStatus)
+}
+
+// completeExchange завершает обмен: участники получают success, игрушки с теми же toy_id
+// переходят к другой стороне, остальные сделки с ними проваливаются
+func completeExchange(tx Tx, exchange *models.Exchange, details []models.ExchangeDetails) error {
+	if err := setExchangeStatus(tx, exchange, models.KSuccessExchangeStatus); err != nil {
+		return err
+	}
+
+	owners := make(map[string]string, len(details))
+	for _, participant := range details {
+		owners[participant.ToyId] = participant.UserId
+	}
+
+	if err := tx.TransferToy(exchange.SrcToyId, owners[exchange.DstToyId], exchange.ExchangeId); err != nil {
+		return err
+	}
+
+	if err := tx.TransferToy(exchange.DstToyId, owners[exchange.SrcToyId], exchange.ExchangeId); err != nil {
+		return err
+	}
+
+	if err := failToyExchanges(tx, []string{exchange.SrcToyId, exchange.DstToyId}, exchange.ExchangeId); err != nil {
+		return err
+	}
+
+	for i := range details {
+		if _, err := setDetailsStatus(tx, &details[i], models.KSuccessExchangeDetailsStatus); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// failToyExchanges проваливает незавершенные обмены с игрушками, кроме exceptExchangeId
+func failToyExchanges(tx Tx, toyIds []string, exceptExchangeId string) error {
+	exchangeIds, err := tx.SelectOpenExchangeIds(toyIds)
+	if err != nil {
+		return err
+	}
+
+	for _, exchangeId := range exchangeIds {
+		if exchangeId == exceptExchangeId {
+			continue
+		}
+
+		exchange, err := tx.LockExchange(exchangeId)
+		if err != nil {
+			return err
+		}
+
+		if exchange == nil {
+			continue
+		}
+
+		details, err := tx.SelectExchangeDetails(exchangeId)
+		if err != nil {
+			return err
+		}
+
+		if err := failExchange(tx, exchange, details); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,327 @@
+package exchange
+
+import (
+	"service/internal/models"
+
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type fakeToy struct {
+	userId string
+	status models.ToyStatus
+}
+
+// fakeTx - хранилище в памяти с теми же правилами выборки, что и запросы Postgres
+type fakeTx struct {
+	exchanges map[string]*models.Exchange
+	details   []*models.ExchangeDetails
+	toys      map[string]*fakeToy
+	transfers []string
+	// locks - порядок блокировок: "toys:toy_1,toy_2" и "exchange:e1"
+	locks []string
+}
+
+func (f *fakeTx) LockToys(toyIds []string) error {
+	sorted := append([]string(nil), toyIds...)
+	sort.Strings(sorted)
+	f.locks = append(f.locks, "toys:"+strings.Join(sorted, ","))
+
+	return nil
+}
+
+func (f *fakeTx) LockExchange(exchangeId string) (*models.Exchange, error) {
+	f.locks = append(f.locks, "exchange:"+exchangeId)
+
+	exchange, ok := f.exchanges[exchangeId]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *exchange
+	return &copied, nil
+}
+
+func (f *fakeTx) SelectExchangeDetails(exchangeId string) ([]models.ExchangeDetails, error) {
+	details := make([]models.ExchangeDetails, 0)
+	for _, participant := range f.details {
+		if participant.ExchangeId == exchangeId {
+			details = append(details, *participant)
+		}
+	}
+
+	return details, nil
+}
+
+func (f *fakeTx) SelectOpenExchangeIds(toyIds []string) ([]string, error) {
+	ids := make(map[string]struct{})
+	for _, participant := range f.details {
+		for _, toyId := range toyIds {
+			if participant.ToyId == toyId && !isCompletedDetails(participant.Status) {
+				ids[participant.ExchangeId] = struct{}{}
+			}
+		}
+	}
+
+	exchangeIds := make([]string, 0, len(ids))
+	for exchangeId := range ids {
+		exchangeIds = append(exchangeIds, exchangeId)
+	}
+	sort.Strings(exchangeIds)
+
+	return exchangeIds, nil
+}
+
+func (f *fakeTx) UpdateExchangeStatus(exchangeId string, status models.ExchangeStatus) error {
+	f.exchanges[exchangeId].Status = status
+	return nil
+}
+
+func (f *fakeTx) UpdateExchangeDetailsStatus(exchangeId string, userId string, status models.ExchangeDetailsStatus) error {
+	for _, participant := range f.details {
+		if participant.ExchangeId == exchangeId && participant.UserId == userId {
+			participant.Status = status
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeTx) TransferToy(toyId string, userId string, exchangeId string) error {
+	f.toys[toyId].userId = userId
+	f.toys[toyId].status = models.KCreatedToyStatus
+	f.transfers = append(f.transfers, fmt.Sprintf("%s->%s by %s", toyId, userId, exchangeId))
+
+	return nil
+}
+
+// newFakeTx: toy_N принадлежит user_N, обмены заданы как "exchange_id": {src, dst, статус обмена, статус src, статус dst}
+func newFakeTx(exchanges map[string][5]string) *fakeTx {
+	f := &fakeTx{
+		exchanges: make(map[string]*models.Exchange),
+		toys:      make(map[string]*fakeToy),
+	}
+
+	owner := func(toyId string) string { return "user" + toyId[len("toy"):] }
+
+	for exchangeId, e := range exchanges {
+		f.exchanges[exchangeId] = &models.Exchange{
+			ExchangeId: exchangeId,
+			SrcToyId:   e[0],
+			DstToyId:   e[1],
+			Status:     models.ExchangeStatus(e[2]),
+		}
+
+		for i, toyId := range []string{e[0], e[1]} {
+			f.toys[toyId] = &fakeToy{userId: owner(toyId), status: models.KCreatedToyStatus}
+			f.details = append(f.details, &models.ExchangeDetails{
+				ExchangeId: exchangeId,
+				ToyId:      toyId,
+				UserId:     owner(toyId),
+				Status:     models.ExchangeDetailsStatus(e[3+i]),
+			})
+		}
+	}
+
+	return f
+}
+
+// state - статусы обменов и участников в виде "exchange_id": "статус обмена src dst"
+func (f *fakeTx) state() map[string]string {
+	state := make(map[string]string, len(f.exchanges))
+	for exchangeId, exchange := range f.exchanges {
+		details, _ := f.SelectExchangeDetails(exchangeId)
+
+		statuses := map[string]models.ExchangeDetailsStatus{}
+		for _, participant := range details {
+			statuses[participant.ToyId] = participant.Status
+		}
+
+		state[exchangeId] = fmt.Sprintf("%s %s %s", exchange.Status, statuses[exchange.SrcToyId], statuses[exchange.DstToyId])
+	}
+
+	return state
+}
+
+func (f *fakeTx) toyOwners() map[string]string {
+	owners := make(map[string]string, len(f.toys))
+	for toyId, toy := range f.toys {
+		owners[toyId] = toy.userId
+	}
+
+	return owners
+}
+
+func TestUpdateDetailsStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		exchanges map[string][5]string
+		userId    string
+		status    models.ExchangeDetailsStatus
+		want      map[string]string
+		wantMoves []string
+		wantOwner map[string]string
+	}{
+		{
+			name:      "first confirm_1 only changes participant",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "created", "created", "created"}},
+			userId:    "user_1",
+			status:    models.KConfirm1ExchangeDetailsStatus,
+			want:      map[string]string{"e1": "created confirm_1 created"},
+		},
+		{
+			name:      "second confirm_1 confirms exchange",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "created", "confirm_1", "created"}},
+			userId:    "user_2",
+			status:    models.KConfirm1ExchangeDetailsStatus,
+			want:      map[string]string{"e1": "confirm confirm_1 confirm_1"},
+		},
+		{
+			name:      "first confirm_2 only changes participant",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "confirm", "confirm_1", "confirm_1"}},
+			userId:    "user_1",
+			status:    models.KConfirm2ExchangeDetailsStatus,
+			want:      map[string]string{"e1": "confirm confirm_2 confirm_1"},
+		},
+		{
+			name: "second confirm_2 transfers toys and fails competing offers",
+			exchanges: map[string][5]string{
+				"e1": {"toy_1", "toy_2", "confirm", "confirm_2", "confirm_1"},
+				// конкурирующие предложения с теми же игрушками
+				"e2": {"toy_1", "toy_3", "created", "created", "confirm_1"},
+				"e3": {"toy_4", "toy_2", "confirm", "confirm_1", "confirm_1"},
+				// завершенные сделки не трогаются
+				"e4": {"toy_5", "toy_2", "failed", "failed", "failed"},
+			},
+			userId: "user_2",
+			status: models.KConfirm2ExchangeDetailsStatus,
+			want: map[string]string{
+				"e1": "success success success",
+				"e2": "failed failed failed",
+				"e3": "failed failed failed",
+				"e4": "failed failed failed",
+			},
+			wantMoves: []string{"toy_1->user_2 by e1", "toy_2->user_1 by e1"},
+			wantOwner: map[string]string{
+				"toy_1": "user_2",
+				"toy_2": "user_1",
+				"toy_3": "user_3",
+				"toy_4": "user_4",
+				"toy_5": "user_5",
+			},
+		},
+		{
+			name:      "failed fails other participant and exchange",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "confirm", "confirm_1", "confirm_1"}},
+			userId:    "user_1",
+			status:    models.KFailedExchangeDetailsStatus,
+			want:      map[string]string{"e1": "failed failed failed"},
+		},
+		{
+			name:      "failed participant cannot change status",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "failed", "failed", "failed"}},
+			userId:    "user_1",
+			status:    models.KConfirm1ExchangeDetailsStatus,
+			want:      map[string]string{"e1": "failed failed failed"},
+		},
+		{
+			name:      "successful participant cannot fail",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "success", "success", "success"}},
+			userId:    "user_1",
+			status:    models.KFailedExchangeDetailsStatus,
+			want:      map[string]string{"e1": "success success success"},
+		},
+		{
+			name:      "repeated status does not trigger transitions",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "created", "confirm_1", "confirm_1"}},
+			userId:    "user_1",
+			status:    models.KConfirm1ExchangeDetailsStatus,
+			want:      map[string]string{"e1": "created confirm_1 confirm_1"},
+		},
+		{
+			name:      "user outside exchange changes nothing",
+			exchanges: map[string][5]string{"e1": {"toy_1", "toy_2", "created", "created", "created"}},
+			userId:    "user_3",
+			status:    models.KFailedExchangeDetailsStatus,
+			want:      map[string]string{"e1": "created created created"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := newFakeTx(tc.exchanges)
+
+			if err := UpdateDetailsStatus(tx, "e1", tc.userId, tc.status); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tx.state(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("state = %v, want %v", got, tc.want)
+			}
+
+			sort.Strings(tx.transfers)
+			if !reflect.DeepEqual(tx.transfers, tc.wantMoves) {
+				t.Errorf("transfers = %v, want %v", tx.transfers, tc.wantMoves)
+			}
+
+			if tc.wantOwner != nil && !reflect.DeepEqual(tx.toyOwners(), tc.wantOwner) {
+				t.Errorf("owners = %v, want %v", tx.toyOwners(), tc.wantOwner)
+			}
+		})
+	}
+}
+
+func TestRemoveToy(t *testing.T) {
+	tx := newFakeTx(map[string][5]string{
+		"e1": {"toy_1", "toy_2", "created", "created", "created"},
+		"e2": {"toy_3", "toy_1", "confirm", "confirm_1", "confirm_1"},
+		"e3": {"toy_1", "toy_4", "success", "success", "success"},
+		"e4": {"toy_3", "toy_4", "created", "created", "created"},
+	})
+
+	if err := RemoveToy(tx, "toy_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"e1": "failed failed failed",
+		"e2": "failed failed failed",
+		"e3": "success success success",
+		"e4": "created created created",
+	}
+
+	if got := tx.state(); !reflect.DeepEqual(got, want) {
+		t.Errorf("state = %v, want %v", got, want)
+	}
+}
+
+// TestLockOrder - игрушки сделки блокируются раньше обменов, в том числе конкурирующих
+func TestLockOrder(t *testing.T) {
+	tx := newFakeTx(map[string][5]string{
+		"e1": {"toy_2", "toy_1", "confirm", "confirm_2", "confirm_1"},
+		"e2": {"toy_3", "toy_1", "confirm", "confirm_2", "confirm_1"},
+	})
+
+	if err := UpdateDetailsStatus(tx, "e1", "user_1", models.KConfirm2ExchangeDetailsStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"toys:toy_1,toy_2", "exchange:e1", "exchange:e2"}
+	if !reflect.DeepEqual(tx.locks, want) {
+		t.Errorf("locks = %v, want %v", tx.locks, want)
+	}
+
+	tx = newFakeTx(map[string][5]string{"e1": {"toy_1", "toy_2", "created", "created", "created"}})
+
+	if err := RemoveToy(tx, "toy_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"toys:toy_1", "exchange:e1"}
+	if !reflect.DeepEqual(tx.locks, want) {
+		t.Errorf("locks = %v, want %v", tx.locks, want)
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 const (
 	KToyNotFound = "Toy not found"
 	KExchangeNotFound = "Exchange not found"
@@ -13,13 +15,38 @@ const (
 	KInvalidGetToy = "Invalid get toy"
 	KInvalidUpdateToy = "Invalid update toy"
 	KInvalidToysList = "Invalid toys list"
+	KInvalidToyHistory = "Invalid toy history"
+	KInvalidCategories = "Invalid categories"
 	KInvalidExchangeList = "Invalid exchange list"
 	KInvalidCreateExchange = "Invalid create exchange"
 	KInvalidGetExchange = "Invalid get exchange"
 	KInvalidUpdateExchangeStatus = "Invalid update exchange status"
+	KInvalidCreateMessage = "Invalid create message"
+	KInvalidMessageList = "Invalid message list"
 	KInvalidVerify = "Invalid verify"
 	KUnauthorized = "Unauthorized"
 	KExistUser = "User is exist"
+	KUserNotFound = "User not found"
+	KInvalidGetUser = "Invalid get user"
+	KInvalidCreateReview = "Invalid create review"
+	KInvalidReviewList = "Invalid review list"
+	KExistReview = "Review is exist"
+	KInvalidReportUser = "Invalid report user"
+	KInvalidBlockUser = "Invalid block user"
+	KInvalidUpdateLocation = "Invalid update location"
+	KUserBlocked = "User is blocked"
+	KPhotoNotFound = "Photo not found"
+	KTooManyPhotos = "Too many photos"
+	KInvalidAddPhoto = "Invalid add photo"
+	KInvalidDeletePhoto = "Invalid delete photo"
+	KInvalidOrderPhotos = "Invalid order photos"
+	KFileNotFound = "File not found"
+	KInvalidFileSignature = "Invalid file signature"
+	KInvalidGetFile = "Invalid get file"
+	KExistExchange = "Exchange is exist"
+	KExistToy = "Toy is exist"
+	KExchangeConflict = "Exchange is changed concurrently"
+	KToyNotEditable = "Toy is not editable"
 )
 
 type ResponseError struct {
@@ -27,12 +54,76 @@ type ResponseError struct {
 	Message string `json:"message" validate:"required"`
 }
 
+const (
+	KSortAsc = "asc"
+	KSortDesc = "desc"
+
+	KSortCreatedAt = "created_at"
+	KSortUpdatedAt = "updated_at"
+	KSortName = "name"
+	KSortRelevance = "relevance"
+	KSortDistance = "distance"
+)
+
+const (
+	KTotalExact = "exact"
+	KTotalEstimated = "estimated"
+)
+
+type ToysSort struct {
+	Field string `json:"field" validate:"required,oneof=created_at updated_at name relevance distance"`
+	Direction string `json:"direction,omitempty" validate:"omitempty,oneof=asc desc"`
+}
+
+type ExchangesSort struct {
+	Field string `json:"field" validate:"required,oneof=created_at updated_at"`
+	Direction string `json:"direction,omitempty" validate:"omitempty,oneof=asc desc"`
+}
+
+// Total - количество записей по фильтру без учета курсора и лимита.
+// Estimated = true, если число взято из оценки планировщика, а не посчитано
+type Total struct {
+	Count int64 `json:"count"`
+	Estimated bool `json:"estimated"`
+}
+
+// Keyset - значение поля сортировки и id первой записи следующей страницы
+type Keyset struct {
+	Value *string
+	Id string
+}
+
 type QueryToys struct {
 	Statuses []string `json:"statuses,omitempty" validate:"omitempty,min=1,dive,oneof=created exchanging removed"`
 	UserIds []string  `json:"user_ids,omitempty" validate:"omitempty,min=1,dive,min=1"`
 	ExcludeUserIds []string `json:"exclude_user_ids,omitempty" validate:"omitempty,min=1,dive,min=1"`
+	CategoryIds []string `json:"category_ids,omitempty" validate:"omitempty,min=1,dive,min=1"`
+	Tags []string `json:"tags,omitempty" validate:"omitempty,min=1,dive,min=1"`
+	Age *int `json:"age,omitempty" validate:"omitempty,min=0,max=18"`
+	Conditions []string `json:"conditions,omitempty" validate:"omitempty,min=1,dive,oneof=new like_new used"`
+	Text *string `json:"text,omitempty" validate:"omitempty,min=1,max=200"`
+	Near *QueryNear `json:"near,omitempty" validate:"omitempty"`
+}
+
+const (
+	KRoleInitiator = "initiator"
+	KRoleRecipient = "recipient"
+)
+
+// QueryDateRange - полуинтервал [From, To), любая из границ может быть не задана
+type QueryDateRange struct {
+	From *time.Time `json:"from,omitempty" validate:"omitempty"`
+	To *time.Time `json:"to,omitempty" validate:"omitempty"`
 }
 
 type QueryExchanges struct {
 	Statuses []string `json:"statuses,omitempty" validate:"omitempty,min=1,dive,oneof=created confirm success failed"`
+	// initiator - обмен предложил пользователь (его игрушка src_toy_id), recipient - предложили ему
+	Role *string `json:"role,omitempty" validate:"omitempty,oneof=initiator recipient"`
+	CounterpartyId *string `json:"counterparty_id,omitempty" validate:"omitempty,min=1"`
+	ToyId *string `json:"toy_id,omitempty" validate:"omitempty,min=1"`
+	CreatedAt *QueryDateRange `json:"created_at,omitempty" validate:"omitempty"`
+	UpdatedAt *QueryDateRange `json:"updated_at,omitempty" validate:"omitempty"`
+	// обмены, где статус пользователя отстает от статуса другой стороны
+	AwaitingMyAction bool `json:"awaiting_my_action,omitempty"`
 }
@@ -0,0 +1,24 @@
+package models
+
+type EventType string
+
+const (
+	KExchangeOfferEvent EventType = "exchange_offer"
+	KExchangeStatusEvent EventType = "exchange_status"
+	KExchangeDetailsStatusEvent EventType = "exchange_details_status"
+	KExchangeMessageEvent EventType = "exchange_message"
+)
+
+// Event приходит из pg_notify('exchange_events', ...) и рассылается подключенным пользователям
+type Event struct {
+	Type 		EventType 	`json:"type"`
+	ExchangeId 	string 		`json:"exchange_id"`
+	UserId 		*string 	`json:"user_id,omitempty" validate:"omitempty"`
+	MessageId 	*string 	`json:"message_id,omitempty" validate:"omitempty"`
+	Status 		string 		`json:"status,omitempty"`
+	UserIds 	[]string 	`json:"user_ids"`
+}
+
+type RequestEvents struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+}
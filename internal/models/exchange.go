@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
@@ -20,6 +21,12 @@ const (
 	KFailedExchangeDetailsStatus ExchangeDetailsStatus = "failed"
 )
 
+// ErrExchangeExists - по этой паре игрушек уже есть незавершенная сделка
+var ErrExchangeExists = errors.New(KExistExchange)
+
+// ErrExchangeConflict - сделку одновременно меняет другой запрос, изменение можно повторить
+var ErrExchangeConflict = errors.New(KExchangeConflict)
+
 type Exchange struct {
 	ExchangeId 	string 		`json:"exchange_id"`
 	SrcToyId 	string 		`json:"src_toy_id"`
@@ -49,20 +56,26 @@ type ExchangeParticipant struct {
     ToyId              string    `json:"toy_id"`
     ToyName            string    `json:"toy_name"`
     ToyDescription     *string   `json:"toy_description,omitempty" validate:"omitempty"`
-    ToyPhotoURL        *string   `json:"toy_photo_url,omitempty" validate:"omitempty"`
+    ToyPhotos          []ToyPhoto `json:"toy_photos"`
+    ToyLocation        *Location `json:"toy_location,omitempty" validate:"omitempty"`
+    // расстояние до игрушки второго участника, если у обеих известно место
+    ToyDistance        *float64  `json:"toy_distance_km,omitempty" validate:"omitempty"`
     
     UserId             string    `json:"user_id"`
     FirstName          string    `json:"first_name"`
     MiddleName         *string   `json:"middle_name,omitempty" validate:"omitempty"`
     LastName           string    `json:"last_name"`
+    UserRating         UserRating `json:"user_rating"`
     
     UserExchangeStatus ExchangeDetailsStatus    `json:"user_exchange_status"`
 }
 
 type ExchangeDetailsInfo struct {
 	Toy 		ToyInfo 	`json:"toy"`
-	User	 	UserName	`json:"user"`
+	User	 	UserInfo	`json:"user"`
 	Status 		ExchangeDetailsStatus `json:"status"`
+	// расстояние до игрушки второго участника
+	Distance 	*float64 	`json:"distance_km,omitempty" validate:"omitempty"`
 }
 
 type ExchangeInfo struct {
@@ -107,8 +120,10 @@ type RequestExchangePatch struct {
 
 type RequestExchangeListBody struct {
 	Query QueryExchanges `json:"query" validate:"required"`
+	Sort *ExchangesSort `json:"sort,omitempty" validate:"omitempty"`
 	Limit *int64 `json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
 	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+	WithTotal *string `json:"with_total,omitempty" validate:"omitempty,oneof=exact estimated"`
 }
 
 type RequestExchangeList struct {
@@ -120,6 +135,7 @@ type RequestExchangeList struct {
 type ResponseExchangeList struct {
 	Exchanges []ExchangeInfo `json:"exchanges" validate:"required"`
 	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+	Total *Total `json:"total,omitempty"`
 }
 
 type ResponseExchangePatch struct {
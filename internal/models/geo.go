@@ -0,0 +1,13 @@
+package models
+
+type Location struct {
+	Lat 	float64 	`json:"lat" validate:"min=-90,max=90"`
+	Lon 	float64 	`json:"lon" validate:"min=-180,max=180"`
+	City 	*string 	`json:"city,omitempty" validate:"omitempty,min=1,max=100"`
+}
+
+type QueryNear struct {
+	Lat 		float64 	`json:"lat" validate:"min=-90,max=90"`
+	Lon 		float64 	`json:"lon" validate:"min=-180,max=180"`
+	RadiusKm 	float64 	`json:"radius_km" validate:"required,gt=0,max=500"`
+}
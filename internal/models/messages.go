@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type ExchangeMessage struct {
+	MessageId 	string 		`json:"message_id"`
+	ExchangeId 	string 		`json:"exchange_id"`
+	UserId 		string 		`json:"user_id"`
+	Text 		string 		`json:"text"`
+	IdempotencyToken string `json:"idempotency_token" validate:"required,min=1"`
+	CreatedAt 	time.Time  	`json:"created_at"`
+}
+
+// Request
+type RequestExchangeMessagePostBody struct {
+	Text string `json:"text" validate:"required,min=1,max=4000"`
+}
+
+type RequestExchangeMessagePost struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	ExchangeId string `json:"exchange_id" validate:"required,min=1"`
+	IdempotencyToken string `json:"idempotency_token" validate:"required,min=1"`
+	Body RequestExchangeMessagePostBody `json:"body" validate:"required"`
+}
+
+type RequestExchangeMessageListQuery struct {
+	Limit *int64 `query:"limit" json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
+	Cursor *string `query:"cursor" json:"cursor,omitempty" validate:"omitempty,min=1"`
+}
+
+type RequestExchangeMessageList struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	ExchangeId string `json:"exchange_id" validate:"required,min=1"`
+	Query RequestExchangeMessageListQuery `json:"query"`
+}
+
+// Response
+type ResponseExchangeMessagePost struct {
+	Message ExchangeMessage `json:"message"`
+}
+
+type ResponseExchangeMessageList struct {
+	Messages []ExchangeMessage `json:"messages" validate:"required"`
+	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PoolStats - состояние пула соединений с базой
+type PoolStats struct {
+	Driver 		string 		`json:"driver"`
+	MaxConns 	int64 		`json:"max_conns"`
+	TotalConns 	int64 		`json:"total_conns"`
+	IdleConns 	int64 		`json:"idle_conns"`
+	InUseConns 	int64 		`json:"in_use_conns"`
+	// WaitCount - сколько раз запросу пришлось ждать свободное соединение, WaitDuration - сколько всего ждали
+	WaitCount 	int64 		`json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration_ns"`
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"mime/multipart"
+)
+
+const (
+	KMaxToyPhotos = 10
+)
+
+var (
+	ErrTooManyPhotos = errors.New(KTooManyPhotos)
+	// фотографии меняются только у игрушки в статусе created
+	ErrToyNotEditable = errors.New(KToyNotEditable)
+	ErrFileNotFound = errors.New(KFileNotFound)
+)
+
+// PhotoSet - варианты одной фотографии разного размера.
+// В базе хранятся ключи BlobStore, в ответах клиенту они заменяются подписанными ссылками
+type PhotoSet struct {
+	Thumbnail 	string 		`json:"thumbnail"`
+	Medium 		string 		`json:"medium"`
+	Full 		string 		`json:"full"`
+}
+
+// Keys - ключи всех вариантов фотографии
+func (p *PhotoSet) Keys() []string {
+	return []string{p.Thumbnail, p.Medium, p.Full}
+}
+
+// PhotoKeys - ключи всех вариантов всех фотографий
+func PhotoKeys(photos []ToyPhoto) []string {
+	keys := make([]string, 0, 3*len(photos))
+	for i := range photos {
+		keys = append(keys, photos[i].Keys()...)
+	}
+
+	return keys
+}
+
+// ToyPhoto - фотография игрушки, Position задает порядок показа (0 - обложка)
+type ToyPhoto struct {
+	PhotoId 	string 		`json:"photo_id"`
+	Position 	int 		`json:"position"`
+	PhotoSet
+}
+
+// Request
+type RequestToyPhotoPost struct {
+	ToyId string `json:"toy_id" validate:"required,min=1"`
+	UserId string `json:"user_id" validate:"required,min=1"`
+	File *multipart.FileHeader `json:"file" validate:"required"`
+}
+
+func (req *RequestToyPhotoPost) GetFile() *multipart.FileHeader {
+	return req.File
+}
+
+type RequestToyPhotoDelete struct {
+	ToyId string `json:"toy_id" validate:"required,min=1"`
+	UserId string `json:"user_id" validate:"required,min=1"`
+	PhotoId string `json:"photo_id" validate:"required,min=1"`
+}
+
+type RequestToyPhotosOrderBody struct {
+	PhotoIds []string `json:"photo_ids" validate:"required,min=1,unique,dive,min=1"`
+}
+
+type RequestToyPhotosOrder struct {
+	ToyId string `json:"toy_id" validate:"required,min=1"`
+	UserId string `json:"user_id" validate:"required,min=1"`
+	Body RequestToyPhotosOrderBody `json:"body" validate:"required"`
+}
+
+// Response
+type ResponseToyPhotos struct {
+	Photos []ToyPhoto `json:"photos" validate:"required"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+type Review struct {
+	ExchangeId 	string 		`json:"exchange_id"`
+	ReviewerId 	string 		`json:"reviewer_id"`
+	UserId 		string 		`json:"user_id"`
+	Rating 		int 		`json:"rating" validate:"required,min=1,max=5"`
+	Comment 	*string 	`json:"comment,omitempty" validate:"omitempty"`
+	CreatedAt 	time.Time  	`json:"created_at"`
+	UpdatedAt 	time.Time  	`json:"updated_at"`
+}
+
+type UserRating struct {
+	Average float64 `json:"average"`
+	Count 	int64 	`json:"count"`
+}
+
+// Request
+type RequestReviewPostBody struct {
+	Rating 	int 	`json:"rating" validate:"required,min=1,max=5"`
+	Comment *string `json:"comment,omitempty" validate:"omitempty,max=2000"`
+}
+
+type RequestReviewPost struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	ExchangeId string `json:"exchange_id" validate:"required,min=1"`
+	Body RequestReviewPostBody `json:"body" validate:"required"`
+}
+
+type RequestUserReviewsQuery struct {
+	Limit *int64 `query:"limit" json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
+	Cursor *string `query:"cursor" json:"cursor,omitempty" validate:"omitempty,min=1"`
+}
+
+type RequestUserReviews struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	TargetUserId string `json:"target_user_id" validate:"required,min=1"`
+	Query RequestUserReviewsQuery `json:"query"`
+}
+
+// Response
+type ResponseReviewPost struct {
+	Review Review `json:"review"`
+}
+
+type ResponseUserReviews struct {
+	Reviews []Review `json:"reviews" validate:"required"`
+	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+}
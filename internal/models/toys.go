@@ -1,29 +1,65 @@
 package models
 
 import (
+	"errors"
 	"mime/multipart"
 	"time"
 )
 
 type ToyStatus string
+type ToyCondition string
 
 const (
 	KCreatedToyStatus ToyStatus = "created"
 	KRemovedToyStatus ToyStatus = "removed"
 	KExchangingToyStatus ToyStatus = "exchanging"
 	KExchangedToyStatus ToyStatus = "exchanged"
+
+	KNewToyCondition ToyCondition = "new"
+	KLikeNewToyCondition ToyCondition = "like_new"
+	KUsedToyCondition ToyCondition = "used"
 )
 
+// ErrToyExists - idempotency_token уже занят игрушкой другого пользователя
+var ErrToyExists = errors.New(KExistToy)
+
 type Toy struct {
 	ToyId 		string 		`json:"toy_id"`
 	UserId 		string 		`json:"user_id"`
 	Name 		string 		`json:"name"`
 	IdempotencyToken string `json:"idempotency_token" validate:"required,min=1"`
 	Description *string 	`json:"description,omitempty" validate:"omitempty"`
-	PhotoUrl 	*string 	`json:"photo_url,omitempty" validate:"omitempty"`
+	Photos 		[]ToyPhoto 	`json:"photos"`
 	Status 		ToyStatus 	`json:"status"`
+	CategoryId 	*string 	`json:"category_id,omitempty" validate:"omitempty"`
+	Tags 		[]string 	`json:"tags"`
+	AgeMin 		*int 		`json:"age_min,omitempty" validate:"omitempty"`
+	AgeMax 		*int 		`json:"age_max,omitempty" validate:"omitempty"`
+	Condition 	*ToyCondition `json:"condition,omitempty" validate:"omitempty"`
+	Location 	*Location 	`json:"location,omitempty" validate:"omitempty"`
 	CreatedAt 	time.Time  	`json:"created_at"`
 	UpdatedAt 	time.Time  	`json:"updated_at"`
+
+	// заполняются только при поиске по тексту
+	Score 		*float64 	`json:"score,omitempty" validate:"omitempty"`
+	Snippet 	*string 	`json:"snippet,omitempty" validate:"omitempty"`
+	// заполняется только при поиске рядом
+	Distance 	*float64 	`json:"distance_km,omitempty" validate:"omitempty"`
+}
+
+type Category struct {
+	CategoryId 	string 		`json:"category_id"`
+	ParentId 	*string 	`json:"parent_id,omitempty" validate:"omitempty"`
+	Name 		string 		`json:"name"`
+}
+
+// ToyOwnership - период владения игрушкой. ExchangeId - сделка, по которой игрушка получена
+// (nil - создана владельцем), ReleasedAt - когда игрушка перешла следующему (nil - текущий владелец)
+type ToyOwnership struct {
+	UserId 		string 		`json:"user_id"`
+	ExchangeId 	*string 	`json:"exchange_id,omitempty"`
+	AcquiredAt 	time.Time 	`json:"acquired_at"`
+	ReleasedAt 	*time.Time 	`json:"released_at,omitempty"`
 }
 
 type ToyInfo struct {
@@ -31,7 +67,7 @@ type ToyInfo struct {
 	UserId 		string 		`json:"user_id"`
 	Name 		string 		`json:"name"`
 	Description *string 	`json:"description,omitempty" validate:"omitempty"`
-	PhotoUrl 	*string 	`json:"photo_url,omitempty" validate:"omitempty"`
+	Photos 		[]ToyPhoto 	`json:"photos"`
 }
 
 
@@ -58,8 +94,10 @@ type RequestToyPatch struct {
 
 type RequestToysListBody struct {
 	Query QueryToys `json:"query" validate:"required"`
+	Sort *ToysSort `json:"sort,omitempty" validate:"omitempty"`
 	Limit *int64 `json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
 	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+	WithTotal *string `json:"with_total,omitempty" validate:"omitempty,oneof=exact estimated"`
 }
 
 type RequestToysList struct {
@@ -71,6 +109,12 @@ type RequestToyPutBody struct {
 	ToyId 		string 		`json:"toy_id" validate:"required,min=1"`
 	Name 		string 		`json:"name" validate:"required,min=1"`
 	Description *string 	`json:"description,omitempty" validate:"omitempty"`
+	CategoryId 	*string 	`json:"category_id,omitempty" validate:"omitempty,min=1"`
+	Tags 		[]string 	`json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=50"`
+	AgeMin 		*int 		`json:"age_min,omitempty" validate:"omitempty,min=0,max=18"`
+	AgeMax 		*int 		`json:"age_max,omitempty" validate:"omitempty,min=0,max=18"`
+	Condition 	*string 	`json:"condition,omitempty" validate:"omitempty,oneof=new like_new used"`
+	Location 	*Location 	`json:"location,omitempty" validate:"omitempty"`
 }
 
 type RequestToyPut struct {
@@ -86,6 +130,12 @@ func (req *RequestToyPut) GetFile() *multipart.FileHeader {
 type RequestToyPostBody struct {
 	Name 		string 		`json:"name" validate:"min=1"`
 	Description *string 	`json:"description,omitempty" validate:"omitempty"`
+	CategoryId 	*string 	`json:"category_id,omitempty" validate:"omitempty,min=1"`
+	Tags 		[]string 	`json:"tags,omitempty" validate:"omitempty,max=20,dive,min=1,max=50"`
+	AgeMin 		*int 		`json:"age_min,omitempty" validate:"omitempty,min=0,max=18"`
+	AgeMax 		*int 		`json:"age_max,omitempty" validate:"omitempty,min=0,max=18"`
+	Condition 	*string 	`json:"condition,omitempty" validate:"omitempty,oneof=new like_new used"`
+	Location 	*Location 	`json:"location,omitempty" validate:"omitempty"`
 }
 
 type RequestToyPost struct {
@@ -115,8 +165,17 @@ type ReponseToyPatch struct {
 type ResponseToysList struct {
 	Toys []Toy `json:"toys" validate:"required"`
 	Cursor *string `json:"cursor,omitempty" validate:"omitempty,min=1"`
+	Total *Total `json:"total,omitempty"`
 }
 
 type ResponseToyPut struct {
 	Toy Toy `json:"toy" validate:"required"`
 }
+
+type ResponseToyHistory struct {
+	History []ToyOwnership `json:"history" validate:"required"`
+}
+
+type ResponseCategories struct {
+	Categories []Category `json:"categories" validate:"required"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Upload - файл в BlobStore. ToyId - игрушка, к которой файл был привязан,
+// ReleasedAt - с какого момента на файл нет ссылок (nil - файл используется)
+type Upload struct {
+	Key 		string 		`json:"key"`
+	ToyId 		*string 	`json:"toy_id,omitempty"`
+	CreatedAt 	time.Time 	`json:"created_at"`
+	ReleasedAt 	*time.Time 	`json:"released_at,omitempty"`
+}
@@ -10,6 +10,7 @@ type User struct {
 	UserName UserName `json:"user_name" validate:"required"`
 	HashPassword string `json:"password" validate:"required,min=1"`
 	Email string `json:"email" validate:"required,email"`
+	Location *Location `json:"location,omitempty" validate:"omitempty"`
 	CreatedAt 	time.Time  	`json:"created_at"`
 	UpdatedAt 	time.Time  	`json:"updated_at"`
 }
@@ -30,6 +31,57 @@ type UserName struct {
 	MiddleName *string 	`json:"middle_name,omitempty" validate:"omitempty"`
 }
 
+// UserInfo - публичные данные пользователя, без email
+type UserInfo struct {
+	UserName
+	Rating UserRating `json:"rating"`
+}
+
+type UserProfile struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	UserName UserName `json:"user_name" validate:"required"`
+	Rating UserRating `json:"rating"`
+	City *string `json:"city,omitempty" validate:"omitempty"`
+	CreatedAt 	time.Time  	`json:"created_at"`
+}
+
+type RequestUserLocation struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	Body Location `json:"body" validate:"required"`
+}
+
+type ResponseUserLocation struct {
+	Location Location `json:"location"`
+}
+
+type RequestUserGet struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	TargetUserId string `json:"target_user_id" validate:"required,min=1"`
+}
+
+type UserReport struct {
+	ReportId string `json:"report_id"`
+	ReporterId string `json:"reporter_id"`
+	UserId string `json:"user_id"`
+	Reason string `json:"reason"`
+	CreatedAt 	time.Time  	`json:"created_at"`
+}
+
+type RequestUserReportBody struct {
+	Reason string `json:"reason" validate:"required,min=1,max=2000"`
+}
+
+type RequestUserReport struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	TargetUserId string `json:"target_user_id" validate:"required,min=1,nefield=UserId"`
+	Body RequestUserReportBody `json:"body" validate:"required"`
+}
+
+type RequestUserBlock struct {
+	UserId string `json:"user_id" validate:"required,min=1"`
+	TargetUserId string `json:"target_user_id" validate:"required,min=1,nefield=UserId"`
+}
+
 type RequestRegisterBody struct {
 	UserName UserName `json:"user_name"`
 	Password string   `json:"password" validate:"required,min=1"`
@@ -56,4 +108,12 @@ type ResponseRegister struct {
 
 type ResponseLogin struct {
 	UserId string `json:"user_id" validate:"required,min=1"`
+}
+
+type ResponseUserReport struct {
+	Report UserReport `json:"report"`
+}
+
+type ResponseUserGet struct {
+	User UserProfile `json:"user"`
 }
\ No newline at end of file
@@ -0,0 +1,20 @@
+package parsers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ParseEvents(req *models.RequestEvents, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
@@ -78,5 +78,18 @@ func ParseExchangeList(req *models.RequestExchangeList, app *service.Application
 		req.Body.Limit = &limit
 	}
 
+	fillExchangesSort(&req.Body)
+
 	return nil
+}
+
+// по умолчанию сверху обмены с последними изменениями
+func fillExchangesSort(body *models.RequestExchangeListBody) {
+	if body.Sort == nil {
+		body.Sort = &models.ExchangesSort{Field: models.KSortUpdatedAt}
+	}
+
+	if body.Sort.Direction == "" {
+		body.Sort.Direction = models.KSortDesc
+	}
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package parsers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ParseExchangeMessagePost(req *models.RequestExchangeMessagePost, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.IdempotencyToken = getHeader(context, kXIdempotencyToken)
+	req.ExchangeId = context.Params(kExchangeId)
+
+	if err := context.BodyParser(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseExchangeMessageList(req *models.RequestExchangeMessageList, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.ExchangeId = context.Params(kExchangeId)
+
+	if err := context.QueryParser(&req.Query); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if req.Query.Limit == nil {
+		limit := kLimit
+		req.Query.Limit = &limit
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package parsers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	kPhotoId = "photo_id"
+	kFile = "file"
+)
+
+func ParseToyPhotoPost(req *models.RequestToyPhotoPost, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.ToyId = context.Params(kToyId)
+
+	file, err := context.FormFile(kFile)
+	if err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+	req.File = file
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseToyPhotoDelete(req *models.RequestToyPhotoDelete, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.ToyId = context.Params(kToyId)
+	req.PhotoId = context.Params(kPhotoId)
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseToyPhotosOrder(req *models.RequestToyPhotosOrder, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.ToyId = context.Params(kToyId)
+
+	if err := context.BodyParser(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package parsers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func ParseReviewPost(req *models.RequestReviewPost, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.ExchangeId = context.Params(kExchangeId)
+
+	if err := context.BodyParser(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseUserReviews(req *models.RequestUserReviews, app *service.Application, context *fiber.Ctx) error {
+	req.UserId = getHeader(context, kXUserId)
+	req.TargetUserId = context.Params(kUserId)
+
+	if err := context.QueryParser(&req.Query); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if req.Query.Limit == nil {
+		limit := kLimit
+		req.Query.Limit = &limit
+	}
+
+	return nil
+}
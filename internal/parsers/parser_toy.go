@@ -4,7 +4,10 @@ import (
 	"service/internal/service"
 	"service/internal/models"
 
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -17,9 +20,144 @@ const(
 	kStatus = "status"
 	kXIdempotencyToken = "x_idempotency_token"
 	kExchangeId = "exchange_id"
+	kCategoryId = "category_id"
+	kTags = "tags"
+	kAgeMin = "age_min"
+	kAgeMax = "age_max"
+	kCondition = "condition"
+	kLat = "lat"
+	kLon = "lon"
+	kCity = "city"
 	kLimit int64 = 40
 )
 
+type toyAttributes struct {
+	CategoryId *string
+	Tags []string
+	AgeMin *int
+	AgeMax *int
+	Condition *string
+	Location *models.Location
+}
+
+func parseFormInt(context *fiber.Ctx, key string) (*int, error) {
+	value := context.FormValue(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be integer", key)
+	}
+
+	return &number, nil
+}
+
+func parseFormFloat(context *fiber.Ctx, key string) (*float64, error) {
+	value := context.FormValue(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be number", key)
+	}
+
+	return &number, nil
+}
+
+// координаты передаются только парой, город без координат не сохраняем
+func parseFormLocation(context *fiber.Ctx) (*models.Location, error) {
+	lat, err := parseFormFloat(context, kLat)
+	if err != nil {
+		return nil, err
+	}
+
+	lon, err := parseFormFloat(context, kLon)
+	if err != nil {
+		return nil, err
+	}
+
+	if lat == nil && lon == nil {
+		return nil, nil
+	}
+
+	if lat == nil || lon == nil {
+		return nil, errors.New("lat and lon must be set together")
+	}
+
+	location := models.Location{
+		Lat: *lat,
+		Lon: *lon,
+	}
+
+	if city := context.FormValue(kCity); city != "" {
+		location.City = &city
+	}
+
+	return &location, nil
+}
+
+// теги приходят одной строкой через запятую, храним в нижнем регистре без повторов
+func parseFormTags(context *fiber.Ctx) []string {
+	value := context.FormValue(kTags)
+	if value == "" {
+		return nil
+	}
+
+	tags := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func parseToyAttributes(context *fiber.Ctx) (*toyAttributes, error) {
+	var attributes toyAttributes
+	var err error
+
+	if categoryId := context.FormValue(kCategoryId); categoryId != "" {
+		attributes.CategoryId = &categoryId
+	}
+
+	if condition := context.FormValue(kCondition); condition != "" {
+		attributes.Condition = &condition
+	}
+
+	attributes.Tags = parseFormTags(context)
+
+	if attributes.AgeMin, err = parseFormInt(context, kAgeMin); err != nil {
+		return nil, err
+	}
+
+	if attributes.AgeMax, err = parseFormInt(context, kAgeMax); err != nil {
+		return nil, err
+	}
+
+	if attributes.AgeMin != nil && attributes.AgeMax != nil && *attributes.AgeMin > *attributes.AgeMax {
+		return nil, errors.New("age_min must be less or equal age_max")
+	}
+
+	if attributes.Location, err = parseFormLocation(context); err != nil {
+		return nil, err
+	}
+
+	return &attributes, nil
+}
+
 // чтобы пофиксить баг с сохранением больше чем одного пользовательского заголовка
 func getHeader(context *fiber.Ctx, key string) string {
 	return fmt.Sprintf("%s", context.Get(key))
@@ -90,6 +228,48 @@ func ParseToysList(req *models.RequestToysList, app *service.Application, contex
 		req.Body.Limit = &limit
 	}
 
+	for i := range req.Body.Query.Tags {
+		req.Body.Query.Tags[i] = strings.ToLower(strings.TrimSpace(req.Body.Query.Tags[i]))
+	}
+
+	if err := fillToysSort(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+// по умолчанию: по релевантности при поиске по тексту, по расстоянию при поиске рядом, иначе сначала новые
+func fillToysSort(body *models.RequestToysListBody) error {
+	if body.Sort == nil {
+		body.Sort = &models.ToysSort{Field: models.KSortCreatedAt}
+
+		if body.Query.Text != nil {
+			body.Sort.Field = models.KSortRelevance
+		} else if body.Query.Near != nil {
+			body.Sort.Field = models.KSortDistance
+		}
+	}
+
+	if body.Sort.Field == models.KSortRelevance && body.Query.Text == nil {
+		return errors.New("sort by relevance requires query.text")
+	}
+
+	if body.Sort.Field == models.KSortDistance && body.Query.Near == nil {
+		return errors.New("sort by distance requires query.near")
+	}
+
+	if body.Sort.Direction == "" {
+		switch body.Sort.Field {
+		case models.KSortName, models.KSortDistance:
+			body.Sort.Direction = models.KSortAsc
+		default:
+			body.Sort.Direction = models.KSortDesc
+		}
+	}
+
 	return nil
 }
 
@@ -102,7 +282,20 @@ func ParseToyPut(req *models.RequestToyPut, app *service.Application, context *f
 		req.Toy.Description = &description
 	} 
 
-	if file, err := context.FormFile("file"); err != nil {
+	attributes, err := parseToyAttributes(context)
+	if err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+	req.Toy.CategoryId = attributes.CategoryId
+	req.Toy.Tags = attributes.Tags
+	req.Toy.AgeMin = attributes.AgeMin
+	req.Toy.AgeMax = attributes.AgeMax
+	req.Toy.Condition = attributes.Condition
+	req.Toy.Location = attributes.Location
+
+	if file, err := context.FormFile(kFile); err != nil {
 		app.Log.Info("File not added")
 	} else {
 		req.File = file
@@ -126,8 +319,21 @@ func ParseToyPost(req *models.RequestToyPost, app *service.Application, context
 		req.Toy.Description = &description
 	} 
 
+	attributes, err := parseToyAttributes(context)
+	if err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+	req.Toy.CategoryId = attributes.CategoryId
+	req.Toy.Tags = attributes.Tags
+	req.Toy.AgeMin = attributes.AgeMin
+	req.Toy.AgeMax = attributes.AgeMax
+	req.Toy.Condition = attributes.Condition
+	req.Toy.Location = attributes.Location
+
 	// также можно добавить проверку типов jpg, png и тд
-	if file, err := context.FormFile("file"); err != nil {
+	if file, err := context.FormFile(kFile); err != nil {
 		app.Log.Info("File not added")
 		req.File = nil
 	} else {
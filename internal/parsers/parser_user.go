@@ -14,6 +14,7 @@ const (
 	kLastName = "last_name"
 	kMiddleName = "middle_name"
 	kEmail = "email"
+	kUserId = "user_id"
 )
 
 func ParseRegister(req *models.RequestRegister, app *service.Application, context *fiber.Ctx) (error) {
@@ -45,5 +46,68 @@ func ParseLogin(req *models.RequestLogin, app *service.Application, context *fib
 		return err
 	}
 
+	return nil
+}
+
+func ParseUserGet(req *models.RequestUserGet, app *service.Application, context *fiber.Ctx) (error) {
+	req.UserId = getHeader(context, kXUserId)
+	req.TargetUserId = context.Params(kUserId)
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseUserReport(req *models.RequestUserReport, app *service.Application, context *fiber.Ctx) (error) {
+	req.UserId = getHeader(context, kXUserId)
+	req.TargetUserId = context.Params(kUserId)
+
+	if err := context.BodyParser(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseUserBlock(req *models.RequestUserBlock, app *service.Application, context *fiber.Ctx) (error) {
+	req.UserId = getHeader(context, kXUserId)
+	req.TargetUserId = context.Params(kUserId)
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	return nil
+}
+
+func ParseUserLocation(req *models.RequestUserLocation, app *service.Application, context *fiber.Ctx) (error) {
+	req.UserId = getHeader(context, kXUserId)
+
+	if err := context.BodyParser(&req.Body); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
+	if err := app.Validator.Struct(req); err != nil {
+		app.Log.Warn(err.Error())
+
+		return err
+	}
+
 	return nil
 }
\ No newline at end of file
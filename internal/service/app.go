@@ -3,38 +3,91 @@ package service
 import (
 	"service/internal/config"
 	"service/internal/models"
+	"service/internal/service/events"
 
+	"context"
+	"io"
 	"log/slog"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
 
 type Storage interface {
 	// TOY
-	InsertToy(newToy *models.Toy) (*models.Toy, error)
-	SelectToyById(toyId string) (*models.Toy, error)
-	SelectToyByUserId(toyId string, userId string) (*models.Toy, error)
-	SelectToyByToken(token string) (*models.Toy, error)
-	UpdateToyStatus(toyId string, userId string, status models.ToyStatus) (*models.Toy, error)
-	UpdateToy(newToy *models.Toy) (*models.Toy, error)
-	SelectToysList(query *models.QueryToys, cursor *string, limit int64) ([]models.Toy, *string, error)
+	InsertToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error)
+	SelectToyById(ctx context.Context, toyId string) (*models.Toy, error)
+	SelectToyByUserId(ctx context.Context, toyId string, userId string) (*models.Toy, error)
+	// SelectToyByToken ищет игрушку userId по токену идемпотентности ее создания
+	SelectToyByToken(ctx context.Context, token string, userId string) (*models.Toy, error)
+	UpdateToyStatus(ctx context.Context, toyId string, userId string, status models.ToyStatus) (*models.Toy, error)
+	UpdateToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error)
+	SelectToysList(ctx context.Context, query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.Toy, *models.Keyset, *models.Total, error)
+	SelectCategories(ctx context.Context) ([]models.Category, error)
+	SelectToyOwnershipHistory(ctx context.Context, toyId string) ([]models.ToyOwnership, error)
+
+	// TOY PHOTO
+	// models.ErrToyNotEditable, если игрушка не в статусе created; так же для фотографий в UpdateToy
+	InsertToyPhoto(ctx context.Context, toyId string, userId string, photo *models.PhotoSet) ([]models.ToyPhoto, error)
+	DeleteToyPhoto(ctx context.Context, toyId string, userId string, photoId string) ([]models.ToyPhoto, error)
+	UpdateToyPhotosOrder(ctx context.Context, toyId string, userId string, photoIds []string) ([]models.ToyPhoto, error)
+
+	// UPLOAD
+	InsertUploads(ctx context.Context, keys []string) error
+	SelectOrphanUploads(ctx context.Context, releasedBefore time.Time, limit *int64) ([]models.Upload, error)
+	// DeleteUpload - false, если записи нет или на файл снова ссылаются: тогда файл удалять нельзя
+	DeleteUpload(ctx context.Context, key string) (bool, error)
 
 	// EXCHANGE
-	InsertExchange(exchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error)
-	SelectExchangeWithParticipants(exchangeId string) ([]models.ExchangeParticipant, error)
-	UpdateExchangeWithParticipants(exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error)
-	SelectExchangeList(query *models.QueryExchanges, userId string, cursor *string, limit int64) ([]models.ExchangeParticipant, *string, error)
+	InsertExchange(ctx context.Context, exchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error)
+	SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error)
+	UpdateExchangeWithParticipants(ctx context.Context, exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error)
+	SelectExchangeList(ctx context.Context, query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.ExchangeInfo, *models.Keyset, *models.Total, error)
+
+	// MESSAGE
+	InsertExchangeMessage(ctx context.Context, message *models.ExchangeMessage) (*models.ExchangeMessage, error)
+	SelectExchangeMessages(ctx context.Context, exchangeId string, cursor *string, limit int64) ([]models.ExchangeMessage, *string, error)
+
+	// REVIEW
+	InsertReview(ctx context.Context, review *models.Review) (*models.Review, error)
+	SelectReviewsByUserId(ctx context.Context, userId string, cursor *string, limit int64) ([]models.Review, *string, error)
+	SelectUserRating(ctx context.Context, userId string) (*models.UserRating, error)
+
+	// BLOCK
+	InsertUserReport(ctx context.Context, report *models.UserReport) (*models.UserReport, error)
+	InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error
+	DeleteUserBlock(ctx context.Context, userId string, blockedUserId string) error
+	HasUserBlock(ctx context.Context, userId1 string, userId2 string) (bool, error)
 
 	// USER
-	SelectUserById(user *models.User) (*models.User, error)
-	SelectUserByEmail(user *models.User) (*models.User, error)
-	CreateUser(user *models.User) (*models.User, error)
+	SelectUserById(ctx context.Context, user *models.User) (*models.User, error)
+	SelectUserByEmail(ctx context.Context, user *models.User) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
+	UpdateUserLocation(ctx context.Context, userId string, location *models.Location) (*models.User, error)
+
+	// EVENTS
+	ListenEvents(ctx context.Context, handler func(models.Event)) error
+
+	// METRICS
+	PoolStats() models.PoolStats
+}
+
+// BlobStore хранит загруженные файлы по ключу, общему для всех инстансов сервиса
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// models.ErrFileNotFound, если файла нет
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL - ссылка на скачивание, действующая ttl
+	SignedURL(key string, ttl time.Duration) string
 }
 
 type Application struct {
 	Cnf *config.Config
 	Storage Storage
+	Blobs BlobStore
 	Log *slog.Logger
 	Validator *validator.Validate
+	Events *events.Hub
 	//wg     sync.WaitGroup //updated
 }
\ No newline at end of file
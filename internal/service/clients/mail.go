@@ -4,6 +4,7 @@ import (
 	"service/internal/models"
 	"service/internal/service"
 
+	"context"
 	"net/smtp"
 	"fmt"
 	"log/slog"
@@ -14,8 +15,11 @@ func SendEmailToSingleParticipant(app *service.Application, srcUserId string, ds
 	const maxRetries = 3
 	const retryDelay = 2 * time.Second
 
+	// письмо уходит уже после ответа клиенту, поэтому контекст запроса здесь не используется
+	ctx := context.Background()
+
 	// Получаем данные пользователя
-	dbSrcUser, err := app.Storage.SelectUserById(&models.User{UserId: srcUserId})
+	dbSrcUser, err := app.Storage.SelectUserById(ctx, &models.User{UserId: srcUserId})
 	if err != nil || dbSrcUser == nil {
 		app.Log.Error("Failed to get user email", 
 			slog.String("user_id", srcUserId), 
@@ -23,7 +27,7 @@ func SendEmailToSingleParticipant(app *service.Application, srcUserId string, ds
 		return
 	}
 
-	dbDstUser, err := app.Storage.SelectUserById(&models.User{UserId: dstUserId})
+	dbDstUser, err := app.Storage.SelectUserById(ctx, &models.User{UserId: dstUserId})
 	if err != nil || dbDstUser == nil {
 		app.Log.Error("Failed to get user email", 
 			slog.String("user_id", dstUserId), 
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"service/internal/models"
+
+	"sync"
+)
+
+const (
+	kSubscriberBuffer = 16
+)
+
+// Hub раздает события подписчикам конкретного пользователя.
+// Медленный подписчик не блокирует остальных: если его буфер заполнен, событие для него пропускается.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan models.Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[chan models.Event]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe(userId string) (<-chan models.Event, func()) {
+	ch := make(chan models.Event, kSubscriberBuffer)
+
+	h.mu.Lock()
+	if _, ok := h.subscribers[userId]; !ok {
+		h.subscribers[userId] = make(map[chan models.Event]struct{})
+	}
+	h.subscribers[userId][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			delete(h.subscribers[userId], ch)
+			if len(h.subscribers[userId]) == 0 {
+				delete(h.subscribers, userId)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (h *Hub) Publish(event models.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userId := range event.UserIds {
+		for ch := range h.subscribers[userId] {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
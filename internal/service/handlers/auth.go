@@ -42,7 +42,7 @@ func Register(app *service.Application) fiber.Handler {
 			Email: req.Body.Email,
 		}
 
-		dbUser, err := app.Storage.CreateUser(&user)
+		dbUser, err := app.Storage.CreateUser(context.UserContext(), &user)
 
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
@@ -84,7 +84,7 @@ func Login(app *service.Application) fiber.Handler {
 			Email: req.Body.Email,
 		}
 
-		dbUser, err := app.Storage.SelectUserByEmail(&user)
+		dbUser, err := app.Storage.SelectUserByEmail(context.UserContext(), &user)
 
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+	"service/internal/utils"
+)
+
+// decodeIdCursor возвращает id из курсора списка без выбора сортировки
+func decodeIdCursor(app *service.Application, raw *string, queryHash string) (*string, error) {
+	cursor, err := utils.Decode(app.Cnf.Server.CursorSecret, raw)
+	if err != nil || cursor == nil {
+		return nil, err
+	}
+
+	if err := cursor.Verify(queryHash, "", false); err != nil {
+		return nil, err
+	}
+
+	return &cursor.Id, nil
+}
+
+func encodeIdCursor(app *service.Application, id *string, queryHash string) (*string) {
+	if id == nil {
+		return nil
+	}
+
+	return utils.Encode(app.Cnf.Server.CursorSecret, &utils.Cursor{
+		Id: *id,
+		QueryHash: queryHash,
+	})
+}
+
+func decodeKeysetCursor(app *service.Application, raw *string, queryHash string, sort string, desc bool) (*models.Keyset, error) {
+	cursor, err := utils.Decode(app.Cnf.Server.CursorSecret, raw)
+	if err != nil || cursor == nil {
+		return nil, err
+	}
+
+	if err := cursor.Verify(queryHash, sort, desc); err != nil {
+		return nil, err
+	}
+
+	return &models.Keyset{Value: cursor.Value, Id: cursor.Id}, nil
+}
+
+func encodeKeysetCursor(app *service.Application, keyset *models.Keyset, queryHash string, sort string, desc bool) (*string) {
+	if keyset == nil {
+		return nil
+	}
+
+	return utils.Encode(app.Cnf.Server.CursorSecret, &utils.Cursor{
+		Sort: sort,
+		Desc: desc,
+		Value: keyset.Value,
+		Id: keyset.Id,
+		QueryHash: queryHash,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/parsers"
+	"service/internal/service"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	kEventsKeepAlive = 15 * time.Second
+)
+
+// StreamEvents отдает события обменов пользователя через Server-Sent Events
+func StreamEvents(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestEvents
+
+		if err := parsers.ParseEvents(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start GET v1/events", slog.Any("request", req))
+
+		context.Set(fiber.HeaderContentType, "text/event-stream")
+		context.Set(fiber.HeaderCacheControl, "no-cache")
+		context.Set(fiber.HeaderConnection, "keep-alive")
+		context.Set("X-Accel-Buffering", "no")
+
+		events, unsubscribe := app.Events.Subscribe(req.UserId)
+
+		context.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer unsubscribe()
+
+			ticker := time.NewTicker(kEventsKeepAlive)
+			defer ticker.Stop()
+
+			fmt.Fprint(w, ": connected\n\n")
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			for {
+				select {
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+
+					data, err := json.Marshal(event)
+					if err != nil {
+						app.Log.Error("Failed to marshal event", slog.Any("error", err))
+						continue
+					}
+
+					fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+				case <-ticker.C:
+					fmt.Fprint(w, ": ping\n\n")
+				}
+
+				// ошибка записи означает, что клиент отключился
+				if err := w.Flush(); err != nil {
+					app.Log.Info("Events stream closed", slog.String("user_id", req.UserId))
+					return
+				}
+			}
+		}))
+
+		return nil
+	}
+}
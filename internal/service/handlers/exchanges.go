@@ -7,13 +7,15 @@ import (
 	"service/internal/utils"
 	"service/internal/service/clients"
 
+	"context"
+	"errors"
 	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func isValidToyUser(app *service.Application, toyUser *models.UserIdToyId) (bool) {
-	toy, err := app.Storage.SelectToyByUserId(toyUser.ToyId, toyUser.UserId)
+func isValidToyUser(ctx context.Context, app *service.Application, toyUser *models.UserIdToyId) (bool) {
+	toy, err := app.Storage.SelectToyByUserId(ctx, toyUser.ToyId, toyUser.UserId)
 
 	if err != nil || toy == nil {
 		app.Log.Info("toy is not exist")
@@ -33,10 +35,13 @@ func isOtherUsers(userId1 string, userId2 string) (bool) {
 }
 
 func getDetailsInfo(detail *models.ExchangeParticipant) (models.ExchangeDetailsInfo) {
-	user := models.UserName{
-		FirstName: detail.FirstName,
-		LastName: detail.LastName,
-		MiddleName: detail.MiddleName,
+	user := models.UserInfo{
+		UserName: models.UserName{
+			FirstName: detail.FirstName,
+			LastName: detail.LastName,
+			MiddleName: detail.MiddleName,
+		},
+		Rating: detail.UserRating,
 	}
 
 	toy := models.ToyInfo{
@@ -44,13 +49,14 @@ func getDetailsInfo(detail *models.ExchangeParticipant) (models.ExchangeDetailsI
 		UserId: detail.UserId,
 		Name: detail.ToyName,
 		Description: detail.ToyDescription,
-		PhotoUrl: detail.ToyPhotoURL,
+		Photos: detail.ToyPhotos,
 	}
 
 	return models.ExchangeDetailsInfo{
 		User: user,
 		Toy: toy,
 		Status: detail.UserExchangeStatus,
+		Distance: detail.ToyDistance,
 	}
 }
 
@@ -83,8 +89,8 @@ func CreateExchange(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start POST v1/exchange", slog.Any("request", req))
 
-        isValid := isValidToyUser(app, &req.Body.UserToy1) && 
-                   isValidToyUser(app, &req.Body.UserToy2) &&
+        isValid := isValidToyUser(context.UserContext(), app, &req.Body.UserToy1) && 
+                   isValidToyUser(context.UserContext(), app, &req.Body.UserToy2) &&
                    (hasUserExchange(req.UserId, req.Body.UserToy1.UserId) || 
                     hasUserExchange(req.UserId, req.Body.UserToy2.UserId)) &&
                    isOtherUsers(req.Body.UserToy1.UserId, req.Body.UserToy2.UserId)
@@ -96,6 +102,21 @@ func CreateExchange(app *service.Application) fiber.Handler {
                     Message: "toy is not exist or user is not initial exchange or user do not exchange with self"})
         }
 
+		blocked, err := app.Storage.HasUserBlock(context.UserContext(), req.Body.UserToy1.UserId, req.Body.UserToy2.UserId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateExchange,
+					Message: err.Error()})
+		}
+
+		if blocked {
+			return context.Status(fiber.StatusForbidden).JSON(
+				models.ResponseError{
+					Code: models.KUserBlocked,
+					Message: "exchange between blocked users is not allowed"})
+		}
+
 		exchangeDetails := []models.ExchangeDetails {
 			models.ExchangeDetails{
 				ToyId: req.Body.UserToy1.ToyId,
@@ -113,7 +134,14 @@ func CreateExchange(app *service.Application) fiber.Handler {
 			IdempotencyToken: req.IdempotencyToken,
 		}
 
-		dbExchange, err := app.Storage.InsertExchange(&exchange, exchangeDetails)
+		dbExchange, err := app.Storage.InsertExchange(context.UserContext(), &exchange, exchangeDetails)
+		if errors.Is(err, models.ErrExchangeExists) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KExistExchange,
+					Message: "exchange for these toys is already in progress"})
+		}
+
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -139,7 +167,7 @@ func GetExchange(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start GET v1/exchange", slog.Any("request", req))
 
-		dbExchange, err := app.Storage.SelectExchangeWithParticipants(req.ExchangeId)
+		dbExchange, err := app.Storage.SelectExchangeWithParticipants(context.UserContext(), req.ExchangeId)
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -147,7 +175,7 @@ func GetExchange(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		if dbExchange == nil {
+		if len(dbExchange) == 0 {
 			return context.Status(fiber.StatusNotFound).JSON(
 				models.ResponseError{
 					Code: models.KExchangeNotFound,
@@ -156,7 +184,7 @@ func GetExchange(app *service.Application) fiber.Handler {
 
 		return context.Status(fiber.StatusOK).JSON(
 			models.ResponseExchangeGet{
-				Exchange: getExchange(dbExchange)})
+				Exchange: *signExchange(app, getExchange(dbExchange))})
 	}
 }
 
@@ -174,7 +202,14 @@ func PatchExchange(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start PATCH v1/exchange", slog.Any("request", req))
 
-		dbExchange, err := app.Storage.UpdateExchangeWithParticipants(req.ExchangeId, req.UserId, req.Body.Status)
+		dbExchange, err := app.Storage.UpdateExchangeWithParticipants(context.UserContext(), req.ExchangeId, req.UserId, req.Body.Status)
+		if errors.Is(err, models.ErrExchangeConflict) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KExchangeConflict,
+					Message: "exchange is changed by another request, try again"})
+		}
+
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -182,26 +217,14 @@ func PatchExchange(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		if dbExchange == nil {
+		if len(dbExchange) == 0 {
 			return context.Status(fiber.StatusNotFound).JSON(
 				models.ResponseError{
 					Code: models.KExchangeNotFound,
 					Message: "exchange not found"})
 		}
 
-		details := make([]models.ExchangeDetailsInfo, 0, len(dbExchange))
-		for _, dbDetails := range(dbExchange) {
-			details = append(details, getDetailsInfo(&dbDetails))
-		}
-
-		exchange := models.ExchangeInfo{
-			ExchangeId: dbExchange[0].ExchangeId,
-			Details: details,
-			IdempotencyToken: dbExchange[0].IdempotencyToken,
-			Status: dbExchange[0].ExchangeStatus,
-			CreatedAt: dbExchange[0].ExchangeCreatedAt,
-			UpdatedAt: dbExchange[0].ExchangeUpdatedAt,
-		}
+		exchange := getExchange(dbExchange)
 
 		if exchange.Status == models.KConfirmExchangeStatus {
 			go clients.SendEmailToSingleParticipant(app, exchange.Details[0].Toy.UserId, exchange.Details[1].Toy.UserId)
@@ -211,7 +234,7 @@ func PatchExchange(app *service.Application) fiber.Handler {
 
 		return context.Status(fiber.StatusOK).JSON(
 			models.ResponseExchangePatch{
-				Exchange: exchange})
+				Exchange: *signExchange(app, exchange)})
 	}
 }
 
@@ -226,7 +249,11 @@ func GetExchangeList(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		cursor, err := utils.Decode(req.Body.Cursor)
+		sort := req.Body.Sort
+		desc := sort.Direction == models.KSortDesc
+		queryHash := utils.QueryHash(req.UserId, req.Body.Query, sort)
+
+		cursor, err := decodeKeysetCursor(app, req.Body.Cursor, queryHash, sort.Field, desc)
 		if err != nil {
 			return context.Status(fiber.StatusBadRequest).JSON(
 				models.ResponseError{
@@ -234,9 +261,9 @@ func GetExchangeList(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		app.Log.Info("Start POST v1/exchange/list", slog.Any("request", req), slog.Any("dd", req.Body.Query.Statuses))
+		app.Log.Info("Start POST v1/exchange/list", slog.Any("request", req))
 
-		dbExchanges, cursor, err := app.Storage.SelectExchangeList(&req.Body.Query, req.UserId, cursor, *req.Body.Limit)
+		exchanges, nextCursor, total, err := app.Storage.SelectExchangeList(context.UserContext(), &req.Body.Query, req.UserId, sort, cursor, *req.Body.Limit, req.Body.WithTotal)
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -244,26 +271,10 @@ func GetExchangeList(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		if cursor != nil {
-			cursor = utils.Encode(cursor)
-		}
-
-		detailsByExhangeId := make(map[string]([]models.ExchangeParticipant), len(dbExchanges))
-		for _, dbDetails := range(dbExchanges) {
-			if _, ok := detailsByExhangeId[dbDetails.ExchangeId]; !ok {
-				detailsByExhangeId[dbDetails.ExchangeId] = make([]models.ExchangeParticipant, 0)
-			}
-			detailsByExhangeId[dbDetails.ExchangeId] = append(detailsByExhangeId[dbDetails.ExchangeId], dbDetails)
-		}
-
-		exchanges := make([]models.ExchangeInfo, 0, len(detailsByExhangeId))
-		for _, exchange := range(detailsByExhangeId) {
-			exchanges = append(exchanges, getExchange(exchange))
-		}
-
 		return context.Status(fiber.StatusOK).JSON(
 			models.ResponseExchangeList{
-				Exchanges: exchanges,
-				Cursor: cursor})
+				Exchanges: signExchanges(app, exchanges),
+				Cursor: encodeKeysetCursor(app, nextCursor, queryHash, sort.Field, desc),
+				Total: total})
 	}
 }
\ No newline at end of file
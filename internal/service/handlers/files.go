@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+	"service/internal/utils"
+
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	kExpires = "expires"
+	kSignature = "signature"
+)
+
+// signPhotos заменяет ключи фотографий на ссылки для скачивания с ограниченным сроком
+func signPhotos(app *service.Application, photos []models.ToyPhoto) ([]models.ToyPhoto) {
+	for i := range photos {
+		photo := &photos[i].PhotoSet
+		photo.Thumbnail = app.Blobs.SignedURL(photo.Thumbnail, app.Cnf.Blob.UrlTTL)
+		photo.Medium = app.Blobs.SignedURL(photo.Medium, app.Cnf.Blob.UrlTTL)
+		photo.Full = app.Blobs.SignedURL(photo.Full, app.Cnf.Blob.UrlTTL)
+	}
+
+	return photos
+}
+
+func signToy(app *service.Application, toy *models.Toy) (*models.Toy) {
+	signPhotos(app, toy.Photos)
+
+	return toy
+}
+
+func signToys(app *service.Application, toys []models.Toy) ([]models.Toy) {
+	for i := range toys {
+		signToy(app, &toys[i])
+	}
+
+	return toys
+}
+
+func signExchange(app *service.Application, exchange models.ExchangeInfo) (*models.ExchangeInfo) {
+	for i := range exchange.Details {
+		signPhotos(app, exchange.Details[i].Toy.Photos)
+	}
+
+	return &exchange
+}
+
+func signExchanges(app *service.Application, exchanges []models.ExchangeInfo) ([]models.ExchangeInfo) {
+	for i := range exchanges {
+		signExchange(app, exchanges[i])
+	}
+
+	return exchanges
+}
+
+// GetFile отдает файл из BlobStore по ссылке из Local.SignedURL.
+// Доступ проверяется подписью, а не заголовками: ссылки открываются прямо из <img>
+func GetFile(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		key := context.Params("*")
+
+		err := utils.VerifyKey(
+			app.Cnf.Blob.Local.SignSecret,
+			key,
+			context.Query(kExpires),
+			context.Query(kSignature),
+		)
+		if err != nil {
+			return context.Status(fiber.StatusForbidden).JSON(
+				models.ResponseError{
+					Code: models.KInvalidFileSignature,
+					Message: err.Error()})
+		}
+
+		file, err := app.Blobs.Get(context.UserContext(), key)
+		if errors.Is(err, models.ErrFileNotFound) {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KFileNotFound,
+					Message: "File is not exist"})
+		}
+
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidGetFile,
+					Message: err.Error()})
+		}
+
+		// содержимое по ключу не меняется, кэшировать можно не меньше срока ссылки
+		context.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(app.Cnf.Blob.UrlTTL.Seconds())))
+		context.Type(filepath.Ext(key))
+
+		return context.SendStream(file)
+	}
+}
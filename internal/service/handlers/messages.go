@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/parsers"
+	"service/internal/service"
+	"service/internal/utils"
+
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// чужую переписку не раскрываем: для не-участника обмен как будто не существует
+func isExchangeParticipant(participants []models.ExchangeParticipant, userId string) (bool) {
+	for _, participant := range participants {
+		if participant.UserId == userId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func CreateExchangeMessage(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestExchangeMessagePost
+
+		if err := parsers.ParseExchangeMessagePost(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/exchange/messages", slog.Any("request", req))
+
+		dbExchange, err := app.Storage.SelectExchangeWithParticipants(context.UserContext(), req.ExchangeId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateMessage,
+					Message: err.Error()})
+		}
+
+		if !isExchangeParticipant(dbExchange, req.UserId) {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KExchangeNotFound,
+					Message: "exchange not found"})
+		}
+
+		message := models.ExchangeMessage{
+			ExchangeId: req.ExchangeId,
+			UserId: req.UserId,
+			Text: req.Body.Text,
+			IdempotencyToken: req.IdempotencyToken,
+		}
+
+		dbMessage, err := app.Storage.InsertExchangeMessage(context.UserContext(), &message)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateMessage,
+					Message: err.Error()})
+		}
+
+		return context.Status(fiber.StatusCreated).
+				JSON(models.ResponseExchangeMessagePost{Message: *dbMessage})
+	}
+}
+
+func GetExchangeMessages(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestExchangeMessageList
+
+		if err := parsers.ParseExchangeMessageList(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		queryHash := utils.QueryHash(req.UserId, req.ExchangeId)
+
+		cursor, err := decodeIdCursor(app, req.Query.Cursor, queryHash)
+		if err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCursor,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start GET v1/exchange/messages", slog.Any("request", req))
+
+		dbExchange, err := app.Storage.SelectExchangeWithParticipants(context.UserContext(), req.ExchangeId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidMessageList,
+					Message: err.Error()})
+		}
+
+		if !isExchangeParticipant(dbExchange, req.UserId) {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KExchangeNotFound,
+					Message: "exchange not found"})
+		}
+
+		dbMessages, cursor, err := app.Storage.SelectExchangeMessages(context.UserContext(), req.ExchangeId, cursor, *req.Query.Limit)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidMessageList,
+					Message: err.Error()})
+		}
+
+		cursor = encodeIdCursor(app, cursor, queryHash)
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseExchangeMessageList{
+				Messages: dbMessages,
+				Cursor: cursor})
+	}
+}
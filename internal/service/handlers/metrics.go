@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetPoolStats - состояние пула соединений с базой для мониторинга
+func GetPoolStats(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		return context.Status(fiber.StatusOK).JSON(app.Storage.PoolStats())
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/parsers"
+	"service/internal/service"
+
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getNewPhotos - фотографии для добавления вместе с созданием или изменением игрушки
+func getNewPhotos(photo *models.PhotoSet) ([]models.ToyPhoto) {
+	if photo == nil {
+		return nil
+	}
+
+	return []models.ToyPhoto{{PhotoSet: *photo}}
+}
+
+// isSamePhotos проверяет, что photoIds - перестановка текущих фотографий игрушки
+func isSamePhotos(photos []models.ToyPhoto, photoIds []string) (bool) {
+	if len(photos) != len(photoIds) {
+		return false
+	}
+
+	ids := make(map[string]struct{}, len(photos))
+	for _, photo := range photos {
+		ids[photo.PhotoId] = struct{}{}
+	}
+
+	for _, photoId := range photoIds {
+		if _, ok := ids[photoId]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func AddToyPhoto(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestToyPhotoPost
+
+		if err := parsers.ParseToyPhotoPost(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/toys/photos", slog.Any("request", req))
+
+		toy, err := app.Storage.SelectToyByUserId(context.UserContext(), req.ToyId, req.UserId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidAddPhoto,
+					Message: err.Error()})
+		}
+
+		if toy == nil || toy.Status == models.KRemovedToyStatus {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KToyNotFound,
+					Message: "Toy is not exist"})
+		}
+
+		// фотографии меняются только у игрушки, которая не участвует в обмене
+		if toy.Status != models.KCreatedToyStatus {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: "Toy photos can be changed only in status created"})
+		}
+
+		// до обработки файла, чтобы не сохранять лишнее
+		if len(toy.Photos) >= models.KMaxToyPhotos {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KTooManyPhotos,
+					Message: "Photo limit reached"})
+		}
+
+		photo, err := savePhoto(&req, app, context)
+		if err != nil {
+			return context.Status(getPhotoErrorStatus(err)).JSON(
+				models.ResponseError{
+					Code: models.KErrorSaveFile,
+					Message: err.Error()})
+		}
+
+		photos, err := app.Storage.InsertToyPhoto(context.UserContext(), req.ToyId, req.UserId, photo)
+		if errors.Is(err, models.ErrToyNotEditable) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: err.Error()})
+		}
+
+		if errors.Is(err, models.ErrTooManyPhotos) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KTooManyPhotos,
+					Message: err.Error()})
+		}
+
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidAddPhoto,
+					Message: err.Error()})
+		}
+
+		if photos == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KToyNotFound,
+					Message: "Toy is not exist"})
+		}
+
+		return context.Status(fiber.StatusCreated).JSON(
+			models.ResponseToyPhotos{Photos: signPhotos(app, photos)})
+	}
+}
+
+func DeleteToyPhoto(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestToyPhotoDelete
+
+		if err := parsers.ParseToyPhotoDelete(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start DELETE v1/toys/photos", slog.Any("request", req))
+
+		photos, err := app.Storage.DeleteToyPhoto(context.UserContext(), req.ToyId, req.UserId, req.PhotoId)
+		if errors.Is(err, models.ErrToyNotEditable) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: err.Error()})
+		}
+
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidDeletePhoto,
+					Message: err.Error()})
+		}
+
+		if photos == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KPhotoNotFound,
+					Message: "Photo is not exist"})
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseToyPhotos{Photos: signPhotos(app, photos)})
+	}
+}
+
+func ReorderToyPhotos(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestToyPhotosOrder
+
+		if err := parsers.ParseToyPhotosOrder(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start PUT v1/toys/photos", slog.Any("request", req))
+
+		toy, err := app.Storage.SelectToyByUserId(context.UserContext(), req.ToyId, req.UserId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidOrderPhotos,
+					Message: err.Error()})
+		}
+
+		if toy == nil || toy.Status == models.KRemovedToyStatus {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KToyNotFound,
+					Message: "Toy is not exist"})
+		}
+
+		// фотографии меняются только у игрушки, которая не участвует в обмене
+		if toy.Status != models.KCreatedToyStatus {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: "Toy photos can be changed only in status created"})
+		}
+
+		if !isSamePhotos(toy.Photos, req.Body.PhotoIds) {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: "photo_ids must list every photo of the toy exactly once"})
+		}
+
+		photos, err := app.Storage.UpdateToyPhotosOrder(context.UserContext(), req.ToyId, req.UserId, req.Body.PhotoIds)
+		if errors.Is(err, models.ErrToyNotEditable) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: err.Error()})
+		}
+
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidOrderPhotos,
+					Message: err.Error()})
+		}
+
+		if photos == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KToyNotFound,
+					Message: "Toy is not exist"})
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseToyPhotos{Photos: signPhotos(app, photos)})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/parsers"
+	"service/internal/service"
+	"service/internal/utils"
+
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// возвращает второго участника обмена, если userId в нем участвует
+func getCounterpartyId(participants []models.ExchangeParticipant, userId string) (*string) {
+	if !isExchangeParticipant(participants, userId) {
+		return nil
+	}
+
+	for _, participant := range participants {
+		if participant.UserId != userId {
+			return &participant.UserId
+		}
+	}
+
+	return nil
+}
+
+func CreateReview(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestReviewPost
+
+		if err := parsers.ParseReviewPost(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/exchange/reviews", slog.Any("request", req))
+
+		dbExchange, err := app.Storage.SelectExchangeWithParticipants(context.UserContext(), req.ExchangeId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateReview,
+					Message: err.Error()})
+		}
+
+		counterpartyId := getCounterpartyId(dbExchange, req.UserId)
+		if counterpartyId == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KExchangeNotFound,
+					Message: "exchange not found"})
+		}
+
+		if dbExchange[0].ExchangeStatus != models.KSuccessExchangeStatus {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateReview,
+					Message: "exchange is not success"})
+		}
+
+		review := models.Review{
+			ExchangeId: req.ExchangeId,
+			ReviewerId: req.UserId,
+			UserId: *counterpartyId,
+			Rating: req.Body.Rating,
+			Comment: req.Body.Comment,
+		}
+
+		dbReview, err := app.Storage.InsertReview(context.UserContext(), &review)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCreateReview,
+					Message: err.Error()})
+		}
+
+		if dbReview == nil {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KExistReview,
+					Message: "review already exist"})
+		}
+
+		return context.Status(fiber.StatusCreated).
+				JSON(models.ResponseReviewPost{Review: *dbReview})
+	}
+}
+
+func GetUserReviews(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserReviews
+
+		if err := parsers.ParseUserReviews(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		queryHash := utils.QueryHash(req.TargetUserId)
+
+		cursor, err := decodeIdCursor(app, req.Query.Cursor, queryHash)
+		if err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCursor,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start GET v1/users/reviews", slog.Any("request", req))
+
+		dbReviews, cursor, err := app.Storage.SelectReviewsByUserId(context.UserContext(), req.TargetUserId, cursor, *req.Query.Limit)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidReviewList,
+					Message: err.Error()})
+		}
+
+		cursor = encodeIdCursor(app, cursor, queryHash)
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseUserReviews{
+				Reviews: dbReviews,
+				Cursor: cursor})
+	}
+}
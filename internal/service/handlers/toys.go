@@ -4,11 +4,12 @@ import (
 	"service/internal/models"
 	"service/internal/parsers"
 	"service/internal/service"
+	"service/internal/service/images"
 	"service/internal/utils"
 
+	"errors"
 	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 	"mime/multipart"
 
@@ -16,40 +17,81 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	kPhotosPrefix = "toys"
+)
+
 type RequestFile interface {
 	GetFile() *multipart.FileHeader
 }
 
-func saveFile[T RequestFile](req T, app *service.Application, context *fiber.Ctx) (*string, error) {
-	if req.GetFile() == nil {
+// savePhoto проверяет и перекодирует загруженную фотографию и сохраняет все ее варианты в BlobStore.
+// Возвращает ключи вариантов
+func savePhoto[T RequestFile](req T, app *service.Application, context *fiber.Ctx) (*models.PhotoSet, error) {
+	file := req.GetFile()
+	if file == nil {
 		return nil, nil
 	}
 
-	filename := fmt.Sprintf(
-		"%s_%s",
-		uuid.New().String(), 
-		strings.ReplaceAll(req.GetFile().Filename, " ", "_"),
-	)
-
-	path := fmt.Sprintf(
-		"%s/%s", 
-		app.Cnf.Server.Prefix_upload, 
-		filename,
-	)
-
-	photo_url := fmt.Sprintf(
-		"%s/%s", 
-		app.Cnf.Server.PhotoUrl, 
-		filename,
-	)
-
-	if err := context.SaveFile(req.GetFile(), path); err != nil {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	variants, err := images.Process(src, app.Cnf.Server.MaxUploadSize)
+	if err != nil {
+		return nil, err
+	}
+
+	photoId := uuid.New().String()
+	keys := make(map[string]string, len(variants))
+	uploadKeys := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		key := fmt.Sprintf("%s/%s_%s.jpg", kPhotosPrefix, photoId, variant.Name)
+
+		keys[variant.Name] = key
+		uploadKeys = append(uploadKeys, key)
+	}
+
+	// файлы регистрируются до загрузки: если игрушку потом не сохранить, их удалит сборщик
+	if err := app.Storage.InsertUploads(context.UserContext(), uploadKeys); err != nil {
 		return nil, err
 	}
 
-	app.Log.Info(fmt.Sprintf("Created file %s", path))
+	for _, variant := range variants {
+		key := keys[variant.Name]
+
+		if err := app.Blobs.Put(context.UserContext(), key, variant.Data, "image/jpeg"); err != nil {
+			return nil, err
+		}
+
+		app.Log.Info(fmt.Sprintf("Created file %s", key))
+	}
+
+	return &models.PhotoSet{
+		Thumbnail: keys[images.KThumbnail],
+		Medium: keys[images.KMedium],
+		Full: keys[images.KFull],
+	}, nil
+}
+
+func getPhotoErrorStatus(err error) (int) {
+	if errors.Is(err, images.ErrTooLarge) {
+		return fiber.StatusRequestEntityTooLarge
+	}
+
+	return fiber.StatusBadRequest
+}
+
+func getToyCondition(condition *string) (*models.ToyCondition) {
+	if condition == nil {
+		return nil
+	}
+
+	toyCondition := models.ToyCondition(*condition)
 
-	return &photo_url, nil
+	return &toyCondition
 }
 
 func CreateToy(app *service.Application) fiber.Handler {
@@ -65,7 +107,7 @@ func CreateToy(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start POST v1/toys", slog.Any("request", req))
 
-		dbToy, err := app.Storage.SelectToyByToken(req.IdempotencyToken)
+		dbToy, err := app.Storage.SelectToyByToken(context.UserContext(), req.IdempotencyToken, req.UserId)
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -75,12 +117,12 @@ func CreateToy(app *service.Application) fiber.Handler {
 
 		if dbToy != nil {
 			return context.Status(fiber.StatusCreated).
-				JSON(models.ReponseToyPost{Toy: *dbToy})
+				JSON(models.ReponseToyPost{Toy: *signToy(app, dbToy)})
 		}
 		
-		photoUrl, err := saveFile(&req, app, context)
+		photo, err := savePhoto(&req, app, context)
 		if err != nil {
-			return context.Status(fiber.StatusBadRequest).JSON(
+			return context.Status(getPhotoErrorStatus(err)).JSON(
 				models.ResponseError{
 					Code: models.KErrorSaveFile,
 					Message: err.Error()})
@@ -90,14 +132,27 @@ func CreateToy(app *service.Application) fiber.Handler {
 			Name: req.Toy.Name,
 			IdempotencyToken: req.IdempotencyToken,
 			Description: req.Toy.Description,
-			PhotoUrl: photoUrl,
+			Photos: getNewPhotos(photo),
 			UserId: req.UserId,
 			Status: models.KCreatedToyStatus,
+			CategoryId: req.Toy.CategoryId,
+			Tags: req.Toy.Tags,
+			AgeMin: req.Toy.AgeMin,
+			AgeMax: req.Toy.AgeMax,
+			Condition: getToyCondition(req.Toy.Condition),
+			Location: req.Toy.Location,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
 
-		dbToy, err = app.Storage.InsertToy(&toy)
+		dbToy, err = app.Storage.InsertToy(context.UserContext(), &toy)
+		if errors.Is(err, models.ErrToyExists) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KExistToy,
+					Message: err.Error()})
+		}
+
 		if err != nil {
 			return context.Status(fiber.StatusBadRequest).JSON(
 				models.ResponseError{
@@ -106,7 +161,7 @@ func CreateToy(app *service.Application) fiber.Handler {
 		}
 
 		return context.Status(fiber.StatusCreated).
-				JSON(models.ReponseToyPost{Toy: *dbToy})
+				JSON(models.ReponseToyPost{Toy: *signToy(app, dbToy)})
 	}
 }
 
@@ -123,9 +178,9 @@ func UpdateToy(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start PUT v1/toys", slog.Any("request", req))
 		
-		photoUrl, err := saveFile(&req, app, context)
+		photo, err := savePhoto(&req, app, context)
 		if err != nil {
-			return context.Status(fiber.StatusBadRequest).JSON(
+			return context.Status(getPhotoErrorStatus(err)).JSON(
 				models.ResponseError{
 					Code: models.KErrorSaveFile,
 					Message: err.Error()})
@@ -136,12 +191,30 @@ func UpdateToy(app *service.Application) fiber.Handler {
 			UserId: req.UserId,
 			Description: req.Toy.Description,
 			Name: req.Toy.Name,
+			CategoryId: req.Toy.CategoryId,
+			Tags: req.Toy.Tags,
+			AgeMin: req.Toy.AgeMin,
+			AgeMax: req.Toy.AgeMax,
+			Condition: getToyCondition(req.Toy.Condition),
+			Location: req.Toy.Location,
+			Photos: getNewPhotos(photo),
 		}
-		if photoUrl != nil {
-			toy.PhotoUrl = photoUrl
+
+		dbToy, err := app.Storage.UpdateToy(context.UserContext(), &toy)
+		if errors.Is(err, models.ErrTooManyPhotos) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KTooManyPhotos,
+					Message: err.Error()})
+		}
+
+		if errors.Is(err, models.ErrToyNotEditable) {
+			return context.Status(fiber.StatusConflict).JSON(
+				models.ResponseError{
+					Code: models.KToyNotEditable,
+					Message: err.Error()})
 		}
 
-		dbToy, err := app.Storage.UpdateToy(&toy)
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -157,7 +230,7 @@ func UpdateToy(app *service.Application) fiber.Handler {
 		}
 
 		return context.Status(fiber.StatusOK).
-				JSON(models.ResponseToyPut{Toy: *dbToy})
+				JSON(models.ResponseToyPut{Toy: *signToy(app, dbToy)})
 	}
 }
 
@@ -172,7 +245,11 @@ func GetToysList(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		cursor, err := utils.Decode(req.Body.Cursor)
+		sort := req.Body.Sort
+		desc := sort.Direction == models.KSortDesc
+		queryHash := utils.QueryHash(req.UserId, req.Body.Query, sort)
+
+		cursor, err := decodeKeysetCursor(app, req.Body.Cursor, queryHash, sort.Field, desc)
 		if err != nil {
 			return context.Status(fiber.StatusBadRequest).JSON(
 				models.ResponseError{
@@ -182,7 +259,7 @@ func GetToysList(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start POST v1/toys/list", slog.Any("request", req))
 
-		dbToys, cursor, err := app.Storage.SelectToysList(&req.Body.Query, cursor, *req.Body.Limit)
+		dbToys, nextCursor, total, err := app.Storage.SelectToysList(context.UserContext(), &req.Body.Query, req.UserId, sort, cursor, *req.Body.Limit, req.Body.WithTotal)
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
 				models.ResponseError{
@@ -190,14 +267,11 @@ func GetToysList(app *service.Application) fiber.Handler {
 					Message: err.Error()})
 		}
 
-		if cursor != nil {
-			cursor = utils.Encode(cursor)
-		}
-
 		return context.Status(fiber.StatusOK).JSON(
 			models.ResponseToysList{
-				Toys: dbToys,
-				Cursor: cursor})
+				Toys: signToys(app, dbToys),
+				Cursor: encodeKeysetCursor(app, nextCursor, queryHash, sort.Field, desc),
+				Total: total})
 	}
 }
 
@@ -216,7 +290,7 @@ func UpdateToyStatus(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start PATCH v1/toys", slog.Any("request", req))
 
-		dbToy, err := app.Storage.UpdateToyStatus(req.ToyId, req.UserId, models.ToyStatus(req.Body.Status))
+		dbToy, err := app.Storage.UpdateToyStatus(context.UserContext(), req.ToyId, req.UserId, models.ToyStatus(req.Body.Status))
 
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
@@ -235,7 +309,7 @@ func UpdateToyStatus(app *service.Application) fiber.Handler {
 		}
 
 		return context.Status(fiber.StatusOK).
-			JSON(models.ReponseToyPatch{Toy: *dbToy})
+			JSON(models.ReponseToyPatch{Toy: *signToy(app, dbToy)})
 	}
 }
 
@@ -252,7 +326,7 @@ func DeleteToy(app *service.Application) fiber.Handler {
 
 		app.Log.Info("Start DELETE v1/toys", slog.Any("request", req))
 
-		_, err := app.Storage.UpdateToyStatus(req.ToyId, req.UserId, models.KRemovedToyStatus)
+		_, err := app.Storage.UpdateToyStatus(context.UserContext(), req.ToyId, req.UserId, models.KRemovedToyStatus)
 
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
@@ -282,7 +356,7 @@ func GetToy(app *service.Application) fiber.Handler {
 		}
 
 		app.Log.Info("Start GET v1/toys", slog.Any("request", req))
-		toy, err := app.Storage.SelectToyById(req.ToyId)
+		toy, err := app.Storage.SelectToyById(context.UserContext(), req.ToyId)
 
 		if err != nil {
 			return context.Status(fiber.StatusInternalServerError).JSON(
@@ -301,6 +375,75 @@ func GetToy(app *service.Application) fiber.Handler {
 		}
 
 		return context.Status(fiber.StatusOK).JSON(
-			models.ReponseToyGet{Toy: *toy})
+			models.ReponseToyGet{Toy: *signToy(app, toy)})
 	}
 }
+
+
+// GetToyHistory - все владельцы игрушки и сделки, по которым она к ним переходила
+func GetToyHistory(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestToyGet
+
+		if err := parsers.ParseToyGet(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error(),
+				},
+			)
+		}
+
+		app.Log.Info("Start GET v1/toys/history", slog.Any("request", req))
+		toy, err := app.Storage.SelectToyById(context.UserContext(), req.ToyId)
+
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidToyHistory,
+					Message: err.Error(),
+				},
+			)
+		}
+
+		if toy == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KToyNotFound,
+					Message: "toy not found"})
+		}
+
+		history, err := app.Storage.SelectToyOwnershipHistory(context.UserContext(), req.ToyId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidToyHistory,
+					Message: err.Error(),
+				},
+			)
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseToyHistory{History: history})
+	}
+}
+
+
+func GetCategories(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		app.Log.Info("Start GET v1/categories")
+
+		categories, err := app.Storage.SelectCategories(context.UserContext())
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidCategories,
+					Message: err.Error(),
+				},
+			)
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseCategories{Categories: categories})
+	}
+}
\ No newline at end of file
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"service/internal/models"
+	"service/internal/parsers"
+	"service/internal/service"
+
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// в публичном профиле показываем только город, точные координаты не раскрываем
+func getUserCity(user *models.User) (*string) {
+	if user.Location == nil {
+		return nil
+	}
+
+	return user.Location.City
+}
+
+func GetUser(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserGet
+
+		if err := parsers.ParseUserGet(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start GET v1/users", slog.Any("request", req))
+
+		dbUser, err := app.Storage.SelectUserById(context.UserContext(), &models.User{UserId: req.TargetUserId})
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidGetUser,
+					Message: err.Error()})
+		}
+
+		if dbUser == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KUserNotFound,
+					Message: "user not found"})
+		}
+
+		rating, err := app.Storage.SelectUserRating(context.UserContext(), dbUser.UserId)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidGetUser,
+					Message: err.Error()})
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseUserGet{
+				User: models.UserProfile{
+					UserId: dbUser.UserId,
+					UserName: dbUser.UserName,
+					Rating: *rating,
+					City: getUserCity(dbUser),
+					CreatedAt: dbUser.CreatedAt,
+				}})
+	}
+}
+
+func ReportUser(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserReport
+
+		if err := parsers.ParseUserReport(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/users/report", slog.Any("request", req))
+
+		dbUser, err := app.Storage.SelectUserById(context.UserContext(), &models.User{UserId: req.TargetUserId})
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidReportUser,
+					Message: err.Error()})
+		}
+
+		if dbUser == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KUserNotFound,
+					Message: "user not found"})
+		}
+
+		report := models.UserReport{
+			ReporterId: req.UserId,
+			UserId: req.TargetUserId,
+			Reason: req.Body.Reason,
+		}
+
+		dbReport, err := app.Storage.InsertUserReport(context.UserContext(), &report)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidReportUser,
+					Message: err.Error()})
+		}
+
+		return context.Status(fiber.StatusCreated).JSON(
+			models.ResponseUserReport{Report: *dbReport})
+	}
+}
+
+func BlockUser(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserBlock
+
+		if err := parsers.ParseUserBlock(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/users/block", slog.Any("request", req))
+
+		dbUser, err := app.Storage.SelectUserById(context.UserContext(), &models.User{UserId: req.TargetUserId})
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidBlockUser,
+					Message: err.Error()})
+		}
+
+		if dbUser == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KUserNotFound,
+					Message: "user not found"})
+		}
+
+		if err := app.Storage.InsertUserBlock(context.UserContext(), req.UserId, req.TargetUserId); err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidBlockUser,
+					Message: err.Error()})
+		}
+
+		return context.SendStatus(fiber.StatusOK)
+	}
+}
+
+func UnblockUser(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserBlock
+
+		if err := parsers.ParseUserBlock(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start DELETE v1/users/block", slog.Any("request", req))
+
+		if err := app.Storage.DeleteUserBlock(context.UserContext(), req.UserId, req.TargetUserId); err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidBlockUser,
+					Message: err.Error()})
+		}
+
+		return context.SendStatus(fiber.StatusOK)
+	}
+}
+
+
+func UpdateUserLocation(app *service.Application) fiber.Handler {
+	return func(context *fiber.Ctx) error {
+		var req models.RequestUserLocation
+
+		if err := parsers.ParseUserLocation(&req, app, context); err != nil {
+			return context.Status(fiber.StatusBadRequest).JSON(
+				models.ResponseError{
+					Code: models.KInvalidArgument,
+					Message: err.Error()})
+		}
+
+		app.Log.Info("Start POST v1/users/location", slog.Any("request", req))
+
+		dbUser, err := app.Storage.UpdateUserLocation(context.UserContext(), req.UserId, &req.Body)
+		if err != nil {
+			return context.Status(fiber.StatusInternalServerError).JSON(
+				models.ResponseError{
+					Code: models.KInvalidUpdateLocation,
+					Message: err.Error()})
+		}
+
+		if dbUser == nil || dbUser.Location == nil {
+			return context.Status(fiber.StatusNotFound).JSON(
+				models.ResponseError{
+					Code: models.KUserNotFound,
+					Message: "user not found"})
+		}
+
+		return context.Status(fiber.StatusOK).JSON(
+			models.ResponseUserLocation{Location: *dbUser.Location})
+	}
+}
\ No newline at end of file
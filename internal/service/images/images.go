@@ -0,0 +1,123 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	KThumbnail = "thumbnail"
+	KMedium    = "medium"
+	KFull      = "full"
+
+	kJpegQuality = 85
+	// защита от "бомб": маленький файл с огромным разрешением
+	kMaxPixels = 50_000_000
+)
+
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("unsupported image type")
+)
+
+var kAllowedTypes = map[string]struct{}{
+	"image/jpeg": {},
+	"image/png":  {},
+	"image/gif":  {},
+	"image/webp": {},
+}
+
+// Variant - вариант фотографии, наибольшая сторона не больше MaxSide
+type Variant struct {
+	Name    string
+	MaxSide int
+}
+
+var kVariants = []Variant{
+	{Name: KThumbnail, MaxSide: 200},
+	{Name: KMedium, MaxSide: 800},
+	{Name: KFull, MaxSide: 2048},
+}
+
+type Encoded struct {
+	Name string
+	Data []byte
+}
+
+// Process проверяет загруженный файл по содержимому, а не по имени и заголовкам,
+// и перекодирует его в JPEG для каждого варианта. Метаданные (EXIF и т.п.) при перекодировании не переносятся.
+func Process(r io.Reader, maxSize int64) ([]Encoded, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	mime := mimetype.Detect(data)
+	if _, ok := kAllowedTypes[mime.String()]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mime.String())
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Width*config.Height > kMaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]Encoded, 0, len(kVariants))
+	for _, variant := range kVariants {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(src, variant.MaxSide), &jpeg.Options{Quality: kJpegQuality}); err != nil {
+			return nil, err
+		}
+
+		encoded = append(encoded, Encoded{Name: variant.Name, Data: buf.Bytes()})
+	}
+
+	return encoded, nil
+}
+
+// resize уменьшает изображение с сохранением пропорций, не увеличивая маленькие.
+// Прозрачные области заливаются белым, так как в JPEG нет альфа-канала
+func resize(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			height = max(1, height*maxSide/width)
+			width = maxSide
+		} else {
+			width = max(1, width*maxSide/height)
+			height = maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	return dst
+}
@@ -25,14 +25,16 @@ func AuthMiddleware(app *service.Application) fiber.Handler {
         }
         
 
-        user, err := app.Storage.SelectUserById(&models.User{UserId: userId})
+        user, err := app.Storage.SelectUserById(c.UserContext(), &models.User{UserId: userId})
         if err != nil || user == nil {
             return c.Status(fiber.StatusUnauthorized).JSON(models.ResponseError{
                 Code:    models.KUnauthorized,
                 Message: "invalid user_id",
             })
         }
-        
+
+        c.SetUserContext(service.WithUserId(c.UserContext(), userId))
+
         return c.Next()
     }
 }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// как часто проверяется, не отключился ли клиент
+	kDisconnectCheckInterval = 200 * time.Millisecond
+)
+
+// RequestContext задает запросу свой UserContext, который отменяется, когда клиент отключился,
+// запрос обработан или сервер останавливается (Shutdown), - запросы к хранилищу, начатые в обработчике,
+// не переживают запрос. fasthttp не читает соединение, пока работает обработчик, поэтому отключение
+// проверяется раз в kDisconnectCheckInterval по самому сокету (см. peerClosed). Для соединений без сокета
+// (TLS, app.Test) отключение не определяется, и запросы к базе ограничены таймаутом хранилища
+func RequestContext() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// канал и соединение берутся здесь: RequestCtx переиспользуется fasthttp после ответа,
+		// обращаться к нему из горутины нельзя
+		shutdown := c.Context().Done()
+		closed := peerClosed(c.Context().Conn())
+
+		go func() {
+			var check <-chan time.Time
+			if closed != nil {
+				ticker := time.NewTicker(kDisconnectCheckInterval)
+				defer ticker.Stop()
+				check = ticker.C
+			}
+
+			for {
+				select {
+				case <-shutdown:
+					cancel()
+					return
+				case <-ctx.Done():
+					return
+				case <-check:
+					if closed() {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+
+		c.SetUserContext(ctx)
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,107 @@
+//go:build linux || darwin
+
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestRequestContextClientDisconnect - клиент закрыл соединение, пока работает обработчик:
+// UserContext отменяется до конца обработчика
+func TestRequestContextClientDisconnect(t *testing.T) {
+	started := make(chan struct{})
+	result := make(chan error, 1)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(RequestContext())
+	app.Get("/", func(c *fiber.Ctx) error {
+		close(started)
+
+		select {
+		case <-c.UserContext().Done():
+			result <- c.UserContext().Err()
+		case <-time.After(5 * time.Second):
+			result <- errors.New("context is not cancelled after the client disconnected")
+		}
+
+		return nil
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go app.Listener(listener)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler is not started")
+	}
+
+	conn.Close()
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("UserContext after disconnect: %v, want context.Canceled", err)
+	}
+}
+
+// TestRequestContextConnectedClient - пока клиент ждет ответа, UserContext не отменяется
+func TestRequestContextConnectedClient(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(RequestContext())
+	app.Get("/", func(c *fiber.Ctx) error {
+		select {
+		case <-c.UserContext().Done():
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		case <-time.After(3 * kDisconnectCheckInterval):
+			return c.SendStatus(fiber.StatusOK)
+		}
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go app.Listener(listener)
+	defer app.Shutdown()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	status := make([]byte, len("HTTP/1.1 200"))
+	if _, err := io.ReadFull(conn, status); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(status) != "HTTP/1.1 200" {
+		t.Errorf("response = %q, want 200", status)
+	}
+}
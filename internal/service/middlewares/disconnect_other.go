@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package middlewares
+
+import (
+	"net"
+)
+
+// peerClosed - на других платформах отключение клиента не определяется
+func peerClosed(conn net.Conn) func() bool {
+	return nil
+}
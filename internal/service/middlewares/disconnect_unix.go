@@ -0,0 +1,45 @@
+//go:build linux || darwin
+
+package middlewares
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerClosed возвращает проверку, закрыл ли клиент соединение, или nil, если у соединения нет сокета.
+// MSG_PEEK не забирает у fasthttp данные следующего запроса, MSG_DONTWAIT не ждет их:
+// 0 байт без ошибки - клиент закрыл соединение. Клиент, закрывший только запись (shutdown SHUT_WR)
+// и ждущий ответа, тоже считается отключившимся
+func peerClosed(conn net.Conn) func() bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	buf := make([]byte, 1)
+	return func() bool {
+		closed := false
+		err := raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			switch {
+			case err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR:
+			case err != nil:
+				// ECONNRESET и другие ошибки сокета
+				closed = true
+			default:
+				closed = n == 0
+			}
+
+			return true
+		})
+
+		// соединение уже закрыто сервером
+		return closed || err != nil
+	}
+}
@@ -0,0 +1,100 @@
+package uploads
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Reaper удаляет из BlobStore файлы, на которые дольше GracePeriod нет ссылок:
+// замененные и удаленные фотографии, а также файлы, загруженные для игрушки, которую не удалось сохранить
+type Reaper struct {
+	app *service.Application
+}
+
+func NewReaper(app *service.Application) *Reaper {
+	return &Reaper{app: app}
+}
+
+// Run запускает сборку раз в ReapInterval до отмены ctx
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.app.Cnf.Blob.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uploads, err := r.Reap(ctx, false)
+			if err != nil {
+				r.app.Log.Error("Uploads reaper failed", slog.Any("error", err))
+			}
+
+			if len(uploads) > 0 {
+				r.app.Log.Info(fmt.Sprintf("Uploads reaper deleted %d files", len(uploads)))
+			}
+		}
+	}
+}
+
+// Reap удаляет файлы без ссылок и возвращает удаленные. При dryRun ничего не удаляет,
+// а возвращает все файлы, которые были бы удалены
+func (r *Reaper) Reap(ctx context.Context, dryRun bool) ([]models.Upload, error) {
+	const op = "Reaper.Reap"
+
+	releasedBefore := time.Now().Add(-r.app.Cnf.Blob.GracePeriod)
+
+	if dryRun {
+		uploads, err := r.app.Storage.SelectOrphanUploads(ctx, releasedBefore, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return uploads, nil
+	}
+
+	batchSize := r.app.Cnf.Blob.ReapBatchSize
+	deleted := make([]models.Upload, 0)
+
+	for {
+		uploads, err := r.app.Storage.SelectOrphanUploads(ctx, releasedBefore, &batchSize)
+		if err != nil {
+			return deleted, fmt.Errorf("%s, %w", op, err)
+		}
+
+		for _, upload := range uploads {
+			// сначала запись, потом файл: запись удаляется, только если на файл по-прежнему нет ссылок,
+			// поэтому файл, на который сослались после выборки, останется
+			claimed, err := r.app.Storage.DeleteUpload(ctx, upload.Key)
+			if err != nil {
+				return deleted, fmt.Errorf("%s, %w", op, err)
+			}
+
+			if !claimed {
+				continue
+			}
+
+			// если удалить файл не получится, запись возвращается и файл удалится через GracePeriod
+			if err := r.app.Blobs.Delete(ctx, upload.Key); err != nil {
+				if err := r.app.Storage.InsertUploads(ctx, []string{upload.Key}); err != nil {
+					r.app.Log.Error("Failed to restore upload", slog.String("key", upload.Key), slog.Any("error", err))
+				}
+
+				return deleted, fmt.Errorf("%s, %w", op, err)
+			}
+
+			r.app.Log.Info(fmt.Sprintf("Deleted file %s", upload.Key))
+
+			deleted = append(deleted, upload)
+		}
+
+		if int64(len(uploads)) < batchSize {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package uploads
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+	"service/internal/service"
+	"service/internal/storage/blob"
+	"service/internal/storage/memory"
+	"service/internal/storage/storagetest"
+
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// brokenBlobs - BlobStore, у которого не удаляются файлы
+type brokenBlobs struct {
+	service.BlobStore
+}
+
+func (b *brokenBlobs) Delete(ctx context.Context, key string) error {
+	return errors.New("blob store is down")
+}
+
+// racingStorage ссылается на файл после выборки файлов без ссылок, как параллельный запрос
+type racingStorage struct {
+	service.Storage
+	afterSelect func()
+}
+
+func (r *racingStorage) SelectOrphanUploads(ctx context.Context, releasedBefore time.Time, limit *int64) ([]models.Upload, error) {
+	uploads, err := r.Storage.SelectOrphanUploads(ctx, releasedBefore, limit)
+	if r.afterSelect != nil {
+		r.afterSelect()
+		r.afterSelect = nil
+	}
+
+	return uploads, err
+}
+
+type fixture struct {
+	t       *testing.T
+	storage *memory.Memory
+	blobs   *blob.Local
+	app     *service.Application
+	owner   *models.User
+	toy     *models.Toy
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	cnf := &config.Config{
+		Blob: config.ConfigBlob{
+			// отрицательный GracePeriod: в сборку сразу попадают все освобожденные файлы
+			GracePeriod:   -time.Minute,
+			ReapBatchSize: 1,
+			Local:         config.ConfigBlobLocal{Dir: t.TempDir(), PublicUrl: "http://localhost/v1/files", SignSecret: "sign-secret"},
+		},
+	}
+
+	blobs, err := blob.NewLocal(&cnf.Blob.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := memory.New()
+	owner := storagetest.NewUser(t, storage)
+
+	return &fixture{
+		t:       t,
+		storage: storage,
+		blobs:   blobs,
+		app:     &service.Application{Cnf: cnf, Storage: storage, Blobs: blobs, Log: slog.New(slog.NewTextHandler(io.Discard, nil))},
+		owner:   owner,
+		toy:     storagetest.NewToy(t, storage, owner.UserId, "Мяч"),
+	}
+}
+
+// upload сохраняет файлы набора в BlobStore и в хранилище
+func (f *fixture) upload(prefix string) *models.PhotoSet {
+	f.t.Helper()
+
+	photo := &models.PhotoSet{Thumbnail: prefix + "_t", Medium: prefix + "_m", Full: prefix + "_f"}
+	for _, key := range photo.Keys() {
+		if err := f.blobs.Put(context.Background(), key, []byte(key), "image/jpeg"); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+
+	if err := f.storage.InsertUploads(context.Background(), photo.Keys()); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return photo
+}
+
+// attach делает набор фотографией игрушки
+func (f *fixture) attach(photo *models.PhotoSet) {
+	f.t.Helper()
+
+	if _, err := f.storage.InsertToyPhoto(context.Background(), f.toy.ToyId, f.owner.UserId, photo); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// exists - есть ли файл в BlobStore
+func (f *fixture) exists(key string) bool {
+	f.t.Helper()
+
+	file, err := f.blobs.Get(context.Background(), key)
+	if errors.Is(err, models.ErrFileNotFound) {
+		return false
+	}
+
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	file.Close()
+
+	return true
+}
+
+// orphans - ключи файлов без ссылок, оставшиеся в хранилище
+func (f *fixture) orphans() map[string]bool {
+	f.t.Helper()
+
+	uploads, err := f.storage.SelectOrphanUploads(context.Background(), time.Now().Add(time.Hour), nil)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	keys := make(map[string]bool)
+	for _, upload := range uploads {
+		keys[upload.Key] = true
+	}
+
+	return keys
+}
+
+func TestReap(t *testing.T) {
+	f := newFixture(t)
+	kept := f.upload("kept")
+	f.attach(kept)
+	orphan := f.upload("orphan")
+
+	deleted, err := NewReaper(f.app).Reap(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != len(orphan.Keys()) {
+		t.Errorf("Reap deleted %v, want %v", deleted, orphan.Keys())
+	}
+
+	for _, key := range orphan.Keys() {
+		if f.exists(key) {
+			t.Errorf("orphan file %s is not deleted", key)
+		}
+	}
+
+	for _, key := range kept.Keys() {
+		if !f.exists(key) {
+			t.Errorf("file %s of a photo is deleted", key)
+		}
+	}
+
+	if orphans := f.orphans(); len(orphans) != 0 {
+		t.Errorf("uploads %v are left after Reap", orphans)
+	}
+}
+
+func TestReapDryRun(t *testing.T) {
+	f := newFixture(t)
+	orphan := f.upload("orphan")
+
+	uploads, err := NewReaper(f.app).Reap(context.Background(), true)
+	if err != nil || len(uploads) != len(orphan.Keys()) {
+		t.Fatalf("Reap dry run = %v, %v, want %v", uploads, err, orphan.Keys())
+	}
+
+	for _, key := range orphan.Keys() {
+		if !f.exists(key) || !f.orphans()[key] {
+			t.Errorf("dry run deleted %s", key)
+		}
+	}
+}
+
+// TestReapRemovedToy - файлы фотографий удаленной игрушки освобождаются и удаляются
+func TestReapRemovedToy(t *testing.T) {
+	f := newFixture(t)
+	photo := f.upload("photo")
+	f.attach(photo)
+
+	if _, err := f.storage.UpdateToyStatus(context.Background(), f.toy.ToyId, f.owner.UserId, models.KRemovedToyStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReaper(f.app).Reap(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range photo.Keys() {
+		if f.exists(key) {
+			t.Errorf("file %s of a removed toy is not deleted", key)
+		}
+	}
+}
+
+// TestReapReferencedAfterSelect - на файл сослались между выборкой и удалением: файл остается
+func TestReapReferencedAfterSelect(t *testing.T) {
+	f := newFixture(t)
+	photo := f.upload("photo")
+	f.app.Storage = &racingStorage{Storage: f.storage, afterSelect: func() { f.attach(photo) }}
+
+	if _, err := NewReaper(f.app).Reap(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range photo.Keys() {
+		if !f.exists(key) {
+			t.Errorf("file %s referenced after select is deleted", key)
+		}
+	}
+}
+
+// TestReapBlobFailure - если файл не удалился, запись о нем возвращается для следующей попытки
+func TestReapBlobFailure(t *testing.T) {
+	f := newFixture(t)
+	orphan := f.upload("orphan")
+	f.app.Blobs = &brokenBlobs{BlobStore: f.blobs}
+
+	if _, err := NewReaper(f.app).Reap(context.Background(), false); err == nil {
+		t.Fatal("Reap succeeded with a failing blob store")
+	}
+
+	if orphans := f.orphans(); len(orphans) != len(orphan.Keys()) {
+		t.Errorf("uploads left for retry = %v, want %v", orphans, orphan.Keys())
+	}
+}
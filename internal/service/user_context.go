@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+)
+
+type userIdKey struct{}
+
+// WithUserId запоминает в контексте запроса авторизованного пользователя
+func WithUserId(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, userIdKey{}, userId)
+}
+
+// UserIdFromContext - пользователь, от имени которого выполняется запрос, false - запрос без авторизации
+func UserIdFromContext(ctx context.Context) (string, bool) {
+	userId, ok := ctx.Value(userIdKey{}).(string)
+	return userId, ok && userId != ""
+}
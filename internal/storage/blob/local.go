@@ -0,0 +1,127 @@
+package blob
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+	"service/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Local хранит файлы на диске и отдает их через /v1/files по подписанным ссылкам.
+// Подходит только для одного инстанса сервиса
+type Local struct {
+	cnf *config.ConfigBlobLocal
+}
+
+func NewLocal(cnf *config.ConfigBlobLocal) (*Local, error) {
+	const op = "BlobLocal.New"
+
+	// с пустым секретом подпись ссылки может подделать кто угодно
+	if cnf.SignSecret == "" {
+		return nil, fmt.Errorf("%s, sign_secret is required", op)
+	}
+
+	if err := os.MkdirAll(cnf.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &Local{cnf: cnf}, nil
+}
+
+// path не дает ключу выйти за пределы каталога
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+
+	return filepath.Join(l.cnf.Dir, clean), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	const op = "BlobLocal.Put"
+
+	path, err := l.path(key)
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	// через временный файл, чтобы по ссылке не отдался недописанный файл
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	const op = "BlobLocal.Get"
+
+	path, err := l.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, models.ErrFileNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return file, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	const op = "BlobLocal.Delete"
+
+	path, err := l.path(key)
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+func (l *Local) SignedURL(key string, ttl time.Duration) string {
+	expires, signature := utils.SignKey(l.cnf.SignSecret, key, time.Now().Add(ttl))
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", signature)
+
+	return fmt.Sprintf("%s/%s?%s", l.cnf.PublicUrl, (&url.URL{Path: key}).EscapedPath(), query.Encode())
+}
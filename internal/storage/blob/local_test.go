@@ -0,0 +1,13 @@
+package blob
+
+import (
+	"service/internal/config"
+
+	"testing"
+)
+
+func TestLocalRequiresSignSecret(t *testing.T) {
+	if _, err := NewLocal(&config.ConfigBlobLocal{Dir: t.TempDir()}); err == nil {
+		t.Fatal("NewLocal accepted an empty sign_secret")
+	}
+}
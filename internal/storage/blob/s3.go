@@ -0,0 +1,274 @@
+package blob
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kAlgorithm       = "AWS4-HMAC-SHA256"
+	kService         = "s3"
+	kUnsignedPayload = "UNSIGNED-PAYLOAD"
+	kAmzDateLayout   = "20060102T150405Z"
+	kDateLayout      = "20060102"
+	// больше S3 не принимает для подписанных ссылок
+	kMaxPresignTTL = 7 * 24 * time.Hour
+)
+
+// S3 работает с любым S3-совместимым хранилищем (AWS, MinIO и т.п.).
+// Запросы подписываются AWS Signature V4, ссылки на скачивание - presigned URL самого хранилища
+type S3 struct {
+	cnf      *config.ConfigBlobS3
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3(cnf *config.ConfigBlobS3) (*S3, error) {
+	const op = "BlobS3.New"
+
+	endpoint, err := url.Parse(cnf.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("%s, endpoint must be absolute: %q", op, cnf.Endpoint)
+	}
+
+	return &S3{
+		cnf:      cnf,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: cnf.Timeout},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+
+	if s.cnf.PathStyle {
+		u.Path = path + "/" + s.cnf.Bucket + "/" + key
+	} else {
+		u.Host = s.cnf.Bucket + "." + u.Host
+		u.Path = path + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method string, key string, body []byte, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+	now := s.now().UTC()
+	payloadHash := hexSha256(body)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(kAmzDateLayout),
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	signedHeaders, signature := s.sign(method, u, url.Values{}, headers, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		kAlgorithm, s.cnf.AccessKey, s.scope(now), signedHeaders, signature))
+
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	const op = "BlobS3.Put"
+
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s, %w", op, getResponseError(resp))
+	}
+
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	const op = "BlobS3.Get"
+
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, models.ErrFileNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("%s, %w", op, getResponseError(resp))
+	}
+
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	const op = "BlobS3.Delete"
+
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	// удаление отсутствующего объекта не ошибка
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+
+	return fmt.Errorf("%s, %w", op, getResponseError(resp))
+}
+
+// SignedURL - presigned GET, подписан только заголовок host
+func (s *S3) SignedURL(key string, ttl time.Duration) string {
+	u := s.objectURL(key)
+	now := s.now().UTC()
+	ttl = min(ttl, kMaxPresignTTL)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", kAlgorithm)
+	query.Set("X-Amz-Credential", s.cnf.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(kAmzDateLayout))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	_, signature := s.sign(http.MethodGet, u, query, map[string]string{"host": u.Host}, kUnsignedPayload, now)
+	u.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+
+	return u.String()
+}
+
+func (s *S3) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(kDateLayout), s.cnf.Region, kService, "aws4_request"}, "/")
+}
+
+// sign возвращает список подписанных заголовков и подпись запроса, headers - с именами в нижнем регистре
+func (s *S3) sign(method string, u *url.URL, query url.Values, headers map[string]string, payloadHash string, now time.Time) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		kAlgorithm,
+		now.Format(kAmzDateLayout),
+		s.scope(now),
+		hexSha256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.cnf.SecretKey), now.Format(kDateLayout))
+	key = hmacSha256(key, s.cnf.Region)
+	key = hmacSha256(key, kService)
+	key = hmacSha256(key, "aws4_request")
+
+	return signedHeaders, hex.EncodeToString(hmacSha256(key, stringToSign))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode кодирует все, кроме unreserved символов RFC 3986, как требует Signature V4
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return encoded.String()
+}
+
+func hexSha256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func getResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
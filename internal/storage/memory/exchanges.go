@@ -0,0 +1,663 @@
+package memory
+
+import (
+	"service/internal/domain/exchange"
+	"service/internal/models"
+	"service/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// kDetailsProgress - порядок продвижения участника. failed в enum стоит между created и confirm_1,
+// поэтому, как и в kWhereExchangeAwaitingUser, сравнивается позиция в этом списке
+var kDetailsProgress = []models.ExchangeDetailsStatus{
+	models.KCreatedExchangeDetailsStatus,
+	models.KConfirm1ExchangeDetailsStatus,
+	models.KConfirm2ExchangeDetailsStatus,
+	models.KSuccessExchangeDetailsStatus,
+}
+
+func detailsProgress(status models.ExchangeDetailsStatus) int {
+	for i, s := range kDetailsProgress {
+		if s == status {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isActiveExchange(status models.ExchangeStatus) bool {
+	return status == models.KCreatedExchangeStatus || status == models.KConfirmExchangeStatus
+}
+
+// exchangeTx реализует exchange.Tx над хранилищем, которое уже заблокировано вызывающим
+type exchangeTx struct {
+	m *Memory
+}
+
+// LockToys ничего не делает: все хранилище уже заблокировано
+func (t *exchangeTx) LockToys(toyIds []string) error {
+	return nil
+}
+
+func (t *exchangeTx) LockExchange(exchangeId string) (*models.Exchange, error) {
+	stored, ok := t.m.exchanges[exchangeId]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *stored
+	return &copied, nil
+}
+
+func (t *exchangeTx) SelectExchangeDetails(exchangeId string) ([]models.ExchangeDetails, error) {
+	return t.m.exchangeDetails(exchangeId), nil
+}
+
+func (t *exchangeTx) SelectOpenExchangeIds(toyIds []string) ([]string, error) {
+	seen := make(map[string]struct{})
+	exchangeIds := make([]string, 0)
+	for _, d := range t.m.details {
+		if !containsString(toyIds, d.ToyId) {
+			continue
+		}
+
+		if d.Status == models.KFailedExchangeDetailsStatus || d.Status == models.KSuccessExchangeDetailsStatus {
+			continue
+		}
+
+		if _, ok := seen[d.ExchangeId]; !ok {
+			seen[d.ExchangeId] = struct{}{}
+			exchangeIds = append(exchangeIds, d.ExchangeId)
+		}
+	}
+
+	sort.Strings(exchangeIds)
+	return exchangeIds, nil
+}
+
+func (t *exchangeTx) UpdateExchangeStatus(exchangeId string, status models.ExchangeStatus) error {
+	stored, ok := t.m.exchanges[exchangeId]
+	if !ok {
+		return nil
+	}
+
+	changed := stored.Status != status
+	stored.Status = status
+	stored.UpdatedAt = t.m.now()
+
+	if changed {
+		t.m.notify(models.Event{
+			Type:       models.KExchangeStatusEvent,
+			ExchangeId: exchangeId,
+			Status:     string(status),
+			UserIds:    t.m.participants(exchangeId),
+		})
+	}
+
+	return nil
+}
+
+func (t *exchangeTx) UpdateExchangeDetailsStatus(exchangeId string, userId string, status models.ExchangeDetailsStatus) error {
+	for _, d := range t.m.details {
+		if d.ExchangeId != exchangeId || d.UserId != userId {
+			continue
+		}
+
+		changed := d.Status != status
+		d.Status = status
+		d.UpdatedAt = t.m.now()
+
+		if changed {
+			t.m.notify(models.Event{
+				Type:       models.KExchangeDetailsStatusEvent,
+				ExchangeId: exchangeId,
+				UserId:     strPtr(userId),
+				Status:     string(status),
+				UserIds:    t.m.participants(exchangeId),
+			})
+		}
+	}
+
+	return nil
+}
+
+// TransferToy передает игрушку новому владельцу с его местоположением, игрушка снова доступна для обмена
+func (t *exchangeTx) TransferToy(toyId string, userId string, exchangeId string) error {
+	toy, ok := t.m.toys[toyId]
+	owner, found := t.m.users[userId]
+	if !ok || !found {
+		return nil
+	}
+
+	// токен переходит к новому владельцу вместе со строкой, как user_id в UNIQUE (user_id, idempotency_token)
+	delete(t.m.toyByToken, toyTokenKey{userId: toy.UserId, token: toy.IdempotencyToken})
+	t.m.toyByToken[toyTokenKey{userId: userId, token: toy.IdempotencyToken}] = toyId
+
+	toy.UserId = userId
+	toy.Location = copyLocation(owner.Location)
+	toy.Status = models.KCreatedToyStatus
+	toy.UpdatedAt = t.m.now()
+
+	t.m.releaseOwnership(toyId)
+	t.m.openOwnership(toyId, userId, strPtr(exchangeId))
+
+	return nil
+}
+
+// exchangeDetails - участники обмена в порядке user_id
+func (m *Memory) exchangeDetails(exchangeId string) []models.ExchangeDetails {
+	details := make([]models.ExchangeDetails, 0, 2)
+	for _, d := range m.details {
+		if d.ExchangeId == exchangeId {
+			details = append(details, *d)
+		}
+	}
+
+	sortSlice(details, func(a *models.ExchangeDetails, b *models.ExchangeDetails) bool { return a.UserId < b.UserId })
+	return details
+}
+
+// InsertExchange создает обмен и обоих участников. Повтор с тем же idempotency_token возвращает уже созданный обмен,
+// models.ErrExchangeExists - по этой паре игрушек уже есть незавершенная сделка
+func (m *Memory) InsertExchange(ctx context.Context, newExchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error) {
+	const op = "Memory.InsertExchange"
+
+	if newExchange.SrcToyId == newExchange.DstToyId {
+		return nil, fmt.Errorf("%s, %w", op, errors.New("exchange of a toy with itself"))
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	exchangeId, exists := m.exchangeByToken[newExchange.IdempotencyToken]
+	if !exists {
+		for _, other := range m.exchanges {
+			samePair := (other.SrcToyId == newExchange.SrcToyId && other.DstToyId == newExchange.DstToyId) ||
+				(other.SrcToyId == newExchange.DstToyId && other.DstToyId == newExchange.SrcToyId)
+
+			if samePair && isActiveExchange(other.Status) {
+				return nil, models.ErrExchangeExists
+			}
+		}
+
+		now := m.now()
+		stored := &models.Exchange{
+			ExchangeId:       newId(),
+			SrcToyId:         newExchange.SrcToyId,
+			DstToyId:         newExchange.DstToyId,
+			IdempotencyToken: newExchange.IdempotencyToken,
+			Status:           models.KCreatedExchangeStatus,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+
+		exchangeId = stored.ExchangeId
+		m.exchanges[exchangeId] = stored
+		m.exchangeByToken[stored.IdempotencyToken] = exchangeId
+	}
+
+	for _, details := range exchangeDetails {
+		m.insertExchangeDetails(exchangeId, details.ToyId, details.UserId)
+	}
+
+	copied := *m.exchanges[exchangeId]
+	return &copied, nil
+}
+
+// insertExchangeDetails добавляет участника, если его еще нет; получатель (игрушка dst_toy_id)
+// узнает о предложении из события, инициатору оно не отправляется
+func (m *Memory) insertExchangeDetails(exchangeId string, toyId string, userId string) {
+	for _, d := range m.details {
+		if d.ExchangeId == exchangeId && d.ToyId == toyId && d.UserId == userId {
+			return
+		}
+	}
+
+	now := m.now()
+	m.details = append(m.details, &models.ExchangeDetails{
+		ExchangeId: exchangeId,
+		ToyId:      toyId,
+		UserId:     userId,
+		Status:     models.KCreatedExchangeDetailsStatus,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+
+	if stored, ok := m.exchanges[exchangeId]; !ok || stored.DstToyId != toyId {
+		return
+	}
+
+	m.notify(models.Event{
+		Type:       models.KExchangeOfferEvent,
+		ExchangeId: exchangeId,
+		UserId:     strPtr(userId),
+		Status:     string(models.KCreatedExchangeDetailsStatus),
+		UserIds:    []string{userId},
+	})
+}
+
+// participantLocation - место игрушки, а если его нет - место владельца, как COALESCE(t.lat, u.lat)
+func participantLocation(toy *models.Toy, user *models.User) *models.Location {
+	var userLocation *models.Location
+	if user != nil {
+		userLocation = user.Location
+	}
+
+	if toy.Location == nil {
+		return copyLocation(userLocation)
+	}
+
+	return mergeLocation(toy.Location, userLocation)
+}
+
+// locationDistance - расстояние между местами, если оба известны, как distance_km в базе
+func locationDistance(location *models.Location, other *models.Location) *float64 {
+	if location == nil || other == nil {
+		return nil
+	}
+
+	distance := utils.DistanceKm(location.Lat, location.Lon, other.Lat, other.Lon)
+	return &distance
+}
+
+func (m *Memory) userRating(userId string) models.UserRating {
+	var rating models.UserRating
+	sum := 0
+	for _, review := range m.reviews {
+		if review.UserId == userId {
+			sum += review.Rating
+			rating.Count++
+		}
+	}
+
+	if rating.Count > 0 {
+		rating.Average = float64(sum) / float64(rating.Count)
+	}
+
+	return rating
+}
+
+// selectExchangeWithParticipants - участники обмена с игрушками и пользователями в порядке user_id
+func (m *Memory) selectExchangeWithParticipants(exchangeId string) []models.ExchangeParticipant {
+	participants := make([]models.ExchangeParticipant, 0, 2)
+
+	stored, ok := m.exchanges[exchangeId]
+	if !ok {
+		return participants
+	}
+
+	for _, d := range m.exchangeDetails(exchangeId) {
+		toy := m.toy(d.ToyId)
+		user, found := m.users[d.UserId]
+		if toy == nil || !found {
+			continue
+		}
+
+		participants = append(participants, models.ExchangeParticipant{
+			ExchangeId:        stored.ExchangeId,
+			ExchangeStatus:    stored.Status,
+			IdempotencyToken:  stored.IdempotencyToken,
+			ExchangeCreatedAt: stored.CreatedAt,
+			ExchangeUpdatedAt: stored.UpdatedAt,
+
+			ToyId:          toy.ToyId,
+			ToyName:        toy.Name,
+			ToyDescription: toy.Description,
+			ToyPhotos:      toy.Photos,
+			ToyLocation:    participantLocation(toy, user),
+
+			UserId:     user.UserId,
+			FirstName:  user.UserName.FirstName,
+			MiddleName: user.UserName.MiddleName,
+			LastName:   user.UserName.LastName,
+			UserRating: m.userRating(user.UserId),
+
+			UserExchangeStatus: d.Status,
+		})
+	}
+
+	// расстояние до игрушки второй стороны
+	if len(participants) == 2 {
+		for i := range participants {
+			participants[i].ToyDistance = locationDistance(participants[i].ToyLocation, participants[1-i].ToyLocation)
+		}
+	}
+
+	return participants
+}
+
+func (m *Memory) SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error) {
+	m.lock()
+	defer m.unlock()
+
+	return m.selectExchangeWithParticipants(exchangeId), nil
+}
+
+// UpdateExchangeWithParticipants меняет статус участника по правилам exchange.UpdateDetailsStatus
+// и возвращает участников после всех вызванных этим изменений
+func (m *Memory) UpdateExchangeWithParticipants(ctx context.Context, exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error) {
+	const op = "Memory.UpdateExchangeWithParticipants"
+
+	m.lock()
+	defer m.unlock()
+
+	if err := exchange.UpdateDetailsStatus(&exchangeTx{m: m}, exchangeId, userId, status); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return m.selectExchangeWithParticipants(exchangeId), nil
+}
+
+// exchangeInfo собирает обмен для списка: первым идет инициатор (его игрушка src_toy_id)
+func (m *Memory) exchangeInfo(stored *models.Exchange) models.ExchangeInfo {
+	info := models.ExchangeInfo{
+		ExchangeId:       stored.ExchangeId,
+		IdempotencyToken: stored.IdempotencyToken,
+		Status:           stored.Status,
+		CreatedAt:        stored.CreatedAt,
+		UpdatedAt:        stored.UpdatedAt,
+	}
+
+	details := m.exchangeDetails(stored.ExchangeId)
+	sort.SliceStable(details, func(i, j int) bool {
+		return details[i].ToyId == stored.SrcToyId && details[j].ToyId != stored.SrcToyId
+	})
+
+	for _, d := range details {
+		toy := m.toy(d.ToyId)
+		user, found := m.users[d.UserId]
+		if toy == nil || !found {
+			continue
+		}
+
+		item := models.ExchangeDetailsInfo{
+			Toy: models.ToyInfo{
+				ToyId:       toy.ToyId,
+				UserId:      d.UserId,
+				Name:        toy.Name,
+				Description: toy.Description,
+				Photos:      toy.Photos,
+			},
+			User: models.UserInfo{
+				UserName: user.UserName,
+				Rating:   m.userRating(user.UserId),
+			},
+			Status: d.Status,
+		}
+
+		// расстояние до игрушки второй стороны, если у обеих известно место
+		location := participantLocation(toy, user)
+		for _, other := range details {
+			if other.UserId == d.UserId {
+				continue
+			}
+
+			otherToy := m.toy(other.ToyId)
+			if otherToy == nil {
+				continue
+			}
+
+			item.Distance = locationDistance(location, participantLocation(otherToy, m.users[other.UserId]))
+		}
+
+		info.Details = append(info.Details, item)
+	}
+
+	return info
+}
+
+// isAwaitingUser - статус участника отстает от статуса другой стороны, как kWhereExchangeAwaitingUser
+func (m *Memory) isAwaitingUser(stored *models.Exchange, mine *models.ExchangeDetails) bool {
+	if !isActiveExchange(stored.Status) || mine.Status == models.KFailedExchangeDetailsStatus {
+		return false
+	}
+
+	for _, other := range m.details {
+		if other.ExchangeId != stored.ExchangeId || other.UserId == mine.UserId || other.Status == models.KFailedExchangeDetailsStatus {
+			continue
+		}
+
+		if detailsProgress(mine.Status) < detailsProgress(other.Status) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func inDateRange(value time.Time, dateRange *models.QueryDateRange) bool {
+	if dateRange == nil {
+		return true
+	}
+
+	if dateRange.From != nil && value.Before(*dateRange.From) {
+		return false
+	}
+
+	return dateRange.To == nil || value.Before(*dateRange.To)
+}
+
+// filterExchanges повторяет условия buildExchangeListQuery
+func (m *Memory) filterExchanges(query *models.QueryExchanges, userId string) []*models.Exchange {
+	exchanges := make([]*models.Exchange, 0)
+	for _, mine := range m.details {
+		stored, ok := m.exchanges[mine.ExchangeId]
+		if mine.UserId != userId || !ok {
+			continue
+		}
+
+		if query.Statuses != nil && !containsString(query.Statuses, string(stored.Status)) {
+			continue
+		}
+
+		if query.Role != nil {
+			toyId := stored.SrcToyId
+			if *query.Role == models.KRoleRecipient {
+				toyId = stored.DstToyId
+			}
+
+			if mine.ToyId != toyId {
+				continue
+			}
+		}
+
+		if query.CounterpartyId != nil {
+			found := false
+			for _, other := range m.details {
+				if other.ExchangeId == stored.ExchangeId && other.UserId != mine.UserId && other.UserId == *query.CounterpartyId {
+					found = true
+				}
+			}
+
+			if !found {
+				continue
+			}
+		}
+
+		if query.ToyId != nil && *query.ToyId != stored.SrcToyId && *query.ToyId != stored.DstToyId {
+			continue
+		}
+
+		if !inDateRange(stored.CreatedAt, query.CreatedAt) || !inDateRange(stored.UpdatedAt, query.UpdatedAt) {
+			continue
+		}
+
+		if query.AwaitingMyAction && !m.isAwaitingUser(stored, mine) {
+			continue
+		}
+
+		copied := *stored
+		exchanges = append(exchanges, &copied)
+	}
+
+	return exchanges
+}
+
+func exchangeSortValue(stored *models.Exchange, field string) time.Time {
+	if field == models.KSortUpdatedAt {
+		return stored.UpdatedAt
+	}
+
+	return stored.CreatedAt
+}
+
+func (m *Memory) SelectExchangeList(ctx context.Context, query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.ExchangeInfo, *models.Keyset, *models.Total, error) {
+	const op = "Memory.SelectExchangeList"
+
+	if sort.Field != models.KSortCreatedAt && sort.Field != models.KSortUpdatedAt {
+		return nil, nil, nil, fmt.Errorf("%s, unknown sort field %s", op, sort.Field)
+	}
+
+	var from *models.Exchange
+	if cursor != nil {
+		if cursor.Value == nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, errors.New("cursor without sort value"))
+		}
+
+		value, err := time.Parse(kCursorTimestampLayout, *cursor.Value)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		from = &models.Exchange{ExchangeId: cursor.Id, CreatedAt: value, UpdatedAt: value}
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	exchanges := m.filterExchanges(query, userId)
+	total := listTotal(len(exchanges), withTotal)
+
+	desc := sort.Direction == models.KSortDesc
+	compare := func(a *models.Exchange, b *models.Exchange) int {
+		result := exchangeSortValue(a, sort.Field).Compare(exchangeSortValue(b, sort.Field))
+		if result == 0 {
+			result = strings.Compare(a.ExchangeId, b.ExchangeId)
+		}
+
+		if desc {
+			return -result
+		}
+
+		return result
+	}
+
+	page := make([]*models.Exchange, 0, len(exchanges))
+	for _, stored := range exchanges {
+		if from == nil || compare(stored, from) >= 0 {
+			page = append(page, stored)
+		}
+	}
+
+	sortSlice(page, func(a **models.Exchange, b **models.Exchange) bool { return compare(*a, *b) < 0 })
+
+	var nextCursor *models.Keyset = nil
+	if int64(len(page)) > limit {
+		next := page[limit]
+		value := exchangeSortValue(next, sort.Field).Format(kCursorTimestampLayout)
+		nextCursor = &models.Keyset{Value: &value, Id: next.ExchangeId}
+		page = page[:limit]
+	}
+
+	infos := make([]models.ExchangeInfo, 0, len(page))
+	for _, stored := range page {
+		infos = append(infos, m.exchangeInfo(stored))
+	}
+
+	return infos, nextCursor, total, nil
+}
+
+// MESSAGE
+
+// InsertExchangeMessage сохраняет сообщение, повтор с тем же idempotency_token возвращает уже сохраненное
+func (m *Memory) InsertExchangeMessage(ctx context.Context, message *models.ExchangeMessage) (*models.ExchangeMessage, error) {
+	m.lock()
+	defer m.unlock()
+
+	key := messageKey{exchangeId: message.ExchangeId, userId: message.UserId, token: message.IdempotencyToken}
+	if messageId, ok := m.messageByToken[key]; ok {
+		for _, stored := range m.messages {
+			if stored.MessageId == messageId {
+				copied := *stored
+				return &copied, nil
+			}
+		}
+	}
+
+	stored := &models.ExchangeMessage{
+		MessageId:        newId(),
+		ExchangeId:       message.ExchangeId,
+		UserId:           message.UserId,
+		Text:             message.Text,
+		IdempotencyToken: message.IdempotencyToken,
+		CreatedAt:        m.now(),
+	}
+
+	m.messages = append(m.messages, stored)
+	m.messageByToken[key] = stored.MessageId
+
+	m.notify(models.Event{
+		Type:       models.KExchangeMessageEvent,
+		ExchangeId: stored.ExchangeId,
+		UserId:     strPtr(stored.UserId),
+		MessageId:  strPtr(stored.MessageId),
+		UserIds:    m.participants(stored.ExchangeId),
+	})
+
+	copied := *stored
+	return &copied, nil
+}
+
+// SelectExchangeMessages - сообщения в хронологическом порядке, курсор - id первого сообщения следующей страницы
+func (m *Memory) SelectExchangeMessages(ctx context.Context, exchangeId string, cursor *string, limit int64) ([]models.ExchangeMessage, *string, error) {
+	m.lock()
+	defer m.unlock()
+
+	var from *models.ExchangeMessage
+	if cursor != nil {
+		for _, stored := range m.messages {
+			if stored.MessageId == *cursor {
+				from = stored
+			}
+		}
+
+		// курсор на несуществующее сообщение не совпадает ни с одной строкой
+		if from == nil {
+			return make([]models.ExchangeMessage, 0), nil, nil
+		}
+	}
+
+	before := func(a *models.ExchangeMessage, b *models.ExchangeMessage) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+
+		return a.MessageId < b.MessageId
+	}
+
+	messages := make([]models.ExchangeMessage, 0)
+	for _, stored := range m.messages {
+		if stored.ExchangeId != exchangeId || (from != nil && before(stored, from)) {
+			continue
+		}
+
+		messages = append(messages, *stored)
+	}
+
+	sortSlice(messages, before)
+
+	var nextCursor *string = nil
+	if int64(len(messages)) > limit {
+		nextCursor = strPtr(messages[limit].MessageId)
+		messages = messages[:limit]
+	}
+
+	return messages, nextCursor, nil
+}
@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"service/internal/models"
+
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	KDriverMemory = "memory"
+)
+
+// errNoRows - то же, что возвращает Postgres, когда UPDATE ... RETURNING не нашел строку
+var errNoRows = errors.New("no rows in result set")
+
+// kCategories - справочник категорий из 0001_init.up.sql
+var kCategories = []models.Category{
+	{CategoryId: "dolls", Name: "Куклы"},
+	{CategoryId: "vehicles", Name: "Машинки и транспорт"},
+	{CategoryId: "construction", Name: "Конструкторы"},
+	{CategoryId: "plush", Name: "Мягкие игрушки"},
+	{CategoryId: "games", Name: "Настольные игры"},
+	{CategoryId: "puzzles", ParentId: strPtr("games"), Name: "Пазлы"},
+	{CategoryId: "educational", Name: "Развивающие игрушки"},
+	{CategoryId: "baby", ParentId: strPtr("educational"), Name: "Для малышей"},
+	{CategoryId: "outdoor", Name: "Для улицы и спорта"},
+}
+
+type blockKey struct {
+	userId        string
+	blockedUserId string
+}
+
+// messageKey - токен сообщения уникален в пределах автора и обмена
+type messageKey struct {
+	exchangeId string
+	userId     string
+	token      string
+}
+
+type reviewKey struct {
+	exchangeId string
+	reviewerId string
+}
+
+// Memory - Storage в памяти процесса для тестов и локального запуска без базы.
+// Повторяет семантику запросов и правил обмена Postgres: правила обмена выполняет тот же пакет exchange,
+// события рассылаются так же, как их отправляют триггеры pg_notify. Данные теряются при остановке
+type Memory struct {
+	mu       sync.Mutex
+	lastTime time.Time
+
+	users           map[string]*models.User
+	userByEmail     map[string]string
+	categories      []models.Category
+	toys            map[string]*models.Toy
+	toyByToken      map[toyTokenKey]string
+	photos          map[string][]models.ToyPhoto
+	uploads         map[string]*models.Upload
+	ownership       map[string][]*models.ToyOwnership
+	exchanges       map[string]*models.Exchange
+	exchangeByToken map[string]string
+	details         []*models.ExchangeDetails
+	messages        []*models.ExchangeMessage
+	messageByToken  map[messageKey]string
+	reviews         map[reviewKey]*models.Review
+	reports         []*models.UserReport
+	blocks          map[blockKey]struct{}
+
+	// события копятся под блокировкой и рассылаются после нее, как pg_notify после коммита
+	pending      []models.Event
+	listeners    map[int]func(models.Event)
+	nextListener int
+}
+
+func New() *Memory {
+	return &Memory{
+		users:           make(map[string]*models.User),
+		userByEmail:     make(map[string]string),
+		categories:      append([]models.Category{}, kCategories...),
+		toys:            make(map[string]*models.Toy),
+		toyByToken:      make(map[toyTokenKey]string),
+		photos:          make(map[string][]models.ToyPhoto),
+		uploads:         make(map[string]*models.Upload),
+		ownership:       make(map[string][]*models.ToyOwnership),
+		exchanges:       make(map[string]*models.Exchange),
+		exchangeByToken: make(map[string]string),
+		messageByToken:  make(map[messageKey]string),
+		reviews:         make(map[reviewKey]*models.Review),
+		blocks:          make(map[blockKey]struct{}),
+		listeners:       make(map[int]func(models.Event)),
+	}
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func newId() string {
+	return uuid.NewString()
+}
+
+// now - время с точностью TIMESTAMP в Postgres. Каждый вызов возвращает время позже предыдущего,
+// чтобы порядок по created_at совпадал с порядком вставки
+func (m *Memory) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(m.lastTime) {
+		now = m.lastTime.Add(time.Microsecond)
+	}
+
+	m.lastTime = now
+	return now
+}
+
+// lock блокирует хранилище, unlock снимает блокировку и рассылает накопленные события
+func (m *Memory) lock() {
+	m.mu.Lock()
+}
+
+func (m *Memory) unlock() {
+	events := m.pending
+	m.pending = nil
+
+	handlers := make([]func(models.Event), 0, len(m.listeners))
+	for _, handler := range m.listeners {
+		handlers = append(handlers, handler)
+	}
+
+	m.mu.Unlock()
+
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// participants - участники обмена без повторов, как array_agg(DISTINCT user_id)
+func (m *Memory) participants(exchangeId string) []string {
+	seen := make(map[string]struct{})
+	userIds := make([]string, 0, 2)
+	for _, d := range m.details {
+		if _, ok := seen[d.UserId]; d.ExchangeId == exchangeId && !ok {
+			seen[d.UserId] = struct{}{}
+			userIds = append(userIds, d.UserId)
+		}
+	}
+
+	sort.Strings(userIds)
+	return userIds
+}
+
+func (m *Memory) notify(event models.Event) {
+	m.pending = append(m.pending, event)
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) PoolStats() models.PoolStats {
+	return models.PoolStats{Driver: KDriverMemory}
+}
+
+// ListenEvents передает в handler события всех изменений обменов и сообщений. Блокируется до отмены ctx
+func (m *Memory) ListenEvents(ctx context.Context, handler func(models.Event)) error {
+	m.mu.Lock()
+	id := m.nextListener
+	m.nextListener++
+	m.listeners[id] = handler
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.listeners, id)
+	m.mu.Unlock()
+
+	return nil
+}
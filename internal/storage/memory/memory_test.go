@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"service/internal/models"
+	"service/internal/storage/storagetest"
+
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, New())
+}
+
+func TestListenEvents(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan models.Event, 16)
+	done := make(chan struct{})
+	go func() {
+		m.ListenEvents(ctx, func(event models.Event) { events <- event })
+		close(done)
+	}()
+
+	// ждем регистрации слушателя
+	for {
+		m.mu.Lock()
+		registered := len(m.listeners) == 1
+		m.mu.Unlock()
+
+		if registered {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	alice, _ := m.CreateUser(ctx, &models.User{Email: "alice@example.com"})
+	bob, _ := m.CreateUser(ctx, &models.User{Email: "bob@example.com"})
+	aliceToy, _ := m.InsertToy(ctx, &models.Toy{UserId: alice.UserId, Name: "Мяч", IdempotencyToken: "t1"})
+	bobToy, _ := m.InsertToy(ctx, &models.Toy{UserId: bob.UserId, Name: "Юла", IdempotencyToken: "t2"})
+
+	exchange, err := m.InsertExchange(ctx, &models.Exchange{SrcToyId: aliceToy.ToyId, DstToyId: bobToy.ToyId, IdempotencyToken: "e1"},
+		[]models.ExchangeDetails{{ToyId: aliceToy.ToyId, UserId: alice.UserId}, {ToyId: bobToy.ToyId, UserId: bob.UserId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.UpdateExchangeWithParticipants(ctx, exchange.ExchangeId, bob.UserId, models.KFailedExchangeDetailsStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.EventType{
+		models.KExchangeOfferEvent,
+		models.KExchangeDetailsStatusEvent,
+		models.KExchangeDetailsStatusEvent,
+		models.KExchangeStatusEvent,
+	}
+
+	for i, eventType := range want {
+		select {
+		case event := <-events:
+			if event.Type != eventType || event.ExchangeId != exchange.ExchangeId {
+				t.Fatalf("event #%d = %+v, want %s", i, event, eventType)
+			}
+
+			if event.Type == models.KExchangeOfferEvent && (len(event.UserIds) != 1 || event.UserIds[0] != bob.UserId) {
+				t.Errorf("offer event = %+v, want it only for bob", event)
+			}
+
+			if event.Type == models.KExchangeStatusEvent && (event.Status != string(models.KFailedExchangeStatus) || len(event.UserIds) != 2) {
+				t.Errorf("status event = %+v, want failed for both participants", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event #%d %s was not delivered", i, eventType)
+		}
+	}
+
+	cancel()
+	<-done
+}
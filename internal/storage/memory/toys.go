@@ -0,0 +1,909 @@
+package memory
+
+import (
+	"service/internal/domain/exchange"
+	"service/internal/models"
+	"service/internal/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const kCursorTimestampLayout = "2006-01-02 15:04:05.999999"
+
+var kToysSortFields = map[string]struct{}{
+	models.KSortCreatedAt: {},
+	models.KSortUpdatedAt: {},
+	models.KSortName:      {},
+	models.KSortRelevance: {},
+	models.KSortDistance:  {},
+}
+
+func copyLocation(location *models.Location) *models.Location {
+	if location == nil {
+		return nil
+	}
+
+	copied := *location
+	return &copied
+}
+
+// toy возвращает копию игрушки вместе с фотографиями
+func (m *Memory) toy(toyId string) *models.Toy {
+	stored, ok := m.toys[toyId]
+	if !ok {
+		return nil
+	}
+
+	toy := *stored
+	toy.Tags = append([]string{}, stored.Tags...)
+	toy.Location = copyLocation(stored.Location)
+	toy.Photos = m.toyPhotos(toyId)
+
+	return &toy
+}
+
+func (m *Memory) toyPhotos(toyId string) []models.ToyPhoto {
+	return append(make([]models.ToyPhoto, 0, len(m.photos[toyId])), m.photos[toyId]...)
+}
+
+func isVisibleToy(toy *models.Toy) bool {
+	return toy.Status != models.KRemovedToyStatus && toy.Status != models.KExchangedToyStatus
+}
+
+func (m *Memory) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	m.lock()
+	defer m.unlock()
+
+	toy := m.toy(toyId)
+	if toy == nil || !isVisibleToy(toy) {
+		return nil, nil
+	}
+
+	return toy, nil
+}
+
+func (m *Memory) SelectToyByUserId(ctx context.Context, toyId string, userId string) (*models.Toy, error) {
+	m.lock()
+	defer m.unlock()
+
+	toy := m.toy(toyId)
+	if toy == nil || toy.UserId != userId || !isVisibleToy(toy) {
+		return nil, nil
+	}
+
+	return toy, nil
+}
+
+// toyTokenKey - токен идемпотентности игрушки уникален в пределах владельца, как UNIQUE (user_id, idempotency_token)
+type toyTokenKey struct {
+	userId string
+	token  string
+}
+
+func (m *Memory) SelectToyByToken(ctx context.Context, token string, userId string) (*models.Toy, error) {
+	m.lock()
+	defer m.unlock()
+
+	toyId, ok := m.toyByToken[toyTokenKey{userId: userId, token: token}]
+	if !ok {
+		return nil, nil
+	}
+
+	return m.toy(toyId), nil
+}
+
+// ownedToy - игрушка владельца, которую еще можно менять
+func (m *Memory) ownedToy(toyId string, userId string) *models.Toy {
+	toy, ok := m.toys[toyId]
+	if !ok || toy.UserId != userId || toy.Status == models.KRemovedToyStatus {
+		return nil
+	}
+
+	return toy
+}
+
+// editableToy - игрушка владельца, фотографии которой можно менять, как lockToy в postgres
+func (m *Memory) editableToy(toyId string, userId string) (*models.Toy, error) {
+	toy := m.ownedToy(toyId, userId)
+	if toy == nil {
+		return nil, nil
+	}
+
+	if toy.Status != models.KCreatedToyStatus {
+		return nil, models.ErrToyNotEditable
+	}
+
+	return toy, nil
+}
+
+// InsertToy создает игрушку вместе с фотографиями из newToy.Photos и открывает историю владения.
+// Повтор с тем же idempotency_token возвращает уже созданную игрушку
+func (m *Memory) InsertToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Memory.InsertToy"
+
+	m.lock()
+	defer m.unlock()
+
+	// повтор с тем же idempotency_token возвращает игрушку без изменений; файлы повтора
+	// остаются освобожденными после InsertUploads и удаляются сборщиком
+	if toyId, exists := m.toyByToken[toyTokenKey{userId: newToy.UserId, token: newToy.IdempotencyToken}]; exists {
+		return m.toy(toyId), nil
+	}
+
+	owner, ok := m.users[newToy.UserId]
+	if !ok {
+		return nil, fmt.Errorf("%s, user %s does not exist", op, newToy.UserId)
+	}
+
+	if len(newToy.Photos) > models.KMaxToyPhotos {
+		return nil, fmt.Errorf("%s, %w", op, models.ErrTooManyPhotos)
+	}
+
+	now := m.now()
+	toy := &models.Toy{
+		ToyId:            newId(),
+		UserId:           newToy.UserId,
+		Name:             newToy.Name,
+		IdempotencyToken: newToy.IdempotencyToken,
+		Description:      newToy.Description,
+		Status:           newToy.Status,
+		CategoryId:       newToy.CategoryId,
+		Tags:             append([]string{}, newToy.Tags...),
+		AgeMin:           newToy.AgeMin,
+		AgeMax:           newToy.AgeMax,
+		Condition:        newToy.Condition,
+		// без своих координат игрушка находится там же, где владелец
+		Location:  mergeLocation(newToy.Location, owner.Location),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if toy.Status == "" {
+		toy.Status = models.KCreatedToyStatus
+	}
+
+	toyId := toy.ToyId
+	m.toys[toyId] = toy
+	m.toyByToken[toyTokenKey{userId: toy.UserId, token: toy.IdempotencyToken}] = toyId
+
+	m.openOwnership(toyId, toy.UserId, nil)
+
+	for _, photo := range newToy.Photos {
+		if err := m.insertToyPhoto(toyId, &photo.PhotoSet); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	return m.toy(toyId), nil
+}
+
+// mergeLocation - координаты и город из location, а где их нет - из fallback, как COALESCE по каждой колонке
+func mergeLocation(location *models.Location, fallback *models.Location) *models.Location {
+	if location == nil {
+		return copyLocation(fallback)
+	}
+
+	merged := *location
+	if merged.City == nil && fallback != nil {
+		merged.City = fallback.City
+	}
+
+	return &merged
+}
+
+// UpdateToy заменяет поля игрушки, место меняется, только если оно передано; фотографии из newToy.Photos добавляются в конец списка
+func (m *Memory) UpdateToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Memory.UpdateToy"
+
+	m.lock()
+	defer m.unlock()
+
+	toy := m.ownedToy(newToy.ToyId, newToy.UserId)
+	if toy == nil {
+		return nil, nil
+	}
+
+	// проверки до изменений, чтобы ошибка не оставила игрушку измененной наполовину
+	if len(newToy.Photos) > 0 && toy.Status != models.KCreatedToyStatus {
+		return nil, fmt.Errorf("%s, %w", op, models.ErrToyNotEditable)
+	}
+
+	if len(m.photos[toy.ToyId])+len(newToy.Photos) > models.KMaxToyPhotos {
+		return nil, fmt.Errorf("%s, %w", op, models.ErrTooManyPhotos)
+	}
+
+	toy.Name = newToy.Name
+	toy.Description = newToy.Description
+	toy.CategoryId = newToy.CategoryId
+	toy.Tags = append([]string{}, newToy.Tags...)
+	toy.AgeMin = newToy.AgeMin
+	toy.AgeMax = newToy.AgeMax
+	toy.Condition = newToy.Condition
+	// место заменяется целиком, вместе с городом
+	if newToy.Location != nil {
+		toy.Location = copyLocation(newToy.Location)
+	}
+	toy.UpdatedAt = m.now()
+
+	for _, photo := range newToy.Photos {
+		if err := m.insertToyPhoto(toy.ToyId, &photo.PhotoSet); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	return m.toy(toy.ToyId), nil
+}
+
+// UpdateToyStatus меняет статус игрушки владельца; при удалении игрушки проваливаются ее незавершенные обмены
+func (m *Memory) UpdateToyStatus(ctx context.Context, toyId string, userId string, status models.ToyStatus) (*models.Toy, error) {
+	const op = "Memory.UpdateToyStatus"
+
+	m.lock()
+	defer m.unlock()
+
+	toy := m.ownedToy(toyId, userId)
+	if toy == nil {
+		return nil, fmt.Errorf("%s, %w", op, errNoRows)
+	}
+
+	toy.Status = status
+	toy.UpdatedAt = m.now()
+
+	if status == models.KRemovedToyStatus {
+		if err := exchange.RemoveToy(&exchangeTx{m: m}, toyId); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		m.releaseUploads(models.PhotoKeys(m.photos[toyId]))
+	}
+
+	return m.toy(toyId), nil
+}
+
+func (m *Memory) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	m.lock()
+	defer m.unlock()
+
+	categories := append([]models.Category{}, m.categories...)
+
+	// ORDER BY parent_id NULLS FIRST, name
+	sort.SliceStable(categories, func(i, j int) bool {
+		a, b := categories[i], categories[j]
+		if (a.ParentId == nil) != (b.ParentId == nil) {
+			return a.ParentId == nil
+		}
+
+		if a.ParentId != nil && *a.ParentId != *b.ParentId {
+			return *a.ParentId < *b.ParentId
+		}
+
+		return a.Name < b.Name
+	})
+
+	return categories, nil
+}
+
+// openOwnership начинает период владения, если у игрушки нет текущего владельца
+func (m *Memory) openOwnership(toyId string, userId string, exchangeId *string) {
+	for _, period := range m.ownership[toyId] {
+		if period.ReleasedAt == nil {
+			return
+		}
+	}
+
+	m.ownership[toyId] = append(m.ownership[toyId], &models.ToyOwnership{
+		UserId:     userId,
+		ExchangeId: exchangeId,
+		AcquiredAt: m.now(),
+	})
+}
+
+func (m *Memory) releaseOwnership(toyId string) {
+	now := m.now()
+	for _, period := range m.ownership[toyId] {
+		if period.ReleasedAt == nil {
+			period.ReleasedAt = &now
+		}
+	}
+}
+
+// SelectToyOwnershipHistory - владельцы игрушки от создателя до текущего
+func (m *Memory) SelectToyOwnershipHistory(ctx context.Context, toyId string) ([]models.ToyOwnership, error) {
+	m.lock()
+	defer m.unlock()
+
+	history := make([]models.ToyOwnership, 0, len(m.ownership[toyId]))
+	for _, period := range m.ownership[toyId] {
+		history = append(history, *period)
+	}
+
+	return history, nil
+}
+
+// SEARCH
+
+// toyMatch - вычисляемые колонки строки списка
+type toyMatch struct {
+	score    *float64
+	snippet  *string
+	distance *float64
+}
+
+// matchText приближенно повторяет полнотекстовый поиск: все слова запроса должны встретиться
+// в названии или описании, либо весь запрос - в названии. Вес совпадения в названии выше, чем в описании
+func matchText(toy *models.Toy, text string) (*float64, *string, bool) {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return nil, nil, false
+	}
+
+	name := strings.ToLower(toy.Name)
+	description := ""
+	if toy.Description != nil {
+		description = strings.ToLower(*toy.Description)
+	}
+
+	score := 0.0
+	allFound := true
+	for _, word := range words {
+		found := false
+		if strings.Contains(name, word) {
+			score += 1
+			found = true
+		}
+
+		if strings.Contains(description, word) {
+			score += 0.4
+			found = true
+		}
+
+		allFound = allFound && found
+	}
+
+	if !allFound && !strings.Contains(name, strings.ToLower(text)) {
+		return nil, nil, false
+	}
+
+	score /= float64(len(words))
+
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(word))
+	}
+
+	source := toy.Name
+	if toy.Description != nil {
+		source = *toy.Description
+	}
+
+	snippet := regexp.MustCompile("(?i)"+strings.Join(quoted, "|")).ReplaceAllString(source, "<b>$0</b>")
+
+	return &score, &snippet, true
+}
+
+// categoryTree - категории вместе со всеми вложенными
+func (m *Memory) categoryTree(categoryIds []string) map[string]struct{} {
+	tree := make(map[string]struct{}, len(categoryIds))
+	for _, categoryId := range categoryIds {
+		tree[categoryId] = struct{}{}
+	}
+
+	for grown := true; grown; {
+		grown = false
+		for _, category := range m.categories {
+			if _, ok := tree[category.CategoryId]; ok || category.ParentId == nil {
+				continue
+			}
+
+			if _, ok := tree[*category.ParentId]; ok {
+				tree[category.CategoryId] = struct{}{}
+				grown = true
+			}
+		}
+	}
+
+	return tree
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Memory) isBlocked(userId1 string, userId2 string) bool {
+	_, blocked := m.blocks[blockKey{userId: userId1, blockedUserId: userId2}]
+	_, blockedBack := m.blocks[blockKey{userId: userId2, blockedUserId: userId1}]
+
+	return blocked || blockedBack
+}
+
+// filterToys повторяет условия buildToysListQuery
+func (m *Memory) filterToys(query *models.QueryToys, userId string) []models.Toy {
+	var categories map[string]struct{}
+	if query.CategoryIds != nil {
+		categories = m.categoryTree(query.CategoryIds)
+	}
+
+	toys := make([]models.Toy, 0)
+	for toyId, stored := range m.toys {
+		// игрушки пользователей, заблокированных в любую сторону, не показываем
+		if m.isBlocked(userId, stored.UserId) {
+			continue
+		}
+
+		toy := m.toy(toyId)
+
+		if query.Text != nil {
+			score, snippet, ok := matchText(toy, *query.Text)
+			if !ok {
+				continue
+			}
+
+			toy.Score, toy.Snippet = score, snippet
+		}
+
+		if query.Near != nil {
+			if toy.Location == nil {
+				continue
+			}
+
+			minLat, maxLat, minLon, maxLon := utils.BoundingBox(query.Near.Lat, query.Near.Lon, query.Near.RadiusKm)
+			lat, lon := toy.Location.Lat, toy.Location.Lon
+			if lat < minLat || lat > maxLat || lon < minLon || lon > maxLon {
+				continue
+			}
+
+			distance := utils.DistanceKm(query.Near.Lat, query.Near.Lon, lat, lon)
+			if distance > query.Near.RadiusKm {
+				continue
+			}
+
+			toy.Distance = &distance
+		}
+
+		if query.Statuses != nil && !containsString(query.Statuses, string(toy.Status)) {
+			continue
+		}
+
+		if query.ExcludeUserIds != nil && containsString(query.ExcludeUserIds, toy.UserId) {
+			continue
+		}
+
+		if query.UserIds != nil && !containsString(query.UserIds, toy.UserId) {
+			continue
+		}
+
+		if categories != nil {
+			if toy.CategoryId == nil {
+				continue
+			}
+
+			if _, ok := categories[*toy.CategoryId]; !ok {
+				continue
+			}
+		}
+
+		if query.Tags != nil {
+			overlap := false
+			for _, tag := range toy.Tags {
+				overlap = overlap || containsString(query.Tags, tag)
+			}
+
+			if !overlap {
+				continue
+			}
+		}
+
+		if query.Age != nil {
+			if (toy.AgeMin != nil && *toy.AgeMin > *query.Age) || (toy.AgeMax != nil && *toy.AgeMax < *query.Age) {
+				continue
+			}
+		}
+
+		if query.Conditions != nil && (toy.Condition == nil || !containsString(query.Conditions, string(*toy.Condition))) {
+			continue
+		}
+
+		toys = append(toys, *toy)
+	}
+
+	return toys
+}
+
+// compareFloats сравнивает значения как Postgres: NULL больше любого числа
+func compareFloats(a *float64, b *float64) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case *a < *b:
+		return -1
+	case *a > *b:
+		return 1
+	}
+
+	return 0
+}
+
+func compareToys(a *models.Toy, b *models.Toy, field string) int {
+	switch field {
+	case models.KSortCreatedAt:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case models.KSortUpdatedAt:
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case models.KSortName:
+		return strings.Compare(a.Name, b.Name)
+	case models.KSortRelevance:
+		return compareFloats(a.Score, b.Score)
+	case models.KSortDistance:
+		return compareFloats(a.Distance, b.Distance)
+	}
+
+	return 0
+}
+
+// cursorToy - игрушка с полями курсора для сравнения тем же compareToys
+func cursorToy(cursor *models.Keyset, field string) (*models.Toy, error) {
+	if cursor.Value == nil {
+		return nil, errors.New("cursor without sort value")
+	}
+
+	toy := &models.Toy{ToyId: cursor.Id}
+	value := *cursor.Value
+
+	switch field {
+	case models.KSortCreatedAt, models.KSortUpdatedAt:
+		parsed, err := time.Parse(kCursorTimestampLayout, value)
+		if err != nil {
+			return nil, err
+		}
+		toy.CreatedAt, toy.UpdatedAt = parsed, parsed
+	case models.KSortName:
+		toy.Name = value
+	case models.KSortRelevance, models.KSortDistance:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		toy.Score, toy.Distance = &parsed, &parsed
+	}
+
+	return toy, nil
+}
+
+func getToySortValue(toy *models.Toy, field string) *string {
+	var value string
+
+	switch field {
+	case models.KSortCreatedAt:
+		value = toy.CreatedAt.Format(kCursorTimestampLayout)
+	case models.KSortUpdatedAt:
+		value = toy.UpdatedAt.Format(kCursorTimestampLayout)
+	case models.KSortName:
+		value = toy.Name
+	case models.KSortRelevance:
+		if toy.Score == nil {
+			return nil
+		}
+		value = strconv.FormatFloat(*toy.Score, 'g', -1, 64)
+	case models.KSortDistance:
+		if toy.Distance == nil {
+			return nil
+		}
+		value = strconv.FormatFloat(*toy.Distance, 'g', -1, 64)
+	default:
+		return nil
+	}
+
+	return &value
+}
+
+func listTotal(count int, mode *string) *models.Total {
+	if mode == nil {
+		return nil
+	}
+
+	return &models.Total{Count: int64(count), Estimated: *mode == models.KTotalEstimated}
+}
+
+func (m *Memory) SelectToysList(ctx context.Context, query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.Toy, *models.Keyset, *models.Total, error) {
+	const op = "Memory.SelectToysList"
+
+	if _, ok := kToysSortFields[sort.Field]; !ok {
+		return nil, nil, nil, fmt.Errorf("%s, unknown sort field %s", op, sort.Field)
+	}
+
+	var from *models.Toy
+	if cursor != nil {
+		var err error
+		if from, err = cursorToy(cursor, sort.Field); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	m.lock()
+	toys := m.filterToys(query, userId)
+	m.unlock()
+
+	total := listTotal(len(toys), withTotal)
+
+	// toy_id сортируется в ту же сторону, что и поле, keyset сравнивается парой (поле, toy_id)
+	desc := sort.Direction == models.KSortDesc
+	compare := func(a *models.Toy, b *models.Toy) int {
+		result := compareToys(a, b, sort.Field)
+		if result == 0 {
+			result = strings.Compare(a.ToyId, b.ToyId)
+		}
+
+		if desc {
+			return -result
+		}
+
+		return result
+	}
+
+	page := make([]models.Toy, 0, len(toys))
+	for _, toy := range toys {
+		if from != nil {
+			// сравнение с NULL в Postgres не выполняется, такие строки не попадают на следующие страницы
+			if getToySortValue(&toy, sort.Field) == nil || compare(&toy, from) < 0 {
+				continue
+			}
+		}
+
+		page = append(page, toy)
+	}
+
+	sortSlice(page, func(a *models.Toy, b *models.Toy) bool { return compare(a, b) < 0 })
+
+	var nextCursor *models.Keyset = nil
+	if int64(len(page)) > limit {
+		next := page[limit]
+		nextCursor = &models.Keyset{
+			Value: getToySortValue(&next, sort.Field),
+			Id:    next.ToyId,
+		}
+		page = page[:limit]
+	}
+
+	return page, nextCursor, total, nil
+}
+
+func sortSlice[T any](values []T, less func(a *T, b *T) bool) {
+	sort.Slice(values, func(i, j int) bool { return less(&values[i], &values[j]) })
+}
+
+// TOY PHOTO
+
+// insertToyPhoto добавляет фотографию в конец списка, models.ErrTooManyPhotos - если достигнут лимит
+func (m *Memory) insertToyPhoto(toyId string, photo *models.PhotoSet) error {
+	if len(m.photos[toyId]) >= models.KMaxToyPhotos {
+		return models.ErrTooManyPhotos
+	}
+
+	m.photos[toyId] = append(m.photos[toyId], models.ToyPhoto{
+		PhotoId:  newId(),
+		Position: len(m.photos[toyId]),
+		PhotoSet: *photo,
+	})
+
+	// файлы привязываются к игрушке, которой принадлежит фотография
+	for _, key := range photo.Keys() {
+		if upload, ok := m.uploads[key]; ok {
+			upload.ToyId = strPtr(toyId)
+			upload.ReleasedAt = nil
+		}
+	}
+
+	return nil
+}
+
+// InsertToyPhoto возвращает nil, если игрушка не найдена у пользователя
+func (m *Memory) InsertToyPhoto(ctx context.Context, toyId string, userId string, photo *models.PhotoSet) ([]models.ToyPhoto, error) {
+	const op = "Memory.InsertToyPhoto"
+
+	m.lock()
+	defer m.unlock()
+
+	toy, err := m.editableToy(toyId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	if toy == nil {
+		return nil, nil
+	}
+
+	if err := m.insertToyPhoto(toyId, photo); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return m.toyPhotos(toyId), nil
+}
+
+// DeleteToyPhoto возвращает nil, если игрушка или фотография не найдены
+func (m *Memory) DeleteToyPhoto(ctx context.Context, toyId string, userId string, photoId string) ([]models.ToyPhoto, error) {
+	const op = "Memory.DeleteToyPhoto"
+
+	m.lock()
+	defer m.unlock()
+
+	toy, err := m.editableToy(toyId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	if toy == nil {
+		return nil, nil
+	}
+
+	photos := m.photos[toyId]
+	for i, photo := range photos {
+		if photo.PhotoId != photoId {
+			continue
+		}
+
+		rest := append(append([]models.ToyPhoto{}, photos[:i]...), photos[i+1:]...)
+		for j := i; j < len(rest); j++ {
+			rest[j].Position--
+		}
+		m.photos[toyId] = rest
+
+		m.releaseUploads(photo.Keys())
+
+		return m.toyPhotos(toyId), nil
+	}
+
+	return nil, nil
+}
+
+// UpdateToyPhotosOrder ставит фотографии в порядке photoIds, в нем должны быть все фотографии игрушки.
+// Возвращает nil, если игрушка не найдена у пользователя
+func (m *Memory) UpdateToyPhotosOrder(ctx context.Context, toyId string, userId string, photoIds []string) ([]models.ToyPhoto, error) {
+	const op = "Memory.UpdateToyPhotosOrder"
+
+	m.lock()
+	defer m.unlock()
+
+	toy, err := m.editableToy(toyId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	if toy == nil {
+		return nil, nil
+	}
+
+	photos := m.toyPhotos(toyId)
+	for i := range photos {
+		for ord, photoId := range photoIds {
+			if photos[i].PhotoId == photoId {
+				photos[i].Position = ord
+			}
+		}
+	}
+
+	// позиции уникальны, как UNIQUE (toy_id, position) в конце транзакции
+	positions := make(map[int]struct{}, len(photos))
+	for _, photo := range photos {
+		if _, ok := positions[photo.Position]; ok {
+			return nil, fmt.Errorf("%s, duplicate photo position %d", op, photo.Position)
+		}
+
+		positions[photo.Position] = struct{}{}
+	}
+
+	sortSlice(photos, func(a *models.ToyPhoto, b *models.ToyPhoto) bool { return a.Position < b.Position })
+	m.photos[toyId] = photos
+
+	return m.toyPhotos(toyId), nil
+}
+
+// UPLOAD
+
+// isUploadReferenced - как kUploadReferenced: фотографии удаленных игрушек не держат файлы
+func (m *Memory) isUploadReferenced(key string) bool {
+	for toyId, photos := range m.photos {
+		if toy, ok := m.toys[toyId]; ok && toy.Status == models.KRemovedToyStatus {
+			continue
+		}
+
+		for _, photo := range photos {
+			if containsString(photo.Keys(), key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// releaseUploads освобождает файлы, на которые больше не ссылается ни одна фотография
+func (m *Memory) releaseUploads(keys []string) {
+	now := m.now()
+	for _, key := range keys {
+		upload, ok := m.uploads[key]
+		if !ok || upload.ReleasedAt != nil || m.isUploadReferenced(key) {
+			continue
+		}
+
+		upload.ReleasedAt = &now
+	}
+}
+
+// InsertUploads регистрирует файлы до их загрузки в BlobStore
+func (m *Memory) InsertUploads(ctx context.Context, keys []string) error {
+	m.lock()
+	defer m.unlock()
+
+	now := m.now()
+	for _, key := range keys {
+		if _, ok := m.uploads[key]; ok {
+			continue
+		}
+
+		releasedAt := now
+		m.uploads[key] = &models.Upload{Key: key, CreatedAt: now, ReleasedAt: &releasedAt}
+	}
+
+	return nil
+}
+
+// SelectOrphanUploads возвращает файлы, на которые нет ссылок с момента до releasedBefore.
+// limit = nil - все такие файлы
+func (m *Memory) SelectOrphanUploads(ctx context.Context, releasedBefore time.Time, limit *int64) ([]models.Upload, error) {
+	m.lock()
+	defer m.unlock()
+
+	uploads := make([]models.Upload, 0)
+	for key, upload := range m.uploads {
+		if upload.ReleasedAt == nil || !upload.ReleasedAt.Before(releasedBefore) || m.isUploadReferenced(key) {
+			continue
+		}
+
+		uploads = append(uploads, *upload)
+	}
+
+	sortSlice(uploads, func(a *models.Upload, b *models.Upload) bool {
+		if !a.ReleasedAt.Equal(*b.ReleasedAt) {
+			return a.ReleasedAt.Before(*b.ReleasedAt)
+		}
+
+		return a.Key < b.Key
+	})
+
+	if limit != nil && int64(len(uploads)) > *limit {
+		uploads = uploads[:*limit]
+	}
+
+	return uploads, nil
+}
+
+// DeleteUpload удаляет запись о файле, если на него по-прежнему нет ссылок; false - запись не удалена
+func (m *Memory) DeleteUpload(ctx context.Context, key string) (bool, error) {
+	m.lock()
+	defer m.unlock()
+
+	upload, ok := m.uploads[key]
+	if !ok || upload.ReleasedAt == nil || m.isUploadReferenced(key) {
+		return false, nil
+	}
+
+	delete(m.uploads, key)
+	return true, nil
+}
@@ -0,0 +1,227 @@
+package memory
+
+import (
+	"service/internal/models"
+
+	"context"
+	"errors"
+	"fmt"
+)
+
+// USER
+
+func (m *Memory) user(userId string) *models.User {
+	stored, ok := m.users[userId]
+	if !ok {
+		return nil
+	}
+
+	copied := *stored
+	copied.Location = copyLocation(stored.Location)
+	return &copied
+}
+
+// CreateUser возвращает nil, если пользователь с таким email уже есть
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	if _, ok := m.userByEmail[user.Email]; ok {
+		return nil, nil
+	}
+
+	now := m.now()
+	stored := &models.User{
+		UserId:       newId(),
+		UserName:     user.UserName,
+		HashPassword: user.HashPassword,
+		Email:        user.Email,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	m.users[stored.UserId] = stored
+	m.userByEmail[stored.Email] = stored.UserId
+
+	return m.user(stored.UserId), nil
+}
+
+func (m *Memory) SelectUserByEmail(ctx context.Context, user *models.User) (*models.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	userId, ok := m.userByEmail[user.Email]
+	if !ok {
+		return nil, nil
+	}
+
+	return m.user(userId), nil
+}
+
+func (m *Memory) SelectUserById(ctx context.Context, user *models.User) (*models.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	return m.user(user.UserId), nil
+}
+
+func (m *Memory) UpdateUserLocation(ctx context.Context, userId string, location *models.Location) (*models.User, error) {
+	m.lock()
+	defer m.unlock()
+
+	stored, ok := m.users[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	stored.Location = copyLocation(location)
+	stored.UpdatedAt = m.now()
+
+	return m.user(userId), nil
+}
+
+// REVIEW
+
+// InsertReview возвращает nil, если отзыв на этот обмен уже оставлен
+func (m *Memory) InsertReview(ctx context.Context, review *models.Review) (*models.Review, error) {
+	const op = "Memory.InsertReview"
+
+	if review.ReviewerId == review.UserId {
+		return nil, fmt.Errorf("%s, %w", op, errors.New("reviewer is the reviewed user"))
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	key := reviewKey{exchangeId: review.ExchangeId, reviewerId: review.ReviewerId}
+	if _, ok := m.reviews[key]; ok {
+		return nil, nil
+	}
+
+	now := m.now()
+	stored := &models.Review{
+		ExchangeId: review.ExchangeId,
+		ReviewerId: review.ReviewerId,
+		UserId:     review.UserId,
+		Rating:     review.Rating,
+		Comment:    review.Comment,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	m.reviews[key] = stored
+
+	copied := *stored
+	return &copied, nil
+}
+
+// SelectReviewsByUserId - сначала новые отзывы, курсор - exchange_id первого отзыва следующей страницы
+func (m *Memory) SelectReviewsByUserId(ctx context.Context, userId string, cursor *string, limit int64) ([]models.Review, *string, error) {
+	m.lock()
+	defer m.unlock()
+
+	after := func(a *models.Review, b *models.Review) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+
+		return a.ExchangeId > b.ExchangeId
+	}
+
+	var from *models.Review
+	if cursor != nil {
+		for _, review := range m.reviews {
+			if review.UserId == userId && review.ExchangeId == *cursor {
+				from = review
+			}
+		}
+
+		if from == nil {
+			return make([]models.Review, 0), nil, nil
+		}
+	}
+
+	reviews := make([]models.Review, 0)
+	for _, review := range m.reviews {
+		if review.UserId != userId || (from != nil && after(review, from)) {
+			continue
+		}
+
+		reviews = append(reviews, *review)
+	}
+
+	sortSlice(reviews, after)
+
+	var nextCursor *string = nil
+	if int64(len(reviews)) > limit {
+		nextCursor = strPtr(reviews[limit].ExchangeId)
+		reviews = reviews[:limit]
+	}
+
+	return reviews, nextCursor, nil
+}
+
+func (m *Memory) SelectUserRating(ctx context.Context, userId string) (*models.UserRating, error) {
+	m.lock()
+	defer m.unlock()
+
+	rating := m.userRating(userId)
+	return &rating, nil
+}
+
+// BLOCK
+
+func (m *Memory) InsertUserReport(ctx context.Context, report *models.UserReport) (*models.UserReport, error) {
+	const op = "Memory.InsertUserReport"
+
+	if report.ReporterId == report.UserId {
+		return nil, fmt.Errorf("%s, %w", op, errors.New("reporter is the reported user"))
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	stored := &models.UserReport{
+		ReportId:   newId(),
+		ReporterId: report.ReporterId,
+		UserId:     report.UserId,
+		Reason:     report.Reason,
+		CreatedAt:  m.now(),
+	}
+
+	m.reports = append(m.reports, stored)
+
+	copied := *stored
+	return &copied, nil
+}
+
+// InsertUserBlock не считает ошибкой повторную блокировку
+func (m *Memory) InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	const op = "Memory.InsertUserBlock"
+
+	if userId == blockedUserId {
+		return fmt.Errorf("%s, %w", op, errors.New("user blocks themself"))
+	}
+
+	m.lock()
+	defer m.unlock()
+
+	m.blocks[blockKey{userId: userId, blockedUserId: blockedUserId}] = struct{}{}
+	return nil
+}
+
+func (m *Memory) DeleteUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	m.lock()
+	defer m.unlock()
+
+	delete(m.blocks, blockKey{userId: userId, blockedUserId: blockedUserId})
+	return nil
+}
+
+// HasUserBlock - хотя бы один из пользователей заблокировал другого
+func (m *Memory) HasUserBlock(ctx context.Context, userId1 string, userId2 string) (bool, error) {
+	m.lock()
+	defer m.unlock()
+
+	return m.isBlocked(userId1, userId2), nil
+}
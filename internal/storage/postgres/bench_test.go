@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+	"service/migrations"
+
+	"context"
+	"testing"
+	"time"
+)
+
+// BenchmarkSelectToyById сравнивает подготовку запроса на каждый вызов, как было раньше,
+// с запросом, подготовленным один раз при старте
+func BenchmarkSelectToyById(b *testing.B) {
+	db := openTestDB(b)
+
+	migrator, err := newMigrator(db, migrations.FS)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		b.Fatalf("Up: %v", err)
+	}
+
+	defer func() {
+		if _, err := migrator.Down(ctx, len(applied)); err != nil {
+			b.Errorf("Down: %v", err)
+		}
+	}()
+
+	stmts, err := newStatements(ctx, db, kPreparedQueries)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer stmts.close()
+
+	s := &Postgres{db: db, cnf: &config.ConfigPostgres{Timeout: 5 * time.Second}, stmts: stmts}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO users (user_id, first_name, last_name, email, password_hash)
+		VALUES ('bench_user', 'Bench', 'User', 'bench@example.com', 'hash')
+	`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	toy, err := s.InsertToy(ctx, &models.Toy{
+		UserId:           "bench_user",
+		Name:             "Bench toy",
+		IdempotencyToken: "bench_toy",
+		Status:           models.KCreatedToyStatus,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("prepare per call", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stmt, err := db.PrepareContext(ctx, kSelectToyById)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			_, err = getToy(stmt.QueryRowContext(ctx, toy.ToyId))
+			stmt.Close()
+
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("prepared once", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.SelectToyById(ctx, toy.ToyId); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// exchangeTx реализует exchange.Tx поверх открытой транзакции
+type exchangeTx struct {
+	ctx context.Context
+	tx  *preparedTx
+}
+
+func (t *exchangeTx) LockToys(toyIds []string) error {
+	rows, err := t.tx.QueryContext(t.ctx, kLockToys, pq.Array(toyIds))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// строки блокируются по мере чтения
+	for rows.Next() {
+	}
+
+	return rows.Err()
+}
+
+func (t *exchangeTx) LockExchange(exchangeId string) (*models.Exchange, error) {
+	var exchange models.Exchange
+	err := t.tx.QueryRowContext(t.ctx, kSelectExchangeForUpdate, exchangeId).Scan(
+		&exchange.ExchangeId,
+		&exchange.SrcToyId,
+		&exchange.DstToyId,
+		&exchange.Status,
+		&exchange.IdempotencyToken,
+		&exchange.CreatedAt,
+		&exchange.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &exchange, nil
+}
+
+func (t *exchangeTx) SelectExchangeDetails(exchangeId string) ([]models.ExchangeDetails, error) {
+	rows, err := t.tx.QueryContext(t.ctx, kSelectExchangeDetails, exchangeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := make([]models.ExchangeDetails, 0, 2)
+	for rows.Next() {
+		var participant models.ExchangeDetails
+
+		err := rows.Scan(
+			&participant.ExchangeId,
+			&participant.ToyId,
+			&participant.UserId,
+			&participant.Status,
+			&participant.CreatedAt,
+			&participant.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		details = append(details, participant)
+	}
+
+	return details, rows.Err()
+}
+
+func (t *exchangeTx) SelectOpenExchangeIds(toyIds []string) ([]string, error) {
+	rows, err := t.tx.QueryContext(t.ctx, kSelectOpenExchangeIds, pq.Array(toyIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exchangeIds := make([]string, 0)
+	for rows.Next() {
+		var exchangeId string
+		if err := rows.Scan(&exchangeId); err != nil {
+			return nil, err
+		}
+
+		exchangeIds = append(exchangeIds, exchangeId)
+	}
+
+	return exchangeIds, rows.Err()
+}
+
+func (t *exchangeTx) UpdateExchangeStatus(exchangeId string, status models.ExchangeStatus) error {
+	_, err := t.tx.ExecContext(t.ctx, kUpdateExchangeStatusById, exchangeId, status)
+	return err
+}
+
+func (t *exchangeTx) UpdateExchangeDetailsStatus(exchangeId string, userId string, status models.ExchangeDetailsStatus) error {
+	_, err := t.tx.ExecContext(t.ctx, kUpdateExchangeStatus, exchangeId, userId, status)
+	return err
+}
+
+func (t *exchangeTx) TransferToy(toyId string, userId string, exchangeId string) error {
+	if _, err := t.tx.ExecContext(t.ctx, kTransferToy, toyId, userId); err != nil {
+		return err
+	}
+
+	if _, err := t.tx.ExecContext(t.ctx, kReleaseToyOwnership, toyId); err != nil {
+		return err
+	}
+
+	_, err := t.tx.ExecContext(t.ctx, kInsertToyOwnership, toyId, userId, exchangeId)
+	return err
+}
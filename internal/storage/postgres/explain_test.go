@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"service/internal/models"
+	"service/migrations"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seqScans возвращает таблицы, которые план читает последовательным сканированием
+func seqScans(plan map[string]any) []string {
+	var tables []string
+	if plan["Node Type"] == "Seq Scan" {
+		tables = append(tables, fmt.Sprint(plan["Relation Name"]))
+	}
+
+	children, _ := plan["Plans"].([]any)
+	for _, child := range children {
+		if childPlan, ok := child.(map[string]any); ok {
+			tables = append(tables, seqScans(childPlan)...)
+		}
+	}
+
+	return tables
+}
+
+// TestListQueriesUseIndexes проверяет, что для каждого варианта списочных запросов есть индексы.
+// В пустой базе планировщик и так выбирает Seq Scan, поэтому он запрещается через enable_seqscan:
+// если Seq Scan все равно остался, подходящего индекса нет
+func TestListQueriesUseIndexes(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := newMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// база остается такой, какой была до теста
+	defer func() {
+		if _, err := migrator.Down(ctx, len(applied)); err != nil {
+			t.Errorf("Down: %v", err)
+		}
+	}()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET enable_seqscan = off"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "RESET enable_seqscan")
+
+	text, age := "мишка", 5
+	role, counterparty, toyId := models.KRoleRecipient, "user_2", "toy_1"
+	cursorValue := "2024-01-01 00:00:00"
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	byCreated := &models.ToysSort{Field: models.KSortCreatedAt, Direction: models.KSortDesc}
+	byUpdated := &models.ExchangesSort{Field: models.KSortUpdatedAt, Direction: models.KSortDesc}
+
+	toysCases := []struct {
+		name   string
+		query  models.QueryToys
+		sort   *models.ToysSort
+		cursor *models.Keyset
+	}{
+		{name: "default", sort: byCreated},
+		{name: "cursor", sort: byCreated, cursor: &models.Keyset{Value: &cursorValue, Id: "toy_1"}},
+		{name: "updated_at", sort: &models.ToysSort{Field: models.KSortUpdatedAt, Direction: models.KSortAsc}},
+		{name: "name", sort: &models.ToysSort{Field: models.KSortName, Direction: models.KSortAsc}},
+		{name: "statuses", sort: byCreated, query: models.QueryToys{Statuses: []string{string(models.KCreatedToyStatus)}}},
+		{name: "user_ids", sort: byCreated, query: models.QueryToys{UserIds: []string{"user_1"}}},
+		{name: "exclude_user_ids", sort: byCreated, query: models.QueryToys{ExcludeUserIds: []string{"user_1"}}},
+		{name: "category_ids", sort: byCreated, query: models.QueryToys{CategoryIds: []string{"games"}}},
+		{name: "tags", sort: byCreated, query: models.QueryToys{Tags: []string{"lego"}}},
+		{name: "age", sort: byCreated, query: models.QueryToys{Age: &age}},
+		{name: "conditions", sort: byCreated, query: models.QueryToys{Conditions: []string{string(models.KNewToyCondition)}}},
+		{name: "text", sort: &models.ToysSort{Field: models.KSortRelevance, Direction: models.KSortDesc}, query: models.QueryToys{Text: &text}},
+		{name: "near", sort: &models.ToysSort{Field: models.KSortDistance, Direction: models.KSortAsc}, query: models.QueryToys{
+			Near: &models.QueryNear{Lat: 55.75, Lon: 37.61, RadiusKm: 10},
+		}},
+	}
+
+	type explainCase struct {
+		name   string
+		query  string
+		params []interface{}
+	}
+
+	var cases []explainCase
+	for _, tc := range toysCases {
+		built, err := buildToysListQuery(&tc.query, "user_1", tc.sort, tc.cursor, 20)
+		if err != nil {
+			t.Fatalf("toys/%s: %v", tc.name, err)
+		}
+
+		cases = append(cases,
+			explainCase{name: "toys/" + tc.name, query: built.page, params: built.pageParams},
+			explainCase{name: "toys/" + tc.name + "/total", query: built.filtered, params: built.filteredParams},
+		)
+	}
+
+	exchangeCases := []struct {
+		name   string
+		query  models.QueryExchanges
+		cursor *models.Keyset
+	}{
+		{name: "default"},
+		{name: "cursor", cursor: &models.Keyset{Value: &cursorValue, Id: "exchange_1"}},
+		{name: "statuses", query: models.QueryExchanges{Statuses: []string{string(models.KCreatedExchangeStatus)}}},
+		{name: "role", query: models.QueryExchanges{Role: &role}},
+		{name: "counterparty", query: models.QueryExchanges{CounterpartyId: &counterparty}},
+		{name: "toy", query: models.QueryExchanges{ToyId: &toyId}},
+		{name: "dates", query: models.QueryExchanges{CreatedAt: &models.QueryDateRange{From: &since}}},
+		{name: "awaiting_my_action", query: models.QueryExchanges{AwaitingMyAction: true}},
+	}
+
+	for _, tc := range exchangeCases {
+		built, err := buildExchangeListQuery(&tc.query, "user_1", byUpdated, tc.cursor, 20)
+		if err != nil {
+			t.Fatalf("exchanges/%s: %v", tc.name, err)
+		}
+
+		cases = append(cases,
+			explainCase{name: "exchanges/" + tc.name, query: built.page, params: built.pageParams},
+			explainCase{name: "exchanges/" + tc.name + "/total", query: built.filtered, params: built.filteredParams},
+		)
+	}
+
+	cases = append(cases,
+		explainCase{
+			name:   "messages",
+			query:  kSelectExchangeMessages + "ORDER BY m.created_at, m.message_id LIMIT $2",
+			params: []interface{}{"exchange_1", 21},
+		},
+		explainCase{
+			name:   "reviews",
+			query:  kSelectReviewsByUserId + "ORDER BY r.created_at DESC, r.exchange_id DESC LIMIT $2",
+			params: []interface{}{"user_1", 21},
+		},
+		explainCase{
+			name:   "toy_history",
+			query:  kSelectToyOwnershipHistory,
+			params: []interface{}{"toy_1"},
+		},
+	)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var raw []byte
+			if err := conn.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+tc.query, pqArgs(tc.params)...).Scan(&raw); err != nil {
+				t.Fatalf("EXPLAIN: %v", err)
+			}
+
+			var plans []struct {
+				Plan map[string]any `json:"Plan"`
+			}
+			if err := json.Unmarshal(raw, &plans); err != nil || len(plans) == 0 {
+				t.Fatalf("unexpected plan %s: %v", raw, err)
+			}
+
+			if tables := seqScans(plans[0].Plan); len(tables) > 0 {
+				t.Errorf("sequential scan on %v:\n%s", tables, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+// Интеграционные тесты хранилища на временном кластере из pgtest: SQL, ограничения схемы и pg_notify
+// проверяются на настоящем Postgres. Здесь же единственный запуск набора storagetest для обоих драйверов.
+// Без установленного postgres тесты пропускаются
+package integration
+
+import (
+	"service/internal/config"
+	"service/internal/models"
+	"service/internal/service"
+	"service/internal/storage/postgres"
+	"service/internal/storage/postgres/pgtest"
+	"service/internal/storage/storagetest"
+	"service/migrations"
+
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	server   *pgtest.Server
+	startErr error
+)
+
+func TestMain(m *testing.M) {
+	server, startErr = pgtest.Start()
+	if startErr == nil {
+		startErr = migrate()
+	}
+
+	code := m.Run()
+
+	if server != nil {
+		server.Stop()
+	}
+
+	os.Exit(code)
+}
+
+func migrate() error {
+	migrator, err := postgres.NewMigrator(&config.ConfigPostgres{Dsn: server.Dsn}, migrations.FS)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
+
+// node - хранилище одного из драйверов
+type node interface {
+	service.Storage
+	Close() error
+}
+
+type driver struct {
+	name string
+	open func(cnf *config.ConfigPostgres) (node, error)
+}
+
+var kDrivers = []driver{
+	{"postgres", func(cnf *config.ConfigPostgres) (node, error) { return postgres.New(cnf) }},
+	{postgres.KDriverPgx, func(cnf *config.ConfigPostgres) (node, error) { return postgres.NewPgx(cnf) }},
+}
+
+// forEachDriver запускает fn для хранилищ обоих драйверов на временном кластере
+func forEachDriver(t *testing.T, fn func(t *testing.T, storage service.Storage)) {
+	if errors.Is(startErr, pgtest.ErrUnavailable) {
+		t.Skip(startErr)
+	}
+
+	if startErr != nil {
+		t.Fatal(startErr)
+	}
+
+	cnf := &config.ConfigPostgres{
+		Dsn:          server.Dsn,
+		MaxOpenConns: 8,
+		MaxIdleConns: 8,
+		MaxIdleTime:  time.Minute,
+		Timeout:      10 * time.Second,
+	}
+
+	for _, d := range kDrivers {
+		t.Run(d.name, func(t *testing.T) {
+			storage, err := d.open(cnf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+
+			fn(t, storage)
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	forEachDriver(t, storagetest.Run)
+}
+
+// TestConcurrentConfirmations - две сделки с одной игрушкой подтверждаются одновременно.
+// Завершиться может только одна, вторая проваливается, у игрушки остается один владелец.
+// Каждый вызов заканчивается без ошибки или с ErrExchangeConflict, но не ошибкой Postgres
+func TestConcurrentConfirmations(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storage service.Storage) {
+		ctx := context.Background()
+
+		for round := 0; round < 5; round++ {
+			bob := storagetest.NewUser(t, storage)
+			contested := storagetest.NewToy(t, storage, bob.UserId, "Юла")
+
+			offers := make([]*models.Exchange, 0, 2)
+			offerers := make([]*models.User, 0, 2)
+			for i := 0; i < 2; i++ {
+				user := storagetest.NewUser(t, storage)
+				exchange := storagetest.NewExchange(t, storage, storagetest.NewToy(t, storage, user.UserId, "Мяч"), contested)
+
+				storagetest.SetStatus(t, storage, exchange.ExchangeId, user.UserId, models.KConfirm1ExchangeDetailsStatus)
+				storagetest.SetStatus(t, storage, exchange.ExchangeId, bob.UserId, models.KConfirm1ExchangeDetailsStatus)
+				storagetest.SetStatus(t, storage, exchange.ExchangeId, user.UserId, models.KConfirm2ExchangeDetailsStatus)
+
+				offers = append(offers, exchange)
+				offerers = append(offerers, user)
+			}
+
+			// последнее подтверждение bob в обеих сделках одновременно
+			errs := make([]error, len(offers))
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i, exchange := range offers {
+				wg.Add(1)
+				go func(i int, exchangeId string) {
+					defer wg.Done()
+					<-start
+
+					_, errs[i] = storage.UpdateExchangeWithParticipants(ctx, exchangeId, bob.UserId, models.KConfirm2ExchangeDetailsStatus)
+				}(i, exchange.ExchangeId)
+			}
+
+			close(start)
+			wg.Wait()
+
+			for _, err := range errs {
+				if err != nil && !errors.Is(err, models.ErrExchangeConflict) {
+					t.Fatalf("round %d: concurrent confirm_2: %v, want nil or ErrExchangeConflict", round, err)
+				}
+			}
+
+			winner := -1
+			for i, exchange := range offers {
+				status, _ := storagetest.ExchangeStatus(t, storage, exchange.ExchangeId)
+				switch status {
+				case models.KSuccessExchangeStatus:
+					if winner != -1 {
+						t.Fatalf("round %d: both exchanges of toy %s succeeded", round, contested.ToyId)
+					}
+					winner = i
+				case models.KFailedExchangeStatus:
+				default:
+					t.Fatalf("round %d: exchange %s is left in status %s", round, exchange.ExchangeId, status)
+				}
+			}
+
+			if winner == -1 {
+				t.Fatalf("round %d: no exchange of toy %s succeeded", round, contested.ToyId)
+			}
+
+			toy, err := storage.SelectToyById(ctx, contested.ToyId)
+			if err != nil || toy == nil || toy.UserId != offerers[winner].UserId {
+				t.Fatalf("round %d: toy owner = %v, %v, want %s", round, toy, err, offerers[winner].UserId)
+			}
+
+			history, err := storage.SelectToyOwnershipHistory(ctx, contested.ToyId)
+			if err != nil || len(history) != 2 || history[0].ReleasedAt == nil || history[1].ReleasedAt != nil {
+				t.Fatalf("round %d: ownership history = %+v, %v, want bob then the winner", round, history, err)
+			}
+		}
+	})
+}
+
+// TestConcurrentExchangeOffers - одновременные предложения по одной паре игрушек: проходит одно,
+// остальные получают ErrExchangeExists от уникального индекса
+func TestConcurrentExchangeOffers(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storage service.Storage) {
+		src := storagetest.NewToy(t, storage, storagetest.NewUser(t, storage).UserId, "Мяч")
+		dst := storagetest.NewToy(t, storage, storagetest.NewUser(t, storage).UserId, "Юла")
+
+		const offers = 4
+		errs := make([]error, offers)
+
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < offers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+
+				// половина предложений в обратную сторону
+				if i%2 == 0 {
+					_, errs[i] = storagetest.InsertExchange(t, storage, src, dst)
+				} else {
+					_, errs[i] = storagetest.InsertExchange(t, storage, dst, src)
+				}
+			}(i)
+		}
+
+		close(start)
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, models.ErrExchangeExists):
+				t.Errorf("InsertExchange: %v, want ErrExchangeExists", err)
+			}
+		}
+
+		if created != 1 {
+			t.Errorf("%d exchanges created for one pair of toys, want 1", created)
+		}
+	})
+}
+
+// TestListenEvents - события из триггеров pg_notify доходят до ListenEvents
+func TestListenEvents(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, storage service.Storage) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		events := make(chan models.Event, 64)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			storage.ListenEvents(ctx, func(event models.Event) { events <- event })
+		}()
+
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		alice := storagetest.NewUser(t, storage)
+		bob := storagetest.NewUser(t, storage)
+		exchange := storagetest.NewExchange(t, storage,
+			storagetest.NewToy(t, storage, alice.UserId, "Мяч"),
+			storagetest.NewToy(t, storage, bob.UserId, "Юла"))
+
+		// LISTEN выполняется в горутине: сообщения отправляются, пока первое из них не дойдет
+		ready := false
+		deadline := time.After(10 * time.Second)
+		for !ready {
+			if _, err := storage.InsertExchangeMessage(ctx, &models.ExchangeMessage{
+				ExchangeId:       exchange.ExchangeId,
+				UserId:           alice.UserId,
+				Text:             "Привет",
+				IdempotencyToken: uuid.NewString(),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case event := <-events:
+				ready = event.Type == models.KExchangeMessageEvent && event.ExchangeId == exchange.ExchangeId
+			case <-time.After(100 * time.Millisecond):
+			case <-deadline:
+				t.Fatal("listener did not receive message events")
+			}
+		}
+
+		if _, err := storage.UpdateExchangeWithParticipants(ctx, exchange.ExchangeId, bob.UserId, models.KFailedExchangeDetailsStatus); err != nil {
+			t.Fatal(err)
+		}
+
+		// до события о провале могут дойти события о сообщениях, отправленных раньше
+		for {
+			select {
+			case event := <-events:
+				if event.ExchangeId != exchange.ExchangeId || event.Type != models.KExchangeStatusEvent {
+					continue
+				}
+
+				if event.Status != string(models.KFailedExchangeStatus) || len(event.UserIds) != 2 {
+					t.Errorf("status event = %+v, want failed for both participants", event)
+				}
+
+				return
+			case <-time.After(10 * time.Second):
+				t.Fatal("exchange status event was not delivered")
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"service/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	kExchangeEventsChannel = "exchange_events"
+	kListenerMinReconnect  = 1 * time.Second
+	kListenerMaxReconnect  = 30 * time.Second
+	kListenerPingInterval  = 90 * time.Second
+)
+
+// ListenEvents подписывается на pg_notify из триггеров обмена и передает события в handler.
+// Каждый экземпляр сервиса держит свое соединение, поэтому события доходят до пользователей на любом инстансе.
+// Блокируется до отмены ctx.
+func (s *Postgres) ListenEvents(ctx context.Context, handler func(models.Event)) error {
+	const op = "Postgres.ListenEvents"
+
+	listener := pq.NewListener(connString(s.cnf), kListenerMinReconnect, kListenerMaxReconnect, nil)
+	defer listener.Close()
+
+	if err := listener.Listen(kExchangeEventsChannel); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ticker := time.NewTicker(kListenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case notification := <-listener.Notify:
+			// nil приходит после переподключения, пропущенные уведомления не восстанавливаются
+			if notification == nil {
+				continue
+			}
+
+			var event models.Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				continue
+			}
+
+			handler(event)
+
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
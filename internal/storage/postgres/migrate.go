@@ -0,0 +1,432 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"service/internal/config"
+
+	// database/sql драйвер "pgx", чтобы миграции работали с любым postgres.driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	// ключ pg_advisory_lock, чтобы два инстанса не применяли миграции одновременно
+	kMigrationsLockKey = 7_240_001
+
+	kCreateSchemaMigrations = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+	kSelectSchemaMigrations = `SELECT version, name, applied_at FROM schema_migrations ORDER BY version;`
+	kInsertSchemaMigration  = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2);`
+	kDeleteSchemaMigration  = `DELETE FROM schema_migrations WHERE version = $1;`
+	// схема baseline (create_entity.sql) создавалась целиком, поэтому достаточно проверить ее последнюю таблицу
+	kSelectBaselineSchema = `SELECT to_regclass('exchange_details') IS NOT NULL;`
+)
+
+var kMigrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration - пара скриптов NNNN_name.up.sql / NNNN_name.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - миграция и время ее применения, AppliedAt = nil - не применена.
+// Missing - миграция применена, но ее файлов нет в бинарнике (база новее кода)
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Missing   bool
+}
+
+// LoadMigrations читает миграции из корня source и сортирует их по версии
+func LoadMigrations(source fs.FS) ([]Migration, error) {
+	const op = "LoadMigrations"
+
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := kMigrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %s: %w", op, entry.Name(), err)
+		}
+
+		data, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%s, version %d has two names: %s and %s", op, version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%s, migration %d_%s must have both up and down scripts", op, migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator применяет и откатывает миграции, примененные версии хранятся в schema_migrations.
+// Каждая миграция выполняется в своей транзакции вместе с записью в schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(cnf *config.ConfigPostgres, source fs.FS) (*Migrator, error) {
+	const op = "NewMigrator"
+
+	db, err := sql.Open(cnf.Driver, connString(cnf))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	migrator, err := newMigrator(db, source)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return migrator, nil
+}
+
+func newMigrator(db *sql.DB, source fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// withLock выполняет fn на одном соединении под advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", kMigrationsLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", kMigrationsLockKey)
+
+	if _, err := conn.ExecContext(ctx, kCreateSchemaMigrations); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func selectApplied(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, kSelectSchemaMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]MigrationStatus, 0)
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		status.AppliedAt = &appliedAt
+		applied = append(applied, status)
+	}
+
+	return applied, rows.Err()
+}
+
+// run выполняет скрипт миграции и меняет schema_migrations в одной транзакции
+func run(ctx context.Context, conn *sql.Conn, migration *Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	// без параметров lib/pq отправляет простой запрос, поэтому в скрипте может быть несколько команд
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, kInsertSchemaMigration, migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, kDeleteSchemaMigration, migration.Version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up применяет все непримененные миграции по возрастанию версии и возвращает примененные
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	const op = "Migrator.Up"
+
+	done := make([]Migration, 0)
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := selectApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make(map[int64]struct{}, len(applied))
+		for _, status := range applied {
+			versions[status.Version] = struct{}{}
+		}
+
+		for i := range m.migrations {
+			if _, ok := versions[m.migrations[i].Version]; ok {
+				continue
+			}
+
+			if err := run(ctx, conn, &m.migrations[i], true); err != nil {
+				return err
+			}
+
+			done = append(done, m.migrations[i])
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return done, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return done, nil
+}
+
+// Down откатывает steps последних примененных миграций и возвращает откаченные
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	const op = "Migrator.Down"
+
+	byVersion := make(map[int64]*Migration, len(m.migrations))
+	for i := range m.migrations {
+		byVersion[m.migrations[i].Version] = &m.migrations[i]
+	}
+
+	done := make([]Migration, 0)
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := selectApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+			migration, ok := byVersion[applied[i].Version]
+			if !ok {
+				return fmt.Errorf("applied migration %d_%s has no scripts", applied[i].Version, applied[i].Name)
+			}
+
+			if err := run(ctx, conn, migration, false); err != nil {
+				return err
+			}
+
+			done = append(done, *migration)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return done, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return done, nil
+}
+
+// Redo откатывает и заново применяет последнюю примененную миграцию, nil - нет примененных
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	const op = "Migrator.Redo"
+
+	var redone *Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := selectApplied(ctx, conn)
+		if err != nil || len(applied) == 0 {
+			return err
+		}
+
+		last := applied[len(applied)-1]
+		for i := range m.migrations {
+			if m.migrations[i].Version == last.Version {
+				redone = &m.migrations[i]
+			}
+		}
+
+		if redone == nil {
+			return fmt.Errorf("applied migration %d_%s has no scripts", last.Version, last.Name)
+		}
+
+		if err := run(ctx, conn, redone, false); err != nil {
+			return err
+		}
+
+		return run(ctx, conn, redone, true)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return redone, nil
+}
+
+// Baseline отмечает первую миграцию примененной, не выполняя ее: так база, созданная из create_entity.sql
+// до появления миграций, переходит на migrate up. Ошибка, если миграции уже применялись или схемы baseline нет
+func (m *Migrator) Baseline(ctx context.Context) (*Migration, error) {
+	const op = "Migrator.Baseline"
+
+	if len(m.migrations) == 0 {
+		return nil, fmt.Errorf("%s, no migrations", op)
+	}
+
+	first := &m.migrations[0]
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := selectApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(applied) > 0 {
+			return fmt.Errorf("migration %d_%s is already applied", applied[0].Version, applied[0].Name)
+		}
+
+		var exists bool
+		if err := conn.QueryRowContext(ctx, kSelectBaselineSchema).Scan(&exists); err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New("baseline schema is not found, run migrate up on an empty database")
+		}
+
+		_, err = conn.ExecContext(ctx, kInsertSchemaMigration, first.Version, first.Name)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return first, nil
+}
+
+// Status возвращает все известные миграции и примененные версии, которых нет среди файлов, по возрастанию версии
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	const op = "Migrator.Status"
+
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := selectApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		byVersion := make(map[int64]MigrationStatus, len(applied))
+		for _, status := range applied {
+			byVersion[status.Version] = status
+		}
+
+		statuses = make([]MigrationStatus, 0, len(m.migrations))
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if appliedStatus, ok := byVersion[migration.Version]; ok {
+				status.AppliedAt = appliedStatus.AppliedAt
+				delete(byVersion, migration.Version)
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		for _, status := range byVersion {
+			status.Missing = true
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
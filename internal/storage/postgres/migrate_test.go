@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"service/migrations"
+
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+// openTestDB подключается к базе из TEST_POSTGRES_DSN, без нее тест или бенчмарк пропускается
+func openTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	source := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("up 2")},
+		"0002_second.down.sql": {Data: []byte("down 2")},
+		"0001_first.up.sql":    {Data: []byte("up 1")},
+		"0001_first.down.sql":  {Data: []byte("down 1")},
+		"test_data.sql":        {Data: []byte("ignored")},
+	}
+
+	loaded, err := LoadMigrations(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 || loaded[0].Version != 1 || loaded[1].Version != 2 {
+		t.Fatalf("migrations are not sorted by version: %+v", loaded)
+	}
+
+	if loaded[1].Name != "second" || loaded[1].Up != "up 2" || loaded[1].Down != "down 2" {
+		t.Fatalf("unexpected migration: %+v", loaded[1])
+	}
+
+	delete(source, "0002_second.down.sql")
+	if _, err := LoadMigrations(source); err == nil {
+		t.Fatal("migration without down script must be rejected")
+	}
+}
+
+// TestMigrationsUpDown применяет все миграции к пустой базе и откатывает их.
+// Нужна пустая база: TEST_POSTGRES_DSN="host=localhost user=postgres dbname=test sslmode=disable"
+func TestMigrationsUpDown(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := newMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	total := len(migrator.migrations)
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	if len(applied) != total {
+		t.Fatalf("Up applied %d of %d migrations, database is not empty?", len(applied), total)
+	}
+
+	if applied, err = migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("second Up = %d migrations, %v; want nothing to apply", len(applied), err)
+	}
+
+	if _, err := migrator.Redo(ctx); err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.Missing {
+			t.Fatalf("migration %d_%s is not applied after Up", status.Version, status.Name)
+		}
+	}
+
+	rolledBack, err := migrator.Down(ctx, total)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+
+	if len(rolledBack) != total {
+		t.Fatalf("Down rolled back %d of %d migrations", len(rolledBack), total)
+	}
+
+	var tables int
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_name <> 'schema_migrations'
+	`).Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tables != 0 {
+		t.Fatalf("%d tables left after rolling back all migrations", tables)
+	}
+}
+
+// TestMigrationsFromBaseline - база, созданная из create_entity.sql, после migrate baseline доходит
+// до последней версии, а фотография из photo_url становится фотографией игрушки
+func TestMigrationsFromBaseline(t *testing.T) {
+	db := openTestDB(t)
+
+	migrator, err := newMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	total := len(migrator.migrations)
+
+	if _, err := migrator.Baseline(ctx); err == nil {
+		t.Fatal("Baseline of an empty database must fail")
+	}
+
+	if _, err := db.ExecContext(ctx, migrator.migrations[0].Up); err != nil {
+		t.Fatal(err)
+	}
+	defer migrator.Down(ctx, total)
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO users (user_id, first_name, last_name, email, password_hash)
+		VALUES ('baseline_user', 'Имя', 'Фамилия', 'baseline@example.com', 'hash');
+		INSERT INTO toys (toy_id, user_id, name, photo_url, idempotency_token)
+		VALUES ('baseline_toy', 'baseline_user', 'Мяч', 'http://0.0.0.0:5001/upload/ball.jpg', 'baseline_token');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrator.Baseline(ctx); err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil || len(applied) != total-1 {
+		t.Fatalf("Up after Baseline = %d migrations, %v; want %d", len(applied), err, total-1)
+	}
+
+	var key string
+	err = db.QueryRowContext(ctx, `SELECT full_key FROM toy_photos WHERE toy_id = 'baseline_toy' AND position = 0`).Scan(&key)
+	if err != nil || key != "ball.jpg" {
+		t.Fatalf("photo of a baseline toy = %q, %v; want ball.jpg", key, err)
+	}
+
+	if _, err := migrator.Baseline(ctx); err == nil {
+		t.Fatal("Baseline of a migrated database must fail")
+	}
+}
@@ -0,0 +1,194 @@
+// Package pgtest запускает временный кластер Postgres для интеграционных тестов: initdb во временном каталоге
+// и postgres на свободном порту. Нужны установленные initdb и postgres, кластер удаляется при Stop
+package pgtest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	kStartTimeout = 30 * time.Second
+	kStopTimeout  = 10 * time.Second
+	kLogFile      = "postgres.log"
+)
+
+// ErrUnavailable - Postgres в этом окружении не запустить, тесты с ним нужно пропустить
+var ErrUnavailable = errors.New("postgres binaries are not available")
+
+// kBinDirs - где искать initdb, если его нет в PATH: пакеты Debian и Ubuntu не добавляют его в PATH
+var kBinDirs = []string{
+	"/usr/lib/postgresql/*/bin",
+	"/usr/local/pgsql/bin",
+	"/opt/homebrew/opt/postgresql*/bin",
+}
+
+// Server - запущенный временный кластер. Dsn - подключение к базе postgres суперпользователем без пароля
+type Server struct {
+	Dsn string
+
+	dir string
+	cmd *exec.Cmd
+	// exited закрывается, когда процесс postgres завершился
+	exited chan struct{}
+}
+
+// binDir - каталог с initdb и postgres
+func binDir() (string, error) {
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(initdb), nil
+	}
+
+	for _, pattern := range kBinDirs {
+		matches, _ := filepath.Glob(filepath.Join(pattern, "initdb"))
+		if len(matches) > 0 {
+			// у нескольких версий берем последнюю по имени каталога
+			return filepath.Dir(matches[len(matches)-1]), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: initdb is not found", ErrUnavailable)
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Start создает кластер и ждет, пока он начнет принимать подключения.
+// ErrUnavailable, если initdb не найден или тесты запущены от root: postgres от root не запускается
+func Start() (*Server, error) {
+	const op = "pgtest.Start"
+
+	bin, err := binDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Geteuid() == 0 {
+		return nil, fmt.Errorf("%w: postgres cannot be run as root", ErrUnavailable)
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest")
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	data := filepath.Join(dir, "data")
+	initdb := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-locale")
+	if output, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s, initdb: %w\n%s", op, err, output)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	logFile, err := os.Create(filepath.Join(dir, kLogFile))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+	defer logFile.Close()
+
+	// fsync не нужен: кластер живет только до конца тестов
+	cmd := exec.Command(filepath.Join(bin, "postgres"),
+		"-D", data,
+		"-p", fmt.Sprint(port),
+		"-c", "listen_addresses=127.0.0.1",
+		"-c", "unix_socket_directories="+dir,
+		"-c", "fsync=off",
+		"-c", "synchronous_commit=off",
+		"-c", "full_page_writes=off",
+	)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	server := &Server{
+		Dsn:    fmt.Sprintf("host=127.0.0.1 port=%d user=postgres dbname=postgres sslmode=disable", port),
+		dir:    dir,
+		cmd:    cmd,
+		exited: make(chan struct{}),
+	}
+
+	go func() {
+		cmd.Wait()
+		close(server.exited)
+	}()
+
+	if err := server.waitReady(); err != nil {
+		log := server.log()
+		server.Stop()
+		return nil, fmt.Errorf("%s, %w\n%s", op, err, log)
+	}
+
+	return server, nil
+}
+
+func (s *Server) waitReady() error {
+	db, err := sql.Open("postgres", s.Dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deadline := time.Now().Add(kStartTimeout)
+	for {
+		select {
+		case <-s.exited:
+			return errors.New("postgres exited on start")
+		default:
+		}
+
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("postgres is not ready after %s: %w", kStartTimeout, err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (s *Server) log() string {
+	data, _ := os.ReadFile(filepath.Join(s.dir, kLogFile))
+	return string(data)
+}
+
+// Stop останавливает postgres (fast shutdown) и удаляет кластер
+func (s *Server) Stop() error {
+	s.cmd.Process.Signal(os.Interrupt)
+
+	select {
+	case <-s.exited:
+	case <-time.After(kStopTimeout):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,1191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"service/internal/config"
+	"service/internal/domain/exchange"
+	"service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	KDriverPgx = "pgx"
+)
+
+// kEnumTypes регистрируются на каждом соединении, чтобы enum и массивы enum
+// передавались как обычные строки и срезы строк. Сначала тип, затем массив из него
+var kEnumTypes = []string{
+	"toystatus", "_toystatus",
+	"toycondition", "_toycondition",
+	"exchangestatus", "_exchangestatus",
+	"exchangedetailsstatus", "_exchangedetailsstatus",
+}
+
+// Pgx - Storage поверх pgxpool. NULL читается сразу в указатели, массивы и json - в срезы и структуры,
+// запросы кэшируются pgx на каждом соединении, а запросы списка и total уходят в базу одним батчем
+type Pgx struct {
+	pool *pgxpool.Pool
+	cnf  *config.ConfigPostgres
+}
+
+func runInPgxTx[T any](ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) (T, error)) (T, error) {
+	var zero T
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return zero, err
+	}
+
+	object, err := fn(tx)
+	if err != nil {
+		tx.Rollback(ctx)
+		return zero, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return zero, err
+	}
+
+	return object, nil
+}
+
+func NewPgx(cnf *config.ConfigPostgres) (*Pgx, error) {
+	const op = "StoragePgx.New"
+
+	poolCnf, err := pgxpool.ParseConfig(connString(cnf))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cnf.MaxOpenConns > 0 {
+		poolCnf.MaxConns = int32(cnf.MaxOpenConns)
+	}
+	poolCnf.MaxConnIdleTime = cnf.MaxIdleTime
+	poolCnf.AfterConnect = registerEnumTypes
+
+	ctx, cancel := context.WithTimeout(context.Background(), cnf.Timeout)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCnf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Pgx{
+		pool: pool,
+		cnf:  cnf,
+	}, nil
+}
+
+func registerEnumTypes(ctx context.Context, conn *pgx.Conn) error {
+	for _, name := range kEnumTypes {
+		dataType, err := conn.LoadType(ctx, name)
+		if err != nil {
+			return fmt.Errorf("load type %s: %w", name, err)
+		}
+
+		conn.TypeMap().RegisterType(dataType)
+	}
+
+	return nil
+}
+
+// Ping проверяет, что база доступна
+func (s *Pgx) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return s.pool.Ping(ctx)
+}
+
+func (s *Pgx) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *Pgx) PoolStats() models.PoolStats {
+	stats := s.pool.Stat()
+
+	return models.PoolStats{
+		Driver:       KDriverPgx,
+		MaxConns:     int64(stats.MaxConns()),
+		TotalConns:   int64(stats.TotalConns()),
+		IdleConns:    int64(stats.IdleConns()),
+		InUseConns:   int64(stats.AcquiredConns()),
+		WaitCount:    stats.EmptyAcquireCount(),
+		WaitDuration: stats.AcquireDuration(),
+	}
+}
+
+func pgxLocation(lat *float64, lon *float64, city *string) *models.Location {
+	if lat == nil || lon == nil {
+		return nil
+	}
+
+	return &models.Location{Lat: *lat, Lon: *lon, City: city}
+}
+
+// scanPgxToy читает строку с колонками kToyColumns, extra - дополнительные колонки после них
+func scanPgxToy(row pgx.Row, extra ...any) (*models.Toy, error) {
+	var toy models.Toy
+	var lat, lon *float64
+	var city *string
+
+	dest := []any{
+		&toy.ToyId,
+		&toy.UserId,
+		&toy.Name,
+		&toy.Description,
+		&toy.IdempotencyToken,
+		&toy.Photos,
+		&toy.Status,
+		&toy.CreatedAt,
+		&toy.UpdatedAt,
+		&toy.CategoryId,
+		&toy.Tags,
+		&toy.AgeMin,
+		&toy.AgeMax,
+		&toy.Condition,
+		&lat,
+		&lon,
+		&city,
+	}
+
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if toy.Photos == nil {
+		toy.Photos = make([]models.ToyPhoto, 0)
+	}
+
+	toy.Location = pgxLocation(lat, lon, city)
+
+	return &toy, nil
+}
+
+func scanPgxUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	var lat, lon *float64
+	var city *string
+
+	err := row.Scan(
+		&user.UserId,
+		&user.UserName.FirstName,
+		&user.UserName.MiddleName,
+		&user.UserName.LastName,
+		&user.Email,
+		&user.HashPassword,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&lat,
+		&lon,
+		&city,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user.Location = pgxLocation(lat, lon, city)
+
+	return &user, nil
+}
+
+func scanPgxExchangeParticipant(row pgx.Row) (*models.ExchangeParticipant, error) {
+	var p models.ExchangeParticipant
+	var toyLat, toyLon *float64
+	var toyCity *string
+
+	err := row.Scan(
+		&p.ExchangeId,
+		&p.ExchangeStatus,
+		&p.IdempotencyToken,
+		&p.ExchangeCreatedAt,
+		&p.ExchangeUpdatedAt,
+
+		&p.ToyId,
+		&p.ToyName,
+		&p.ToyDescription,
+		&p.ToyPhotos,
+		&toyLat,
+		&toyLon,
+		&toyCity,
+		&p.ToyDistance,
+
+		&p.UserId,
+		&p.FirstName,
+		&p.MiddleName,
+		&p.LastName,
+		&p.UserRating.Average,
+		&p.UserRating.Count,
+
+		&p.UserExchangeStatus,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.ToyPhotos == nil {
+		p.ToyPhotos = make([]models.ToyPhoto, 0)
+	}
+
+	p.ToyLocation = pgxLocation(toyLat, toyLon, toyCity)
+
+	return &p, nil
+}
+
+// selectPgxToy возвращает nil, если игрушки нет
+func (s *Pgx) selectPgxToy(ctx context.Context, op string, query string, args ...any) (*models.Toy, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	dbToy, err := scanPgxToy(s.pool.QueryRow(ctx, query, args...))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return dbToy, nil
+}
+
+func (s *Pgx) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	return s.selectPgxToy(ctx, "Pgx.SelectToyById", kSelectToyById, toyId)
+}
+
+func (s *Pgx) SelectToyByUserId(ctx context.Context, toyId string, userId string) (*models.Toy, error) {
+	return s.selectPgxToy(ctx, "Pgx.SelectToyByUserId", kSelectToyByUserId, toyId, userId)
+}
+
+func (s *Pgx) SelectToyByToken(ctx context.Context, token string, userId string) (*models.Toy, error) {
+	return s.selectPgxToy(ctx, "Pgx.SelectToyByToken", kSelectToyByToken, token, userId)
+}
+
+// insertPgxToyPhoto добавляет фотографию в конец списка, models.ErrTooManyPhotos - если достигнут лимит
+func insertPgxToyPhoto(ctx context.Context, tx pgx.Tx, toyId string, photo *models.PhotoSet) error {
+	var photoId string
+	err := tx.QueryRow(
+		ctx,
+		kInsertToyPhoto,
+		toyId,
+		photo.Thumbnail,
+		photo.Medium,
+		photo.Full,
+		models.KMaxToyPhotos,
+	).Scan(&photoId)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ErrTooManyPhotos
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, kAttachUploads, toyId, photo.Keys())
+	return err
+}
+
+// insertPgxToyPhotos добавляет фотографии в конец списка и перечитывает игрушку
+func insertPgxToyPhotos(ctx context.Context, tx pgx.Tx, toy *models.Toy, photos []models.ToyPhoto) (*models.Toy, error) {
+	const op = "Pgx.insertToyPhotos"
+
+	for _, photo := range photos {
+		if err := insertPgxToyPhoto(ctx, tx, toy.ToyId, &photo.PhotoSet); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	dbToy, err := scanPgxToy(tx.QueryRow(ctx, kSelectToyById, toy.ToyId))
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return dbToy, nil
+}
+
+// UpdateToy заменяет поля игрушки, место меняется, только если оно передано; фотографии из newToy.Photos добавляются в конец списка
+func (s *Pgx) UpdateToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Pgx.UpdateToy"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	lat, lon, city := getLocationParams(newToy.Location)
+
+	return runInPgxTx(ctx, s.pool, func(tx pgx.Tx) (*models.Toy, error) {
+		dbToy, err := scanPgxToy(tx.QueryRow(
+			ctx,
+			kUpdateToy,
+			newToy.ToyId,
+			newToy.UserId,
+			newToy.Name,
+			newToy.Description,
+			newToy.CategoryId,
+			newToy.Tags,
+			newToy.AgeMin,
+			newToy.AgeMax,
+			newToy.Condition,
+			lat,
+			lon,
+			city,
+		))
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if len(newToy.Photos) == 0 {
+			return dbToy, nil
+		}
+
+		if dbToy.Status != models.KCreatedToyStatus {
+			return nil, fmt.Errorf("%s, %w", op, models.ErrToyNotEditable)
+		}
+
+		return insertPgxToyPhotos(ctx, tx, dbToy, newToy.Photos)
+	})
+}
+
+// InsertToy создает игрушку вместе с фотографиями из newToy.Photos и открывает историю владения
+func (s *Pgx) InsertToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Pgx.InsertToy"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	lat, lon, city := getLocationParams(newToy.Location)
+
+	return runInPgxTx(ctx, s.pool, func(tx pgx.Tx) (*models.Toy, error) {
+		var replayed bool
+		dbToy, err := scanPgxToy(tx.QueryRow(
+			ctx,
+			kInsertToy,
+			newToy.UserId,
+			newToy.Name,
+			newToy.Description,
+			newToy.IdempotencyToken,
+			newToy.Status,
+			newToy.CategoryId,
+			newToy.Tags,
+			newToy.AgeMin,
+			newToy.AgeMax,
+			newToy.Condition,
+			lat,
+			lon,
+			city,
+		), &replayed)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s, %w", op, models.ErrToyExists)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		// повтор с тем же idempotency_token возвращает игрушку без изменений; файлы повтора
+		// остаются освобожденными после InsertUploads и удаляются сборщиком
+		if replayed {
+			return dbToy, nil
+		}
+
+		if _, err := tx.Exec(ctx, kInsertToyOwnership, dbToy.ToyId, dbToy.UserId, nil); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if len(newToy.Photos) == 0 {
+			return dbToy, nil
+		}
+
+		return insertPgxToyPhotos(ctx, tx, dbToy, newToy.Photos)
+	})
+}
+
+// UpdateToyStatus меняет статус игрушки владельца; при удалении игрушки проваливаются ее незавершенные обмены
+// и освобождаются файлы ее фотографий
+func (s *Pgx) UpdateToyStatus(ctx context.Context, toyId string, userId string, status models.ToyStatus) (*models.Toy, error) {
+	const op = "Pgx.UpdateToyStatus"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, s.pool, func(tx pgx.Tx) (*models.Toy, error) {
+		dbToy, err := scanPgxToy(tx.QueryRow(ctx, kUpdateToyStatus, toyId, userId, status))
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if status == models.KRemovedToyStatus {
+			if err := exchange.RemoveToy(&pgxExchangeTx{ctx: ctx, tx: tx}, toyId); err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+
+			photos, err := selectPgxToyPhotos(ctx, tx, toyId)
+			if err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+
+			if _, err := tx.Exec(ctx, kReleaseUploads, models.PhotoKeys(photos)); err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+		}
+
+		return dbToy, nil
+	})
+}
+
+// sendListBatch отправляет запрос страницы и, если нужен total, запрос total одним батчем.
+// Результаты читаются в порядке очереди: сначала total, затем страница
+func (s *Pgx) sendListBatch(ctx context.Context, built *builtListQuery, withTotal *string) pgx.BatchResults {
+	batch := &pgx.Batch{}
+	if withTotal != nil {
+		batch.Queue(totalQuery(built.filtered, *withTotal), built.filteredParams...)
+	}
+	batch.Queue(built.page, built.pageParams...)
+
+	return s.pool.SendBatch(ctx, batch)
+}
+
+func (s *Pgx) SelectToysList(ctx context.Context, query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.Toy, *models.Keyset, *models.Total, error) {
+	const op = "Pgx.SelectToysList"
+
+	built, err := buildToysListQuery(query, userId, sort, cursor, limit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	results := s.sendListBatch(ctx, built, withTotal)
+	defer results.Close()
+
+	var total *models.Total = nil
+	if withTotal != nil {
+		if total, err = scanTotal(results.QueryRow(), *withTotal); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	rows, err := results.Query()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+	defer rows.Close()
+
+	dbToys := make([]models.Toy, 0)
+	for rows.Next() {
+		var score, distance *float64
+		var snippet *string
+
+		toy, err := scanPgxToy(rows, &score, &snippet, &distance)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		toy.Score = score
+		toy.Snippet = snippet
+		toy.Distance = distance
+
+		dbToys = append(dbToys, *toy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	var nextCursor *models.Keyset = nil
+	if int64(len(dbToys)) == limit+1 {
+		next := dbToys[len(dbToys)-1]
+		nextCursor = &models.Keyset{
+			Value: getToySortValue(&next, sort.Field),
+			Id:    next.ToyId,
+		}
+		dbToys = dbToys[:len(dbToys)-1]
+	}
+
+	return dbToys, nextCursor, total, nil
+}
+
+func (s *Pgx) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	const op = "Pgx.SelectCategories"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, kSelectCategories)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	categories, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Category, error) {
+		var category models.Category
+		err := row.Scan(&category.CategoryId, &category.ParentId, &category.Name)
+		return category, err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return categories, nil
+}
+
+// SelectToyOwnershipHistory - владельцы игрушки от создателя до текущего
+func (s *Pgx) SelectToyOwnershipHistory(ctx context.Context, toyId string) ([]models.ToyOwnership, error) {
+	const op = "Pgx.SelectToyOwnershipHistory"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, kSelectToyOwnershipHistory, toyId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ToyOwnership, error) {
+		var ownership models.ToyOwnership
+		err := row.Scan(&ownership.UserId, &ownership.ExchangeId, &ownership.AcquiredAt, &ownership.ReleasedAt)
+		return ownership, err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return history, nil
+}
+
+func selectPgxToyPhotos(ctx context.Context, tx pgx.Tx, toyId string) ([]models.ToyPhoto, error) {
+	rows, err := tx.Query(ctx, kSelectToyPhotos, toyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ToyPhoto, error) {
+		var photo models.ToyPhoto
+		err := row.Scan(&photo.PhotoId, &photo.Position, &photo.Thumbnail, &photo.Medium, &photo.Full)
+		return photo, err
+	})
+}
+
+// lockPgxToy блокирует игрушку владельца до конца транзакции, false - игрушки нет или она удалена
+func lockPgxToy(ctx context.Context, tx pgx.Tx, toyId string, userId string) (bool, error) {
+	var status models.ToyStatus
+	err := tx.QueryRow(ctx, kSelectToyForUpdate, toyId, userId).Scan(&status)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if status != models.KCreatedToyStatus {
+		return false, models.ErrToyNotEditable
+	}
+
+	return true, nil
+}
+
+// withLockedPgxToy выполняет fn над заблокированной игрушкой владельца и возвращает фотографии после изменения.
+// nil - игрушка не найдена у пользователя или fn вернула found = false
+func (s *Pgx) withLockedPgxToy(ctx context.Context, op string, toyId string, userId string, fn func(tx pgx.Tx) (bool, error)) ([]models.ToyPhoto, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, s.pool, func(tx pgx.Tx) ([]models.ToyPhoto, error) {
+		found, err := lockPgxToy(ctx, tx, toyId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		found, err = fn(tx)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		photos, err := selectPgxToyPhotos(ctx, tx, toyId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return photos, nil
+	})
+}
+
+// InsertToyPhoto возвращает nil, если игрушка не найдена у пользователя
+func (s *Pgx) InsertToyPhoto(ctx context.Context, toyId string, userId string, photo *models.PhotoSet) ([]models.ToyPhoto, error) {
+	return s.withLockedPgxToy(ctx, "Pgx.InsertToyPhoto", toyId, userId, func(tx pgx.Tx) (bool, error) {
+		return true, insertPgxToyPhoto(ctx, tx, toyId, photo)
+	})
+}
+
+// DeleteToyPhoto возвращает nil, если игрушка или фотография не найдены
+func (s *Pgx) DeleteToyPhoto(ctx context.Context, toyId string, userId string, photoId string) ([]models.ToyPhoto, error) {
+	return s.withLockedPgxToy(ctx, "Pgx.DeleteToyPhoto", toyId, userId, func(tx pgx.Tx) (bool, error) {
+		var position int
+		var photo models.PhotoSet
+		err := tx.QueryRow(ctx, kDeleteToyPhoto, toyId, photoId).Scan(
+			&position,
+			&photo.Thumbnail,
+			&photo.Medium,
+			&photo.Full,
+		)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if _, err := tx.Exec(ctx, kShiftToyPhotos, toyId, position); err != nil {
+			return false, err
+		}
+
+		_, err = tx.Exec(ctx, kReleaseUploads, photo.Keys())
+		return true, err
+	})
+}
+
+// UpdateToyPhotosOrder ставит фотографии в порядке photoIds, в нем должны быть все фотографии игрушки.
+// Возвращает nil, если игрушка не найдена у пользователя
+func (s *Pgx) UpdateToyPhotosOrder(ctx context.Context, toyId string, userId string, photoIds []string) ([]models.ToyPhoto, error) {
+	return s.withLockedPgxToy(ctx, "Pgx.UpdateToyPhotosOrder", toyId, userId, func(tx pgx.Tx) (bool, error) {
+		_, err := tx.Exec(ctx, kUpdateToyPhotosOrder, toyId, photoIds)
+		return true, err
+	})
+}
+
+// InsertUploads регистрирует файлы до их загрузки в BlobStore, чтобы сборщик нашел их,
+// если привязать файлы к игрушке не получится
+func (s *Pgx) InsertUploads(ctx context.Context, keys []string) error {
+	const op = "Pgx.InsertUploads"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, kInsertUploads, keys); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+// SelectOrphanUploads возвращает файлы, на которые нет ссылок с момента до releasedBefore.
+// limit = nil - все такие файлы
+func (s *Pgx) SelectOrphanUploads(ctx context.Context, releasedBefore time.Time, limit *int64) ([]models.Upload, error) {
+	const op = "Pgx.SelectOrphanUploads"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, kSelectOrphanUploads, releasedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	uploads, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Upload, error) {
+		var upload models.Upload
+		err := row.Scan(&upload.Key, &upload.ToyId, &upload.CreatedAt, &upload.ReleasedAt)
+		return upload, err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return uploads, nil
+}
+
+// DeleteUpload удаляет запись о файле, если на него по-прежнему нет ссылок; false - запись не удалена
+func (s *Pgx) DeleteUpload(ctx context.Context, key string) (bool, error) {
+	const op = "Pgx.DeleteUpload"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, kDeleteUpload, key)
+	if err != nil {
+		return false, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// InsertExchange создает обмен и обоих участников в одной транзакции
+func (s *Pgx) InsertExchange(ctx context.Context, newExchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error) {
+	const op = "Pgx.InsertExchange"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInPgxTx(ctx, s.pool, func(tx pgx.Tx) (*models.Exchange, error) {
+		var dbExchange models.Exchange
+		err := tx.QueryRow(
+			ctx,
+			kInsertExchange,
+			newExchange.SrcToyId,
+			newExchange.DstToyId,
+			newExchange.IdempotencyToken,
+		).Scan(
+			&dbExchange.ExchangeId,
+			&dbExchange.SrcToyId,
+			&dbExchange.DstToyId,
+			&dbExchange.Status,
+			&dbExchange.IdempotencyToken,
+			&dbExchange.CreatedAt,
+			&dbExchange.UpdatedAt,
+		)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == kUniqueViolation && pgErr.ConstraintName == kExchangeActiveToyPairIdx {
+			return nil, models.ErrExchangeExists
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		for _, details := range exchangeDetails {
+			_, err := tx.Exec(ctx, kInsertExchangeDetails, dbExchange.ExchangeId, details.ToyId, details.UserId)
+			if err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+		}
+
+		return &dbExchange, nil
+	})
+}
+
+func selectPgxExchangeWithParticipants(ctx context.Context, querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}, exchangeId string) ([]models.ExchangeParticipant, error) {
+	rows, err := querier.Query(ctx, kSelectExchangeWithParticipants, exchangeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ExchangeParticipant, error) {
+		p, err := scanPgxExchangeParticipant(row)
+		if err != nil {
+			return models.ExchangeParticipant{}, err
+		}
+
+		return *p, nil
+	})
+}
+
+func (s *Pgx) SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error) {
+	const op = "Pgx.SelectExchangeWithParticipants"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	participants, err := selectPgxExchangeWithParticipants(ctx, s.pool, exchangeId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return participants, nil
+}
+
+// UpdateExchangeWithParticipants меняет статус участника по правилам exchange.UpdateDetailsStatus
+// и возвращает участников после всех вызванных этим изменений
+func (s *Pgx) UpdateExchangeWithParticipants(ctx context.Context, exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error) {
+	const op = "Pgx.UpdateExchangeWithParticipants"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	participants, err := runInPgxTx(ctx, s.pool, func(tx pgx.Tx) ([]models.ExchangeParticipant, error) {
+		if err := exchange.UpdateDetailsStatus(&pgxExchangeTx{ctx: ctx, tx: tx}, exchangeId, userId, status); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		participants, err := selectPgxExchangeWithParticipants(ctx, tx, exchangeId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return participants, nil
+	})
+
+	// блокировки берутся в одном порядке, но отказ Postgres от транзакции не должен стать ошибкой сервера
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == kDeadlockDetected || pgErr.Code == kSerializationFailure) {
+		return nil, models.ErrExchangeConflict
+	}
+
+	return participants, err
+}
+
+func (s *Pgx) SelectExchangeList(ctx context.Context, query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.ExchangeInfo, *models.Keyset, *models.Total, error) {
+	const op = "Pgx.SelectExchangeList"
+
+	built, err := buildExchangeListQuery(query, userId, sort, cursor, limit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	results := s.sendListBatch(ctx, built, withTotal)
+	defer results.Close()
+
+	var total *models.Total = nil
+	if withTotal != nil {
+		if total, err = scanTotal(results.QueryRow(), *withTotal); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+	}
+
+	rows, err := results.Query()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+	defer rows.Close()
+
+	exchanges := make([]models.ExchangeInfo, 0)
+	var nextCursor *models.Keyset = nil
+	for rows.Next() {
+		var exchange models.ExchangeInfo
+
+		err := rows.Scan(
+			&exchange.ExchangeId,
+			&exchange.Status,
+			&exchange.IdempotencyToken,
+			&exchange.CreatedAt,
+			&exchange.UpdatedAt,
+			&exchange.Details,
+		)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if int64(len(exchanges)) == limit {
+			value := exchange.CreatedAt.Format(kCursorTimestampLayout)
+			if sort.Field == models.KSortUpdatedAt {
+				value = exchange.UpdatedAt.Format(kCursorTimestampLayout)
+			}
+			nextCursor = &models.Keyset{Value: &value, Id: exchange.ExchangeId}
+			break
+		}
+
+		exchanges = append(exchanges, exchange)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return exchanges, nextCursor, total, nil
+}
+
+func (s *Pgx) InsertExchangeMessage(ctx context.Context, message *models.ExchangeMessage) (*models.ExchangeMessage, error) {
+	const op = "Pgx.InsertExchangeMessage"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	var dbMessage models.ExchangeMessage
+	err := s.pool.QueryRow(
+		ctx,
+		kInsertExchangeMessage,
+		message.ExchangeId,
+		message.UserId,
+		message.Text,
+		message.IdempotencyToken,
+	).Scan(
+		&dbMessage.MessageId,
+		&dbMessage.ExchangeId,
+		&dbMessage.UserId,
+		&dbMessage.Text,
+		&dbMessage.IdempotencyToken,
+		&dbMessage.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbMessage, nil
+}
+
+func (s *Pgx) SelectExchangeMessages(ctx context.Context, exchangeId string, cursor *string, limit int64) ([]models.ExchangeMessage, *string, error) {
+	const op = "Pgx.SelectExchangeMessages"
+
+	sqlQuery, queryParams := buildMessagesQuery(exchangeId, cursor, limit)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, sqlQuery, queryParams...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	dbMessages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ExchangeMessage, error) {
+		var message models.ExchangeMessage
+		err := row.Scan(
+			&message.MessageId,
+			&message.ExchangeId,
+			&message.UserId,
+			&message.Text,
+			&message.IdempotencyToken,
+			&message.CreatedAt,
+		)
+		return message, err
+	})
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	var nextCursor *string = nil
+	if int64(len(dbMessages)) == limit+1 {
+		nextCursor = &dbMessages[len(dbMessages)-1].MessageId
+		dbMessages = dbMessages[:len(dbMessages)-1]
+	}
+
+	return dbMessages, nextCursor, nil
+}
+
+func scanPgxReview(row pgx.Row) (models.Review, error) {
+	var review models.Review
+	err := row.Scan(
+		&review.ExchangeId,
+		&review.ReviewerId,
+		&review.UserId,
+		&review.Rating,
+		&review.Comment,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+	)
+
+	return review, err
+}
+
+func (s *Pgx) InsertReview(ctx context.Context, review *models.Review) (*models.Review, error) {
+	const op = "Pgx.InsertReview"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	dbReview, err := scanPgxReview(s.pool.QueryRow(
+		ctx,
+		kInsertReview,
+		review.ExchangeId,
+		review.ReviewerId,
+		review.UserId,
+		review.Rating,
+		review.Comment,
+	))
+
+	// отзыв на этот обмен уже оставлен
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbReview, nil
+}
+
+func (s *Pgx) SelectReviewsByUserId(ctx context.Context, userId string, cursor *string, limit int64) ([]models.Review, *string, error) {
+	const op = "Pgx.SelectReviewsByUserId"
+
+	sqlQuery, queryParams := buildReviewsQuery(userId, cursor, limit)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, sqlQuery, queryParams...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	dbReviews, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Review, error) {
+		return scanPgxReview(row)
+	})
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	var nextCursor *string = nil
+	if int64(len(dbReviews)) == limit+1 {
+		nextCursor = &dbReviews[len(dbReviews)-1].ExchangeId
+		dbReviews = dbReviews[:len(dbReviews)-1]
+	}
+
+	return dbReviews, nextCursor, nil
+}
+
+func (s *Pgx) SelectUserRating(ctx context.Context, userId string) (*models.UserRating, error) {
+	const op = "Pgx.SelectUserRating"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	var rating models.UserRating
+	if err := s.pool.QueryRow(ctx, kSelectUserRating, userId).Scan(&rating.Average, &rating.Count); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &rating, nil
+}
+
+func (s *Pgx) InsertUserReport(ctx context.Context, report *models.UserReport) (*models.UserReport, error) {
+	const op = "Pgx.InsertUserReport"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	var dbReport models.UserReport
+	err := s.pool.QueryRow(
+		ctx,
+		kInsertUserReport,
+		report.ReporterId,
+		report.UserId,
+		report.Reason,
+	).Scan(
+		&dbReport.ReportId,
+		&dbReport.ReporterId,
+		&dbReport.UserId,
+		&dbReport.Reason,
+		&dbReport.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbReport, nil
+}
+
+func (s *Pgx) InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	const op = "Pgx.InsertUserBlock"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, kInsertUserBlock, userId, blockedUserId); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Pgx) DeleteUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	const op = "Pgx.DeleteUserBlock"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, kDeleteUserBlock, userId, blockedUserId); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Pgx) HasUserBlock(ctx context.Context, userId1 string, userId2 string) (bool, error) {
+	const op = "Pgx.HasUserBlock"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	var blocked bool
+	if err := s.pool.QueryRow(ctx, kSelectHasUserBlock, userId1, userId2).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return blocked, nil
+}
+
+// selectPgxUser возвращает nil, если пользователя нет
+func (s *Pgx) selectPgxUser(ctx context.Context, op string, query string, args ...any) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	dbUser, err := scanPgxUser(s.pool.QueryRow(ctx, query, args...))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return dbUser, nil
+}
+
+func (s *Pgx) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	return s.selectPgxUser(
+		ctx,
+		"Pgx.CreateUser",
+		kInsertUser,
+		user.UserName.FirstName,
+		user.UserName.MiddleName,
+		user.UserName.LastName,
+		user.Email,
+		user.HashPassword,
+	)
+}
+
+func (s *Pgx) SelectUserByEmail(ctx context.Context, user *models.User) (*models.User, error) {
+	return s.selectPgxUser(ctx, "Pgx.SelectUserByEmail", kSelectUserByEmail, user.Email)
+}
+
+func (s *Pgx) SelectUserById(ctx context.Context, user *models.User) (*models.User, error) {
+	return s.selectPgxUser(ctx, "Pgx.SelectUserById", kSelectUserById, user.UserId)
+}
+
+func (s *Pgx) UpdateUserLocation(ctx context.Context, userId string, location *models.Location) (*models.User, error) {
+	return s.selectPgxUser(
+		ctx,
+		"Pgx.UpdateUserLocation",
+		kUpdateUserLocation,
+		userId,
+		location.Lat,
+		location.Lon,
+		location.City,
+	)
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// pgxExchangeTx реализует exchange.Tx поверх транзакции pgx
+type pgxExchangeTx struct {
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (t *pgxExchangeTx) LockToys(toyIds []string) error {
+	rows, err := t.tx.Query(t.ctx, kLockToys, toyIds)
+	if err != nil {
+		return err
+	}
+
+	// строки блокируются по мере чтения
+	_, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	return err
+}
+
+func (t *pgxExchangeTx) LockExchange(exchangeId string) (*models.Exchange, error) {
+	var exchange models.Exchange
+	err := t.tx.QueryRow(t.ctx, kSelectExchangeForUpdate, exchangeId).Scan(
+		&exchange.ExchangeId,
+		&exchange.SrcToyId,
+		&exchange.DstToyId,
+		&exchange.Status,
+		&exchange.IdempotencyToken,
+		&exchange.CreatedAt,
+		&exchange.UpdatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &exchange, nil
+}
+
+func (t *pgxExchangeTx) SelectExchangeDetails(exchangeId string) ([]models.ExchangeDetails, error) {
+	rows, err := t.tx.Query(t.ctx, kSelectExchangeDetails, exchangeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ExchangeDetails, error) {
+		var participant models.ExchangeDetails
+		err := row.Scan(
+			&participant.ExchangeId,
+			&participant.ToyId,
+			&participant.UserId,
+			&participant.Status,
+			&participant.CreatedAt,
+			&participant.UpdatedAt,
+		)
+		return participant, err
+	})
+}
+
+func (t *pgxExchangeTx) SelectOpenExchangeIds(toyIds []string) ([]string, error) {
+	rows, err := t.tx.Query(t.ctx, kSelectOpenExchangeIds, toyIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (t *pgxExchangeTx) UpdateExchangeStatus(exchangeId string, status models.ExchangeStatus) error {
+	_, err := t.tx.Exec(t.ctx, kUpdateExchangeStatusById, exchangeId, status)
+	return err
+}
+
+func (t *pgxExchangeTx) UpdateExchangeDetailsStatus(exchangeId string, userId string, status models.ExchangeDetailsStatus) error {
+	_, err := t.tx.Exec(t.ctx, kUpdateExchangeStatus, exchangeId, userId, status)
+	return err
+}
+
+func (t *pgxExchangeTx) TransferToy(toyId string, userId string, exchangeId string) error {
+	if _, err := t.tx.Exec(t.ctx, kTransferToy, toyId, userId); err != nil {
+		return err
+	}
+
+	if _, err := t.tx.Exec(t.ctx, kReleaseToyOwnership, toyId); err != nil {
+		return err
+	}
+
+	_, err := t.tx.Exec(t.ctx, kInsertToyOwnership, toyId, userId, exchangeId)
+	return err
+}
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListenEvents держит отдельное от пула соединение с LISTEN и передает события в handler.
+// При обрыве соединение восстанавливается с паузой от kListenerMinReconnect до kListenerMaxReconnect,
+// пропущенные за это время уведомления не восстанавливаются. Блокируется до отмены ctx.
+func (s *Pgx) ListenEvents(ctx context.Context, handler func(models.Event)) error {
+	const op = "Pgx.ListenEvents"
+
+	connCnf, err := pgx.ParseConfig(connString(s.cnf))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	delay := kListenerMinReconnect
+	for {
+		listenPgx(ctx, connCnf, handler, func() { delay = kListenerMinReconnect })
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, kListenerMaxReconnect)
+	}
+}
+
+// listenPgx слушает канал на одном соединении до ошибки или отмены ctx; connected вызывается после LISTEN
+func listenPgx(ctx context.Context, connCnf *pgx.ConnConfig, handler func(models.Event), connected func()) error {
+	conn, err := pgx.ConnectConfig(ctx, connCnf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+kExchangeEventsChannel); err != nil {
+		return err
+	}
+
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event models.Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			continue
+		}
+
+		handler(event)
+	}
+}
@@ -3,24 +3,30 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"encoding/json"
+	"strconv"
 	"strings"
+	"time"
 
 	"service/internal/config"
+	"service/internal/domain/exchange"
 	"service/internal/models"
+	"service/internal/utils"
 
 	"github.com/lib/pq"
 )
 
-func runInTx[T any](db *sql.DB, fn func(tx *sql.Tx) (T, error)) (T, error) {
+func runInTx[T any](ctx context.Context, stmts *statements, fn func(tx *preparedTx) (T, error)) (T, error) {
 	var zero T
 
-	tx, err := db.Begin()
+	tx, err := stmts.db.BeginTx(ctx, nil)
 	if err != nil {
 		return zero, err
 	}
 
-	object, err := fn(tx)
+	object, err := fn(&preparedTx{Tx: tx, stmts: stmts})
 	if err != nil {
 		tx.Rollback()
 		return zero, err
@@ -34,20 +40,29 @@ func runInTx[T any](db *sql.DB, fn func(tx *sql.Tx) (T, error)) (T, error) {
 }
 
 type Postgres struct {
-	db  *sql.DB
-	cnf *config.ConfigPostgres
+	db    *sql.DB
+	cnf   *config.ConfigPostgres
+	stmts *statements
 }
 
-func New(cnf *config.ConfigPostgres) (*Postgres, error) {
-	const op = "StoragePostgres.New"
+func connString(cnf *config.ConfigPostgres) string {
+	if cnf.Dsn != "" {
+		return cnf.Dsn
+	}
 
-	conn_str := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cnf.Host,
 		cnf.Port,
 		cnf.Username,
 		cnf.Password,
 		cnf.DbName,
 		cnf.Sslmode)
+}
+
+func New(cnf *config.ConfigPostgres) (*Postgres, error) {
+	const op = "StoragePostgres.New"
+
+	conn_str := connString(cnf)
 
 	db, err := sql.Open(cnf.Driver, conn_str)
 
@@ -67,191 +82,475 @@ func New(cnf *config.ConfigPostgres) (*Postgres, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	stmts, err := newStatements(ctx, db, kPreparedQueries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return &Postgres{
-		db:  db,
-		cnf: cnf,
+		db:    db,
+		cnf:   cnf,
+		stmts: stmts,
 	}, nil
 }
 
-func (s *Postgres) UpdateToy(newToy *models.Toy) (*models.Toy, error) {
-	const op = "Postgres.UpdateToy"
+// Ping проверяет, что база доступна
+func (s *Postgres) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
 
-	stmt, err := s.db.Prepare(kUpdateToy)
+	return s.db.PingContext(ctx)
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+// Close закрывает подготовленные запросы и пул соединений
+func (s *Postgres) Close() error {
+	s.stmts.close()
+	return s.db.Close()
+}
+
+func (s *Postgres) PoolStats() models.PoolStats {
+	stats := s.db.Stats()
+
+	return models.PoolStats{
+		Driver:       s.cnf.Driver,
+		MaxConns:     int64(stats.MaxOpenConnections),
+		TotalConns:   int64(stats.OpenConnections),
+		IdleConns:    int64(stats.Idle),
+		InUseConns:   int64(stats.InUse),
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
 	}
-	defer stmt.Close()
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
-	defer cancel()
+// stmt возвращает запрос, подготовленный при старте сервиса
+func (s *Postgres) stmt(query string) (*sql.Stmt, error) {
+	return s.stmts.get(query)
+}
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
-	err = stmt.QueryRowContext(
-		ctx,
-		newToy.ToyId,
-		newToy.UserId,
-		newToy.Name,
-		newToy.Description,
-		newToy.PhotoUrl,
-	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
-	)
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+func getLocation(lat sql.NullFloat64, lon sql.NullFloat64, city sql.NullString) *models.Location {
+	if !lat.Valid || !lon.Valid {
+		return nil
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+	location := models.Location{
+		Lat: lat.Float64,
+		Lon: lon.Float64,
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
+	if city.Valid {
+		location.City = &city.String
 	}
 
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+	return &location
+}
+
+// координаты и город по отдельности для запросов, nil если место не задано
+func getLocationParams(location *models.Location) (*float64, *float64, *string) {
+	if location == nil {
+		return nil, nil, nil
 	}
 
-	return &dbToy, nil
+	return &location.Lat, &location.Lon, location.City
 }
 
-func (s *Postgres) InsertToy(newToy *models.Toy) (*models.Toy, error) {
-	const op = "Postgres.InsertToy"
+type sortColumn struct {
+	column string
+	cast string
+}
+
+// разрешенные поля сортировки списка игрушек: колонка в kSelectToysList и ее тип для значения из курсора
+var kToysSortColumns = map[string]sortColumn{
+	models.KSortCreatedAt: {column: "created_at", cast: "timestamp"},
+	models.KSortUpdatedAt: {column: "updated_at", cast: "timestamp"},
+	models.KSortName: {column: "name", cast: "text"},
+	models.KSortRelevance: {column: "score", cast: "float8"},
+	models.KSortDistance: {column: "distance", cast: "float8"},
+}
+
+// разрешенные поля сортировки списка обменов: колонка в kSelectExchangeIdList и ее тип для значения из курсора
+var kExchangesSortColumns = map[string]sortColumn{
+	models.KSortCreatedAt: {column: "e.created_at", cast: "timestamp"},
+	models.KSortUpdatedAt: {column: "e.updated_at", cast: "timestamp"},
+}
+
+const (
+	kUniqueViolation = "23505"
+	kSerializationFailure = "40001"
+	kDeadlockDetected = "40P01"
+	kExchangeActiveToyPairIdx = "exchange_active_toy_pair_idx"
+)
+
+const kCursorTimestampLayout = "2006-01-02 15:04:05.999999"
+
+func getToySortValue(toy *models.Toy, field string) *string {
+	var value string
+
+	switch field {
+	case models.KSortCreatedAt:
+		value = toy.CreatedAt.Format(kCursorTimestampLayout)
+	case models.KSortUpdatedAt:
+		value = toy.UpdatedAt.Format(kCursorTimestampLayout)
+	case models.KSortName:
+		value = toy.Name
+	case models.KSortRelevance:
+		if toy.Score == nil {
+			return nil
+		}
+		value = strconv.FormatFloat(*toy.Score, 'g', -1, 64)
+	case models.KSortDistance:
+		if toy.Distance == nil {
+			return nil
+		}
+		value = strconv.FormatFloat(*toy.Distance, 'g', -1, 64)
+	default:
+		return nil
+	}
 
-	stmt, err := s.db.Prepare(kInsertToy)
+	return &value
+}
+
+// getPhotos разбирает json массив фотографий из kToyColumns
+func getPhotos(raw []byte) ([]models.ToyPhoto, error) {
+	photos := make([]models.ToyPhoto, 0)
+	if err := json.Unmarshal(raw, &photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
 
+// getToy читает строку с колонками kToyColumns, extra - дополнительные колонки после них
+func getToy(row rowScanner, extra ...any) (*models.Toy, error) {
+	var toy models.Toy
+	var description, categoryId, condition, city sql.NullString
+	var photos []byte
+	var ageMin, ageMax sql.NullInt64
+	var lat, lon sql.NullFloat64
+
+	dest := []any{
+		&toy.ToyId,
+		&toy.UserId,
+		&toy.Name,
+		&description,
+		&toy.IdempotencyToken,
+		&photos,
+		&toy.Status,
+		&toy.CreatedAt,
+		&toy.UpdatedAt,
+		&categoryId,
+		pq.Array(&toy.Tags),
+		&ageMin,
+		&ageMax,
+		&condition,
+		&lat,
+		&lon,
+		&city,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+		return nil, err
+	}
+
+	if description.Valid {
+		toy.Description = &description.String
+	}
+
+	if toy.Photos, err = getPhotos(photos); err != nil {
+		return nil, err
+	}
+
+	if categoryId.Valid {
+		toy.CategoryId = &categoryId.String
+	}
+
+	if ageMin.Valid {
+		value := int(ageMin.Int64)
+		toy.AgeMin = &value
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	if ageMax.Valid {
+		value := int(ageMax.Int64)
+		toy.AgeMax = &value
+	}
+
+	if condition.Valid {
+		value := models.ToyCondition(condition.String)
+		toy.Condition = &value
+	}
+
+	toy.Location = getLocation(lat, lon, city)
+
+	if toy.Tags == nil {
+		toy.Tags = []string{}
+	}
+
+	return &toy, nil
+}
+
+// UpdateToy заменяет поля игрушки, место меняется, только если оно передано; фотографии из newToy.Photos добавляются в конец списка
+func (s *Postgres) UpdateToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Postgres.UpdateToy"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
-	err = stmt.QueryRowContext(
+	lat, lon, city := getLocationParams(newToy.Location)
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) (*models.Toy, error) {
+		dbToy, err := getToy(tx.QueryRowContext(
+			ctx,
+			kUpdateToy,
+			newToy.ToyId,
+			newToy.UserId,
+			newToy.Name,
+			newToy.Description,
+			newToy.CategoryId,
+			pq.Array(newToy.Tags),
+			newToy.AgeMin,
+			newToy.AgeMax,
+			newToy.Condition,
+			lat,
+			lon,
+			city,
+		))
+
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if len(newToy.Photos) == 0 {
+			return dbToy, nil
+		}
+
+		if dbToy.Status != models.KCreatedToyStatus {
+			return nil, fmt.Errorf("%s, %w", op, models.ErrToyNotEditable)
+		}
+
+		return insertToyPhotos(ctx, tx, dbToy, newToy.Photos)
+	})
+}
+
+// InsertToy создает игрушку вместе с фотографиями из newToy.Photos и открывает историю владения
+func (s *Postgres) InsertToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	const op = "Postgres.InsertToy"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	lat, lon, city := getLocationParams(newToy.Location)
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) (*models.Toy, error) {
+		var replayed bool
+		dbToy, err := getToy(tx.QueryRowContext(
+			ctx,
+			kInsertToy,
+			newToy.UserId,
+			newToy.Name,
+			newToy.Description,
+			newToy.IdempotencyToken,
+			newToy.Status,
+			newToy.CategoryId,
+			pq.Array(newToy.Tags),
+			newToy.AgeMin,
+			newToy.AgeMax,
+			newToy.Condition,
+			lat,
+			lon,
+			city,
+		), &replayed)
+
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s, %w", op, models.ErrToyExists)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		// повтор с тем же idempotency_token возвращает игрушку без изменений; файлы повтора
+		// остаются освобожденными после InsertUploads и удаляются сборщиком
+		if replayed {
+			return dbToy, nil
+		}
+
+		if _, err := tx.ExecContext(ctx, kInsertToyOwnership, dbToy.ToyId, dbToy.UserId, nil); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if len(newToy.Photos) == 0 {
+			return dbToy, nil
+		}
+
+		return insertToyPhotos(ctx, tx, dbToy, newToy.Photos)
+	})
+}
+
+// insertToyPhoto добавляет фотографию в конец списка, models.ErrTooManyPhotos - если достигнут лимит
+func insertToyPhoto(ctx context.Context, tx *preparedTx, toyId string, photo *models.PhotoSet) error {
+	var photoId string
+	err := tx.QueryRowContext(
 		ctx,
-		newToy.UserId,
-		newToy.Name,
-		newToy.Description,
-		newToy.IdempotencyToken,
-		newToy.PhotoUrl,
-		newToy.Status,
-	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
-	)
+		kInsertToyPhoto,
+		toyId,
+		photo.Thumbnail,
+		photo.Medium,
+		photo.Full,
+		models.KMaxToyPhotos,
+	).Scan(&photoId)
+
+	if err == sql.ErrNoRows {
+		return models.ErrTooManyPhotos
+	}
 
 	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+		return err
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
+	_, err = tx.ExecContext(ctx, kAttachUploads, toyId, pq.Array(photo.Keys()))
+	return err
+}
+
+// insertToyPhotos добавляет фотографии в конец списка и перечитывает игрушку
+func insertToyPhotos(ctx context.Context, tx *preparedTx, toy *models.Toy, photos []models.ToyPhoto) (*models.Toy, error) {
+	const op = "Postgres.insertToyPhotos"
+
+	for _, photo := range photos {
+		if err := insertToyPhoto(ctx, tx, toy.ToyId, &photo.PhotoSet); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
 	}
 
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+	dbToy, err := getToy(tx.QueryRowContext(ctx, kSelectToyById, toy.ToyId))
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	return &dbToy, nil
+	return dbToy, nil
 }
 
-func (s *Postgres) UpdateToyStatus(toyId string, userId string, status models.ToyStatus) (*models.Toy, error) {
+// UpdateToyStatus меняет статус игрушки владельца; при удалении игрушки проваливаются ее незавершенные обмены
+// и освобождаются файлы ее фотографий
+func (s *Postgres) UpdateToyStatus(ctx context.Context, toyId string, userId string, status models.ToyStatus) (*models.Toy, error) {
 	const op = "Postgres.UpdateToyStatus"
 
-	stmt, err := s.db.Prepare(kUpdateToyStatus)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) (*models.Toy, error) {
+		dbToy, err := getToy(tx.QueryRowContext(
+			ctx,
+			kUpdateToyStatus,
+			toyId,
+			userId,
+			status,
+		))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if status == models.KRemovedToyStatus {
+			if err := exchange.RemoveToy(&exchangeTx{ctx: ctx, tx: tx}, toyId); err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+
+			photos, err := selectToyPhotos(ctx, tx, toyId)
+			if err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+
+			if _, err := tx.ExecContext(ctx, kReleaseUploads, pq.Array(models.PhotoKeys(photos))); err != nil {
+				return nil, fmt.Errorf("%s, %w", op, err)
+			}
+		}
+
+		return dbToy, nil
+	})
+}
+
+func (s *Postgres) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	const op = "Postgres.SelectToyById"
+
+	stmt, err := s.stmt(kSelectToyById)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
-	err = stmt.QueryRowContext(
+	dbToy, err := getToy(stmt.QueryRowContext(
 		ctx,
 		toyId,
-		userId,
-		status,
-	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
-	)
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
+	return dbToy, nil
+}
+
+func (s *Postgres) SelectToyByUserId(ctx context.Context, toyId string, userId string) (*models.Toy, error) {
+	const op = "Postgres.SelectToyByUserId"
+
+	stmt, err := s.stmt(kSelectToyByUserId)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	dbToy, err := getToy(stmt.QueryRowContext(
+		ctx,
+		toyId,
+		userId,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
 
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	return &dbToy, nil
+	return dbToy, nil
 }
 
-func (s *Postgres) SelectToyById(toyId string) (*models.Toy, error) {
-	const op = "Postgres.SelectToyById"
+func (s *Postgres) SelectToyByToken(ctx context.Context, token string, userId string) (*models.Toy, error) {
+	const op = "Postgres.SelectToyByToken"
 
-	stmt, err := s.db.Prepare(kSelectToyById)
+	stmt, err := s.stmt(kSelectToyByToken)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
-	err = stmt.QueryRowContext(
+	dbToy, err := getToy(stmt.QueryRowContext(
 		ctx,
-		toyId,
-	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
-	)
+		token,
+		userId,
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -261,97 +560,1189 @@ func (s *Postgres) SelectToyById(toyId string) (*models.Toy, error) {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
-	}
+	return dbToy, nil
+}
+
+// builtListQuery - запрос страницы списка и тот же запрос без keyset, сортировки и LIMIT для подсчета total.
+// Массивы в параметрах - обычные срезы: pgx передает их сам, для lib/pq их оборачивает pqArgs
+type builtListQuery struct {
+	page string
+	pageParams []interface{}
+	filtered string
+	filteredParams []interface{}
+}
 
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+// pqArgs оборачивает срезы строк из параметров в pq.Array
+func pqArgs(params []interface{}) []interface{} {
+	args := make([]interface{}, len(params))
+	for i, param := range params {
+		if values, ok := param.([]string); ok {
+			param = pq.Array(values)
+		}
+
+		args[i] = param
 	}
 
-	return &dbToy, nil
+	return args
 }
 
-func (s *Postgres) SelectToyByUserId(toyId string, userId string) (*models.Toy, error) {
-	const op = "Postgres.SelectToyByUserId"
+// buildToysListQuery собирает запрос страницы списка игрушек и запрос без keyset и LIMIT для подсчета total
+func buildToysListQuery(query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64) (*builtListQuery, error) {
+	var (
+		whereClauses []string
+		queryParams  []interface{}
+		paramIndex   = 2
+	)
+
+	// игрушки пользователей, заблокированных в любую сторону, не показываем
+	queryParams = append(queryParams, userId)
+	whereClauses = append(whereClauses, `AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.user_id = $1 AND b.blocked_user_id = toys.user_id)
+				OR (b.user_id = toys.user_id AND b.blocked_user_id = $1)
+		)`)
+
+	// вычисляемые колонки: по умолчанию пустые
+	scoreExpr, snippetExpr, distanceExpr := "NULL::float8", "NULL::text", "NULL::float8"
+	fromClause := "FROM toys"
+
+	if query.Text != nil {
+		scoreExpr = fmt.Sprintf(
+			"(ts_rank(toys.search_vector, q.search_query) + word_similarity($%d, toys.name))::float8",
+			paramIndex)
+		snippetExpr = "ts_headline('russian', COALESCE(toys.description, toys.name), q.search_query, " +
+			"'StartSel=<b>, StopSel=</b>, MaxFragments=2, MaxWords=20, MinWords=5')"
+		fromClause = fmt.Sprintf(`FROM toys,
+				(SELECT websearch_to_tsquery('russian', $%d) || websearch_to_tsquery('english', $%d) AS search_query) q
+			WHERE toys.search_vector @@ q.search_query
+				OR $%d <%% toys.name`, paramIndex, paramIndex, paramIndex)
+		queryParams = append(queryParams, *query.Text)
+		paramIndex++
+	}
+
+	if query.Near != nil {
+		distanceExpr = fmt.Sprintf("distance_km($%d, $%d, toys.lat, toys.lon)", paramIndex, paramIndex+1)
+		queryParams = append(queryParams, query.Near.Lat, query.Near.Lon)
+		paramIndex += 2
+
+		// сначала грубый отбор по квадрату (работает индекс по lat, lon), затем точное расстояние
+		minLat, maxLat, minLon, maxLon := utils.BoundingBox(query.Near.Lat, query.Near.Lon, query.Near.RadiusKm)
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND lat BETWEEN $%d AND $%d AND lon BETWEEN $%d AND $%d AND distance <= $%d",
+			paramIndex, paramIndex+1, paramIndex+2, paramIndex+3, paramIndex+4))
+		queryParams = append(queryParams, minLat, maxLat, minLon, maxLon, query.Near.RadiusKm)
+		paramIndex += 5
+	}
+
+	if query.Statuses != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND status = ANY($%d)", paramIndex))
+		queryParams = append(queryParams, query.Statuses)
+		paramIndex++
+	}
+
+	if query.ExcludeUserIds != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND user_id != ALL($%d)", paramIndex))
+		queryParams = append(queryParams, query.ExcludeUserIds)
+		paramIndex++
+	}
+
+	if query.UserIds != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND user_id = ANY($%d)", paramIndex))
+		queryParams = append(queryParams, query.UserIds)
+		paramIndex++
+	}
+
+	if query.CategoryIds != nil {
+		// вместе с вложенными категориями
+		whereClauses = append(whereClauses, fmt.Sprintf(`AND category_id IN (
+			WITH RECURSIVE tree AS (
+				SELECT category_id FROM categories WHERE category_id = ANY($%d)
+				UNION
+				SELECT c.category_id FROM categories c INNER JOIN tree ON c.parent_id = tree.category_id
+			)
+			SELECT category_id FROM tree
+		)`, paramIndex))
+		queryParams = append(queryParams, query.CategoryIds)
+		paramIndex++
+	}
+
+	if query.Tags != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND tags && $%d", paramIndex))
+		queryParams = append(queryParams, query.Tags)
+		paramIndex++
+	}
 
-	stmt, err := s.db.Prepare(kSelectToyByUserId)
+	if query.Age != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND (age_min IS NULL OR age_min <= $%d) AND (age_max IS NULL OR age_max >= $%d)",
+			paramIndex, paramIndex))
+		queryParams = append(queryParams, *query.Age)
+		paramIndex++
+	}
+
+	if query.Conditions != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND condition = ANY($%d)", paramIndex))
+		queryParams = append(queryParams, query.Conditions)
+		paramIndex++
+	}
+
+	listQuery := fmt.Sprintf(kSelectToysList, scoreExpr, snippetExpr, distanceExpr, fromClause)
+
+	built := &builtListQuery{
+		filtered: fmt.Sprintf("%s%s", listQuery, strings.Join(whereClauses, "\n")),
+		filteredParams: append([]interface{}{}, queryParams...),
+	}
+
+	sortColumn, ok := kToysSortColumns[sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %s", sort.Field)
+	}
+
+	direction, compare := "ASC", ">="
+	if sort.Direction == models.KSortDesc {
+		direction, compare = "DESC", "<="
+	}
+
+	// toy_id сортируется в ту же сторону, чтобы keyset сравнивался одной парой
+	if cursor != nil {
+		if cursor.Value == nil {
+			return nil, errors.New("cursor without sort value")
+		}
+
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND (%s, toy_id) %s ($%d::%s, $%d)",
+			sortColumn.column, compare, paramIndex, sortColumn.cast, paramIndex+1))
+		queryParams = append(queryParams, *cursor.Value, cursor.Id)
+		paramIndex += 2
+	}
+
+	whereClauses = append(whereClauses, fmt.Sprintf(
+		"ORDER BY %s %s, toy_id %s", sortColumn.column, direction, direction))
+	whereClauses = append(whereClauses, fmt.Sprintf("LIMIT $%d", paramIndex))
+	queryParams = append(queryParams, limit+1)
+
+	built.page = fmt.Sprintf("%s%s", listQuery, strings.Join(whereClauses, "\n"))
+	built.pageParams = queryParams
+
+	return built, nil
+}
+
+func (s *Postgres) SelectToysList(ctx context.Context, query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.Toy, *models.Keyset, *models.Total, error) {
+	const op = "Postgres.SelectToysList"
 
+	built, err := buildToysListQuery(query, userId, sort, cursor, limit)
 	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+		return nil, nil, nil, fmt.Errorf("1 %s, %w", op, err)
+	}
+
+	var total *models.Total = nil
+	if withTotal != nil {
+		total, err = s.selectTotal(ctx, built.filtered, built.filteredParams, *withTotal)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("1 %s, %w", op, err)
+		}
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
-	err = stmt.QueryRowContext(
+	rows, err := s.db.QueryContext(
 		ctx,
-		toyId,
-		userId,
+		built.page,
+		pqArgs(built.pageParams)...,
+	)
+
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("2 %s, %w", op, err)
+	}
+	defer rows.Close()
+
+	dbToys := make([]models.Toy, 0)
+
+	for rows.Next() {
+		var score, distance sql.NullFloat64
+		var snippet sql.NullString
+
+		toy, err := getToy(rows, &score, &snippet, &distance)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("3 %s: %w", op, err)
+		}
+
+		if score.Valid {
+			toy.Score = &score.Float64
+		}
+		if snippet.Valid {
+			toy.Snippet = &snippet.String
+		}
+		if distance.Valid {
+			toy.Distance = &distance.Float64
+		}
+
+		dbToys = append(dbToys, *toy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("3 %s: %w", op, err)
+	}
+
+	var nextCursor *models.Keyset = nil
+	if int64(len(dbToys)) == limit+1 {
+		next := dbToys[len(dbToys)-1]
+		nextCursor = &models.Keyset{
+			Value: getToySortValue(&next, sort.Field),
+			Id: next.ToyId,
+		}
+		dbToys = dbToys[:len(dbToys)-1]
+	}
+
+	return dbToys, nextCursor, total, nil
+}
+
+// totalQuery - запрос total по запросу списка без курсора, сортировки и лимита.
+// Оценка берется из плана запроса и не читает строки, поэтому подходит для больших выборок.
+func totalQuery(listQuery string, mode string) string {
+	if mode == models.KTotalEstimated {
+		return "EXPLAIN (FORMAT JSON) " + listQuery
+	}
+
+	return "SELECT COUNT(*) FROM (" + listQuery + ") list"
+}
+
+// scanTotal читает результат totalQuery
+func scanTotal(row rowScanner, mode string) (*models.Total, error) {
+	if mode == models.KTotalEstimated {
+		var rawPlan []byte
+		if err := row.Scan(&rawPlan); err != nil {
+			return nil, err
+		}
+
+		var plans []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plan"`
+		}
+		if err := json.Unmarshal(rawPlan, &plans); err != nil || len(plans) == 0 {
+			return nil, fmt.Errorf("invalid plan: %v", err)
+		}
+
+		return &models.Total{Count: int64(plans[0].Plan.Rows), Estimated: true}, nil
+	}
+
+	var count int64
+	if err := row.Scan(&count); err != nil {
+		return nil, err
+	}
+
+	return &models.Total{Count: count}, nil
+}
+
+func (s *Postgres) selectTotal(ctx context.Context, listQuery string, queryParams []interface{}, mode string) (*models.Total, error) {
+	const op = "Postgres.selectTotal"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	total, err := scanTotal(s.db.QueryRowContext(ctx, totalQuery(listQuery, mode), pqArgs(queryParams)...), mode)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return total, nil
+}
+
+func selectToyPhotos(ctx context.Context, tx *preparedTx, toyId string) ([]models.ToyPhoto, error) {
+	rows, err := tx.QueryContext(ctx, kSelectToyPhotos, toyId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := make([]models.ToyPhoto, 0)
+	for rows.Next() {
+		var photo models.ToyPhoto
+
+		err := rows.Scan(
+			&photo.PhotoId,
+			&photo.Position,
+			&photo.Thumbnail,
+			&photo.Medium,
+			&photo.Full,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		photos = append(photos, photo)
+	}
+
+	return photos, rows.Err()
+}
+
+// lockToy блокирует игрушку владельца до конца транзакции, false - игрушки нет или она удалена.
+// models.ErrToyNotEditable, если игрушка не в статусе created
+func lockToy(ctx context.Context, tx *preparedTx, toyId string, userId string) (bool, error) {
+	var status models.ToyStatus
+	err := tx.QueryRowContext(ctx, kSelectToyForUpdate, toyId, userId).Scan(&status)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if status != models.KCreatedToyStatus {
+		return false, models.ErrToyNotEditable
+	}
+
+	return true, nil
+}
+
+// InsertToyPhoto возвращает nil, если игрушка не найдена у пользователя
+func (s *Postgres) InsertToyPhoto(ctx context.Context, toyId string, userId string, photo *models.PhotoSet) ([]models.ToyPhoto, error) {
+	const op = "Postgres.InsertToyPhoto"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) ([]models.ToyPhoto, error) {
+		found, err := lockToy(ctx, tx, toyId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		if err := insertToyPhoto(ctx, tx, toyId, photo); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		photos, err := selectToyPhotos(ctx, tx, toyId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return photos, nil
+	})
+}
+
+// DeleteToyPhoto возвращает nil, если игрушка или фотография не найдены
+func (s *Postgres) DeleteToyPhoto(ctx context.Context, toyId string, userId string, photoId string) ([]models.ToyPhoto, error) {
+	const op = "Postgres.DeleteToyPhoto"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) ([]models.ToyPhoto, error) {
+		found, err := lockToy(ctx, tx, toyId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		var position int
+		var photo models.PhotoSet
+		err = tx.QueryRowContext(ctx, kDeleteToyPhoto, toyId, photoId).Scan(
+			&position,
+			&photo.Thumbnail,
+			&photo.Medium,
+			&photo.Full,
+		)
+
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, kShiftToyPhotos, toyId, position); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, kReleaseUploads, pq.Array(photo.Keys())); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		photos, err := selectToyPhotos(ctx, tx, toyId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return photos, nil
+	})
+}
+
+// UpdateToyPhotosOrder ставит фотографии в порядке photoIds, в нем должны быть все фотографии игрушки.
+// Возвращает nil, если игрушка не найдена у пользователя
+func (s *Postgres) UpdateToyPhotosOrder(ctx context.Context, toyId string, userId string, photoIds []string) ([]models.ToyPhoto, error) {
+	const op = "Postgres.UpdateToyPhotosOrder"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) ([]models.ToyPhoto, error) {
+		found, err := lockToy(ctx, tx, toyId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if !found {
+			return nil, nil
+		}
+
+		if _, err := tx.ExecContext(ctx, kUpdateToyPhotosOrder, toyId, pq.Array(photoIds)); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		photos, err := selectToyPhotos(ctx, tx, toyId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return photos, nil
+	})
+}
+
+// InsertUploads регистрирует файлы до их загрузки в BlobStore, чтобы сборщик нашел их,
+// если привязать файлы к игрушке не получится
+func (s *Postgres) InsertUploads(ctx context.Context, keys []string) error {
+	const op = "Postgres.InsertUploads"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	stmt, err := s.stmt(kInsertUploads)
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, pq.Array(keys)); err != nil {
+		return fmt.Errorf("%s, %w", op, err)
+	}
+
+	return nil
+}
+
+// SelectOrphanUploads возвращает файлы, на которые нет ссылок с момента до releasedBefore.
+// limit = nil - все такие файлы
+func (s *Postgres) SelectOrphanUploads(ctx context.Context, releasedBefore time.Time, limit *int64) ([]models.Upload, error) {
+	const op = "Postgres.SelectOrphanUploads"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	stmt, err := s.stmt(kSelectOrphanUploads)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, releasedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+	defer rows.Close()
+
+	uploads := make([]models.Upload, 0)
+	for rows.Next() {
+		var upload models.Upload
+		var toyId sql.NullString
+		var releasedAt sql.NullTime
+
+		if err := rows.Scan(&upload.Key, &toyId, &upload.CreatedAt, &releasedAt); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if toyId.Valid {
+			upload.ToyId = &toyId.String
+		}
+
+		if releasedAt.Valid {
+			upload.ReleasedAt = &releasedAt.Time
+		}
+
+		uploads = append(uploads, upload)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return uploads, nil
+}
+
+// DeleteUpload удаляет запись о файле, если на него по-прежнему нет ссылок; false - запись не удалена
+func (s *Postgres) DeleteUpload(ctx context.Context, key string) (bool, error) {
+	const op = "Postgres.DeleteUpload"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	stmt, err := s.stmt(kDeleteUpload)
+	if err != nil {
+		return false, fmt.Errorf("%s, %w", op, err)
+	}
+
+	result, err := stmt.ExecContext(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("%s, %w", op, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return deleted > 0, nil
+}
+
+// SelectToyOwnershipHistory - владельцы игрушки от создателя до текущего
+func (s *Postgres) SelectToyOwnershipHistory(ctx context.Context, toyId string) ([]models.ToyOwnership, error) {
+	const op = "Postgres.SelectToyOwnershipHistory"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	stmt, err := s.stmt(kSelectToyOwnershipHistory)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, toyId)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+	defer rows.Close()
+
+	history := make([]models.ToyOwnership, 0)
+	for rows.Next() {
+		var ownership models.ToyOwnership
+		var exchangeId sql.NullString
+		var releasedAt sql.NullTime
+
+		if err := rows.Scan(&ownership.UserId, &exchangeId, &ownership.AcquiredAt, &releasedAt); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if exchangeId.Valid {
+			ownership.ExchangeId = &exchangeId.String
+		}
+
+		if releasedAt.Valid {
+			ownership.ReleasedAt = &releasedAt.Time
+		}
+
+		history = append(history, ownership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return history, nil
+}
+
+func (s *Postgres) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	const op = "Postgres.SelectCategories"
+
+	stmt, err := s.stmt(kSelectCategories)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	categories := make([]models.Category, 0)
+	for rows.Next() {
+		var category models.Category
+		var parentId sql.NullString
+
+		err := rows.Scan(
+			&category.CategoryId,
+			&parentId,
+			&category.Name,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		if parentId.Valid {
+			category.ParentId = &parentId.String
+		}
+
+		categories = append(categories, category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return categories, nil
+}
+
+func insertExchange(ctx context.Context, tx *preparedTx, exchange *models.Exchange) (*models.Exchange, error) {
+	const op = "Postgres.insertExchange"
+
+	var dbExchange models.Exchange
+	err := tx.QueryRowContext(
+		ctx,
+		kInsertExchange,
+		exchange.SrcToyId,
+		exchange.DstToyId,
+		exchange.IdempotencyToken,
+	).Scan(
+		&dbExchange.ExchangeId,
+		&dbExchange.SrcToyId,
+		&dbExchange.DstToyId,
+		&dbExchange.Status,
+		&dbExchange.IdempotencyToken,
+		&dbExchange.CreatedAt,
+		&dbExchange.UpdatedAt,
+	)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == kUniqueViolation && pqErr.Constraint == kExchangeActiveToyPairIdx {
+		return nil, models.ErrExchangeExists
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbExchange, nil
+}
+
+func insertExchangeDetails(ctx context.Context, tx *preparedTx, exchangeDetails *models.ExchangeDetails) (*models.ExchangeDetails, error) {
+	const op = "Postgres.insertExchangeDetails"
+
+	var dbExchangeDetails models.ExchangeDetails
+	err := tx.QueryRowContext(
+		ctx,
+		kInsertExchangeDetails,
+		exchangeDetails.ExchangeId,
+		exchangeDetails.ToyId,
+		exchangeDetails.UserId,
+	).Scan(
+		&dbExchangeDetails.ExchangeId,
+		&dbExchangeDetails.ToyId,
+		&dbExchangeDetails.UserId,
+		&dbExchangeDetails.Status,
+		&dbExchangeDetails.CreatedAt,
+		&dbExchangeDetails.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbExchangeDetails, nil
+}
+
+// InsertExchange создает обмен и обоих участников в одной транзакции
+func (s *Postgres) InsertExchange(ctx context.Context, exchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	return runInTx(ctx, s.stmts, func(tx *preparedTx) (*models.Exchange, error) {
+
+		dbExchange, err := insertExchange(ctx, tx, exchange)
+		if err != nil {
+			return nil, err
+		}
+
+		exchangeDetails[0].ExchangeId = dbExchange.ExchangeId
+		exchangeDetails[1].ExchangeId = dbExchange.ExchangeId
+
+		for _, details := range exchangeDetails {
+			_, err = insertExchangeDetails(ctx, tx, &details)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return dbExchange, nil
+	})
+}
+
+func getExchangeParticipant(rows *sql.Rows) (*models.ExchangeParticipant, error) {
+	var p models.ExchangeParticipant
+	var toyDesc, middleName, toyCity sql.NullString
+	var toyPhotos []byte
+	var toyLat, toyLon, toyDistance sql.NullFloat64
+
+	err := rows.Scan(
+		&p.ExchangeId,
+		&p.ExchangeStatus,
+		&p.IdempotencyToken,
+		&p.ExchangeCreatedAt,
+		&p.ExchangeUpdatedAt,
+
+		&p.ToyId,
+		&p.ToyName,
+		&toyDesc,
+		&toyPhotos,
+		&toyLat,
+		&toyLon,
+		&toyCity,
+		&toyDistance,
+
+		&p.UserId,
+		&p.FirstName,
+		&middleName,
+		&p.LastName,
+		&p.UserRating.Average,
+		&p.UserRating.Count,
+
+		&p.UserExchangeStatus,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if toyDesc.Valid {
+		p.ToyDescription = &toyDesc.String
+	}
+	if p.ToyPhotos, err = getPhotos(toyPhotos); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if middleName.Valid {
+		p.MiddleName = &middleName.String
+	}
+
+	p.ToyLocation = getLocation(toyLat, toyLon, toyCity)
+
+	if toyDistance.Valid {
+		p.ToyDistance = &toyDistance.Float64
+	}
+
+	return &p, nil
+}
+
+func selectExchangeWithParticipants(ctx context.Context, tx *preparedTx, exchangeId string) ([]models.ExchangeParticipant, error) {
+	rows, err := tx.QueryContext(ctx, kSelectExchangeWithParticipants, exchangeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := make([]models.ExchangeParticipant, 0)
+	for rows.Next() {
+		p, err := getExchangeParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		participants = append(participants, *p)
+	}
+
+	return participants, rows.Err()
+}
+
+func (s *Postgres) SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error) {
+	const op = "Postgres.SelectExchangeWithParticipants"
+
+	stmt, err := s.stmt(kSelectExchangeWithParticipants)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := stmt.QueryContext(ctx, exchangeId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	participants := make([]models.ExchangeParticipant, 0)
+	for rows.Next() {
+		p, err := getExchangeParticipant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		participants = append(participants, *p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return participants, nil
+}
+
+// UpdateExchangeWithParticipants меняет статус участника по правилам exchange.UpdateDetailsStatus
+// и возвращает участников после всех вызванных этим изменений
+func (s *Postgres) UpdateExchangeWithParticipants(ctx context.Context, exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error) {
+	const op = "Postgres.UpdateExchangeWithParticipants"
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	participants, err := runInTx(ctx, s.stmts, func(tx *preparedTx) ([]models.ExchangeParticipant, error) {
+		if err := exchange.UpdateDetailsStatus(&exchangeTx{ctx: ctx, tx: tx}, exchangeId, userId, status); err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		participants, err := selectExchangeWithParticipants(ctx, tx, exchangeId)
+		if err != nil {
+			return nil, fmt.Errorf("%s, %w", op, err)
+		}
+
+		return participants, nil
+	})
+
+	// блокировки берутся в одном порядке, но отказ Postgres от транзакции не должен стать ошибкой сервера
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == kDeadlockDetected || pqErr.Code == kSerializationFailure) {
+		return nil, models.ErrExchangeConflict
+	}
+
+	return participants, err
+}
+
+// buildExchangeListQuery собирает запрос страницы обменов пользователя и запрос идентификаторов для подсчета total
+func buildExchangeListQuery(query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64) (*builtListQuery, error) {
+	var (
+		whereClauses []string
+		queryParams  []interface{}
+		paramIndex   = 2
+	)
+
+	queryParams = append(queryParams, userId)
+
+	if query.Statuses != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND e.status = ANY($%d)", paramIndex))
+		queryParams = append(queryParams, query.Statuses)
+		paramIndex++
+	}
+
+	if query.Role != nil {
+		toyColumn := "e.src_toy_id"
+		if *query.Role == models.KRoleRecipient {
+			toyColumn = "e.dst_toy_id"
+		}
+		whereClauses = append(whereClauses, fmt.Sprintf("AND ed.toy_id = %s", toyColumn))
+	}
+
+	if query.CounterpartyId != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf(`AND EXISTS (
+			SELECT 1 FROM exchange_details other
+			WHERE other.exchange_id = e.exchange_id
+				AND other.user_id != ed.user_id
+				AND other.user_id = $%d
+		)`, paramIndex))
+		queryParams = append(queryParams, *query.CounterpartyId)
+		paramIndex++
+	}
+
+	if query.ToyId != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("AND $%d IN (e.src_toy_id, e.dst_toy_id)", paramIndex))
+		queryParams = append(queryParams, *query.ToyId)
+		paramIndex++
+	}
+
+	for _, dateRange := range []struct {
+		column string
+		value *models.QueryDateRange
+	}{
+		{column: "e.created_at", value: query.CreatedAt},
+		{column: "e.updated_at", value: query.UpdatedAt},
+	} {
+		if dateRange.value == nil {
+			continue
+		}
+
+		if dateRange.value.From != nil {
+			whereClauses = append(whereClauses, fmt.Sprintf("AND %s >= $%d", dateRange.column, paramIndex))
+			queryParams = append(queryParams, *dateRange.value.From)
+			paramIndex++
+		}
+
+		if dateRange.value.To != nil {
+			whereClauses = append(whereClauses, fmt.Sprintf("AND %s < $%d", dateRange.column, paramIndex))
+			queryParams = append(queryParams, *dateRange.value.To)
+			paramIndex++
+		}
+	}
+
+	if query.AwaitingMyAction {
+		whereClauses = append(whereClauses, kWhereExchangeAwaitingUser)
+	}
+
+	built := &builtListQuery{
+		filtered: fmt.Sprintf("%s%s", kSelectExchangeIdList, strings.Join(whereClauses, "\n")),
+		filteredParams: append([]interface{}{}, queryParams...),
+	}
+
+	sortColumn, ok := kExchangesSortColumns[sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %s", sort.Field)
+	}
+
+	direction, compare := "ASC", ">="
+	if sort.Direction == models.KSortDesc {
+		direction, compare = "DESC", "<="
+	}
+
+	if cursor != nil {
+		if cursor.Value == nil {
+			return nil, errors.New("cursor without sort value")
+		}
+
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND (%s, e.exchange_id) %s ($%d::%s, $%d)",
+			sortColumn.column, compare, paramIndex, sortColumn.cast, paramIndex+1))
+		queryParams = append(queryParams, *cursor.Value, cursor.Id)
+		paramIndex += 2
+	}
+
+	whereClauses = append(whereClauses, fmt.Sprintf(
+		"ORDER BY %s %s, e.exchange_id %s", sortColumn.column, direction, direction))
+	whereClauses = append(whereClauses, fmt.Sprintf("LIMIT $%d", paramIndex))
+	queryParams = append(queryParams, limit+1)
+
+	built.page = fmt.Sprintf("%s%s", kSelectExchangeList, strings.Join(whereClauses, "\n"))
+	built.pageParams = queryParams
+
+	return built, nil
+}
+
+func (s *Postgres) SelectExchangeList(ctx context.Context, query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.ExchangeInfo, *models.Keyset, *models.Total, error) {
+	const op = "Postgres.SelectExchangeList"
+
+	built, err := buildExchangeListQuery(query, userId, sort, cursor, limit)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("1 %s, %w", op, err)
+	}
+
+	var total *models.Total = nil
+	if withTotal != nil {
+		total, err = s.selectTotal(ctx, built.filtered, built.filteredParams, *withTotal)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("1 %s, %w", op, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		built.page,
+		pqArgs(built.pageParams)...,
+	)
+
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("2 %s, %w", op, err)
+	}
+	defer rows.Close()
+
+	exchanges := make([]models.ExchangeInfo, 0)
+	var nextCursor *models.Keyset = nil
+	for rows.Next() {
+		var exchange models.ExchangeInfo
+		var details []byte
+
+		err := rows.Scan(
+			&exchange.ExchangeId,
+			&exchange.Status,
+			&exchange.IdempotencyToken,
+			&exchange.CreatedAt,
+			&exchange.UpdatedAt,
+			&details,
+		)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("3 %s: %w", op, err)
+		}
+
+		if int64(len(exchanges)) == limit {
+			value := exchange.CreatedAt.Format(kCursorTimestampLayout)
+			if sort.Field == models.KSortUpdatedAt {
+				value = exchange.UpdatedAt.Format(kCursorTimestampLayout)
+			}
+			nextCursor = &models.Keyset{Value: &value, Id: exchange.ExchangeId}
+			break
+		}
+
+		if err := json.Unmarshal(details, &exchange.Details); err != nil {
+			return nil, nil, nil, fmt.Errorf("4 %s: %w", op, err)
+		}
+
+		exchanges = append(exchanges, exchange)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("3 %s: %w", op, err)
+	}
+
+	return exchanges, nextCursor, total, nil
+}
+
+func (s *Postgres) InsertExchangeMessage(ctx context.Context, message *models.ExchangeMessage) (*models.ExchangeMessage, error) {
+	const op = "Postgres.InsertExchangeMessage"
+
+	stmt, err := s.stmt(kInsertExchangeMessage)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	var dbMessage models.ExchangeMessage
+	err = stmt.QueryRowContext(
+		ctx,
+		message.ExchangeId,
+		message.UserId,
+		message.Text,
+		message.IdempotencyToken,
 	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
+		&dbMessage.MessageId,
+		&dbMessage.ExchangeId,
+		&dbMessage.UserId,
+		&dbMessage.Text,
+		&dbMessage.IdempotencyToken,
+		&dbMessage.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s, %w", op, err)
+	}
+
+	return &dbMessage, nil
+}
+
+// buildMessagesQuery собирает запрос страницы сообщений обмена
+func buildMessagesQuery(exchangeId string, cursor *string, limit int64) (string, []interface{}) {
+	var (
+		whereClauses []string
+		queryParams  []interface{}
+		paramIndex   = 2
+	)
+
+	queryParams = append(queryParams, exchangeId)
+
+	// сообщения идут в хронологическом порядке, курсор - id первого сообщения следующей страницы
+	if cursor != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND (m.created_at, m.message_id) >= (SELECT created_at, message_id FROM exchange_messages WHERE message_id = $%d)",
+			paramIndex))
+		queryParams = append(queryParams, *cursor)
+		paramIndex++
+	}
+
+	whereClauses = append(whereClauses, "ORDER BY m.created_at, m.message_id")
+	whereClauses = append(whereClauses, fmt.Sprintf("LIMIT $%d", paramIndex))
+	queryParams = append(queryParams, limit+1)
+
+	sqlQuery := fmt.Sprintf("%s%s", kSelectExchangeMessages, strings.Join(whereClauses, "\n"))
+
+	return sqlQuery, queryParams
+}
+
+func (s *Postgres) SelectExchangeMessages(ctx context.Context, exchangeId string, cursor *string, limit int64) ([]models.ExchangeMessage, *string, error) {
+	const op = "Postgres.SelectExchangeMessages"
+
+	sqlQuery, queryParams := buildMessagesQuery(exchangeId, cursor, limit)
+
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		sqlQuery,
+		queryParams...,
 	)
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
 	}
+	defer rows.Close()
 
-	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+	dbMessages := make([]models.ExchangeMessage, 0)
+
+	for rows.Next() {
+		var message models.ExchangeMessage
+
+		err := rows.Scan(
+			&message.MessageId,
+			&message.ExchangeId,
+			&message.UserId,
+			&message.Text,
+			&message.IdempotencyToken,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		dbMessages = append(dbMessages, message)
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+	var nextCursor *string = nil
+	if int64(len(dbMessages)) == limit+1 {
+		nextCursor = &dbMessages[len(dbMessages)-1].MessageId
+		dbMessages = dbMessages[:len(dbMessages)-1]
 	}
 
-	return &dbToy, nil
+	return dbMessages, nextCursor, nil
 }
 
-func (s *Postgres) SelectToyByToken(token string) (*models.Toy, error) {
-	const op = "Postgres.SelectToyByToken"
+func (s *Postgres) InsertReview(ctx context.Context, review *models.Review) (*models.Review, error) {
+	const op = "Postgres.InsertReview"
 
-	stmt, err := s.db.Prepare(kSelectToyByToken)
+	stmt, err := s.stmt(kInsertReview)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbToy models.Toy
-	var description, photoUrl sql.NullString
+	var dbReview models.Review
+	var comment sql.NullString
 	err = stmt.QueryRowContext(
 		ctx,
-		token,
+		review.ExchangeId,
+		review.ReviewerId,
+		review.UserId,
+		review.Rating,
+		review.Comment,
 	).Scan(
-		&dbToy.ToyId,
-		&dbToy.UserId,
-		&dbToy.Name,
-		&description,
-		&dbToy.IdempotencyToken,
-		&photoUrl,
-		&dbToy.Status,
-		&dbToy.CreatedAt,
-		&dbToy.UpdatedAt,
+		&dbReview.ExchangeId,
+		&dbReview.ReviewerId,
+		&dbReview.UserId,
+		&dbReview.Rating,
+		&comment,
+		&dbReview.CreatedAt,
+		&dbReview.UpdatedAt,
 	)
 
+	// отзыв на этот обмен уже оставлен
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -360,57 +1751,47 @@ func (s *Postgres) SelectToyByToken(token string) (*models.Toy, error) {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	if description.Valid {
-		dbToy.Description = &description.String
-	}
-
-	if photoUrl.Valid {
-		dbToy.PhotoUrl = &photoUrl.String
+	if comment.Valid {
+		dbReview.Comment = &comment.String
 	}
 
-	return &dbToy, nil
+	return &dbReview, nil
 }
 
-func (s *Postgres) SelectToysList(query *models.QueryToys, cursor *string, limit int64) ([]models.Toy, *string, error) {
-	const op = "Postgres.SelectToysList"
-
+// buildReviewsQuery собирает запрос страницы отзывов о пользователе
+func buildReviewsQuery(userId string, cursor *string, limit int64) (string, []interface{}) {
 	var (
 		whereClauses []string
 		queryParams  []interface{}
-		paramIndex   = 1
+		paramIndex   = 2
 	)
 
-	if query.Statuses != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND status = ANY($%d)", paramIndex))
-		queryParams = append(queryParams, pq.Array(query.Statuses))
-		paramIndex++
-	}
-
-	if query.ExcludeUserIds != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND user_id != ALL($%d)", paramIndex))
-		queryParams = append(queryParams, pq.Array(query.ExcludeUserIds))
-		paramIndex++
-	}
-
-	if query.UserIds != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND user_id = ANY($%d)", paramIndex))
-		queryParams = append(queryParams, pq.Array(query.UserIds))
-		paramIndex++
-	}
+	queryParams = append(queryParams, userId)
 
+	// сначала новые отзывы, курсор - exchange_id первого отзыва следующей страницы
 	if cursor != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND toy_id >= $%d", paramIndex))
+		whereClauses = append(whereClauses, fmt.Sprintf(
+			"AND (r.created_at, r.exchange_id) <= (SELECT created_at, exchange_id FROM reviews WHERE user_id = $1 AND exchange_id = $%d)",
+			paramIndex))
 		queryParams = append(queryParams, *cursor)
 		paramIndex++
 	}
 
-	whereClauses = append(whereClauses, "ORDER BY toy_id, updated_at DESC")
+	whereClauses = append(whereClauses, "ORDER BY r.created_at DESC, r.exchange_id DESC")
 	whereClauses = append(whereClauses, fmt.Sprintf("LIMIT $%d", paramIndex))
 	queryParams = append(queryParams, limit+1)
 
-	sqlQuery := fmt.Sprintf("%s%s", kSelectToysList, strings.Join(whereClauses, "\n"))
+	sqlQuery := fmt.Sprintf("%s%s", kSelectReviewsByUserId, strings.Join(whereClauses, "\n"))
+
+	return sqlQuery, queryParams
+}
+
+func (s *Postgres) SelectReviewsByUserId(ctx context.Context, userId string, cursor *string, limit int64) ([]models.Review, *string, error) {
+	const op = "Postgres.SelectReviewsByUserId"
+
+	sqlQuery, queryParams := buildReviewsQuery(userId, cursor, limit)
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
 	rows, err := s.db.QueryContext(
@@ -420,343 +1801,182 @@ func (s *Postgres) SelectToysList(query *models.QueryToys, cursor *string, limit
 	)
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("2 %s, %w", op, err)
+		return nil, nil, fmt.Errorf("%s, %w", op, err)
 	}
 	defer rows.Close()
 
-	dbToys := make([]models.Toy, 0)
+	dbReviews := make([]models.Review, 0)
 
 	for rows.Next() {
-		var toy models.Toy
-		var description, photoUrl sql.NullString
+		var review models.Review
+		var comment sql.NullString
 
 		err := rows.Scan(
-			&toy.ToyId,
-			&toy.UserId,
-			&toy.Name,
-			&description,
-			&toy.IdempotencyToken,
-			&photoUrl,
-			&toy.Status,
-			&toy.CreatedAt,
-			&toy.UpdatedAt,
+			&review.ExchangeId,
+			&review.ReviewerId,
+			&review.UserId,
+			&review.Rating,
+			&comment,
+			&review.CreatedAt,
+			&review.UpdatedAt,
 		)
 		if err != nil {
-			return nil, nil, fmt.Errorf("3 %s: %w", op, err)
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
 		}
 
-		if description.Valid {
-			toy.Description = &description.String
-		}
-		if photoUrl.Valid {
-			toy.PhotoUrl = &photoUrl.String
+		if comment.Valid {
+			review.Comment = &comment.String
 		}
 
-		dbToys = append(dbToys, toy)
+		dbReviews = append(dbReviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	var nextCursor *string = nil
-	if int64(len(dbToys)) == limit+1 {
-		nextCursor = &dbToys[len(dbToys)-1].ToyId
-		dbToys = dbToys[:len(dbToys)-1]
+	if int64(len(dbReviews)) == limit+1 {
+		nextCursor = &dbReviews[len(dbReviews)-1].ExchangeId
+		dbReviews = dbReviews[:len(dbReviews)-1]
 	}
 
-	return dbToys, nextCursor, nil
+	return dbReviews, nextCursor, nil
 }
 
-func (s *Postgres) insertExchange(exchange *models.Exchange) (*models.Exchange, error) {
-	const op = "Postgres.insertExchange"
+func (s *Postgres) SelectUserRating(ctx context.Context, userId string) (*models.UserRating, error) {
+	const op = "Postgres.SelectUserRating"
 
-	stmt, err := s.db.Prepare(kInsertExchange)
+	stmt, err := s.stmt(kSelectUserRating)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbExchange models.Exchange
-	err = stmt.QueryRowContext(
-		ctx,
-		exchange.SrcToyId,
-		exchange.DstToyId,
-		exchange.IdempotencyToken,
-	).Scan(
-		&dbExchange.ExchangeId,
-		&dbExchange.SrcToyId,
-		&dbExchange.DstToyId,
-		&dbExchange.Status,
-		&dbExchange.IdempotencyToken,
-		&dbExchange.CreatedAt,
-		&dbExchange.UpdatedAt,
+	var rating models.UserRating
+	err = stmt.QueryRowContext(ctx, userId).Scan(
+		&rating.Average,
+		&rating.Count,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	return &dbExchange, nil
+	return &rating, nil
 }
 
-func (s *Postgres) insertExchangeDetails(exchangeDetails *models.ExchangeDetails) (*models.ExchangeDetails, error) {
-	const op = "Postgres.insertExchangeDetails"
-	stmt, err := s.db.Prepare(kInsertExchangeDetails)
+func (s *Postgres) InsertUserReport(ctx context.Context, report *models.UserReport) (*models.UserReport, error) {
+	const op = "Postgres.InsertUserReport"
+
+	stmt, err := s.stmt(kInsertUserReport)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	var dbExchangeDetails models.ExchangeDetails
+	var dbReport models.UserReport
 	err = stmt.QueryRowContext(
 		ctx,
-		exchangeDetails.ExchangeId,
-		exchangeDetails.ToyId,
-		exchangeDetails.UserId,
+		report.ReporterId,
+		report.UserId,
+		report.Reason,
 	).Scan(
-		&dbExchangeDetails.ExchangeId,
-		&dbExchangeDetails.ToyId,
-		&dbExchangeDetails.UserId,
-		&dbExchangeDetails.Status,
-		&dbExchangeDetails.CreatedAt,
-		&dbExchangeDetails.UpdatedAt,
+		&dbReport.ReportId,
+		&dbReport.ReporterId,
+		&dbReport.UserId,
+		&dbReport.Reason,
+		&dbReport.CreatedAt,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s, %w", op, err)
 	}
 
-	return &dbExchangeDetails, nil
-}
-
-func (s *Postgres) InsertExchange(exchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error) {
-	return runInTx(s.db, func(tx *sql.Tx) (*models.Exchange, error) {
-
-		dbExchange, err := s.insertExchange(exchange)
-		if err != nil {
-			return nil, err
-		}
-
-		exchangeDetails[0].ExchangeId = dbExchange.ExchangeId
-		exchangeDetails[1].ExchangeId = dbExchange.ExchangeId
-
-		for _, details := range exchangeDetails {
-			_, err = s.insertExchangeDetails(&details)
-			if err != nil {
-				return nil, err
-			}
-		}
-
-		return dbExchange, nil
-	})
-}
-
-func getExchangeParticipant(rows *sql.Rows) (*models.ExchangeParticipant, error) {
-	var p models.ExchangeParticipant
-	var toyDesc, toyPhoto, middleName sql.NullString
-
-	err := rows.Scan(
-		&p.ExchangeId,
-		&p.ExchangeStatus,
-		&p.IdempotencyToken,
-		&p.ExchangeCreatedAt,
-		&p.ExchangeUpdatedAt,
-
-		&p.ToyId,
-		&p.ToyName,
-		&toyDesc,
-		&toyPhoto,
-
-		&p.UserId,
-		&p.FirstName,
-		&middleName,
-		&p.LastName,
-
-		&p.UserExchangeStatus,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("%w", err)
-	}
-
-	if toyDesc.Valid {
-		p.ToyDescription = &toyDesc.String
-	}
-	if toyPhoto.Valid {
-		p.ToyPhotoURL = &toyPhoto.String
-	}
-	if middleName.Valid {
-		p.MiddleName = &middleName.String
-	}
-
-	return &p, nil
+	return &dbReport, nil
 }
 
-func (s *Postgres) SelectExchangeWithParticipants(exchangeId string) ([]models.ExchangeParticipant, error) {
-	const op = "Postgres.SelectExchangeWithParticipants"
+func (s *Postgres) InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	const op = "Postgres.InsertUserBlock"
 
-	stmt, err := s.db.Prepare(kSelectExchangeWithParticipants)
+	stmt, err := s.stmt(kInsertUserBlock)
 
 	if err != nil {
-		return nil, fmt.Errorf("%s, %w", op, err)
+		return fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	rows, err := stmt.QueryContext(ctx, exchangeId)
+	_, err = stmt.ExecContext(ctx, userId, blockedUserId)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	defer rows.Close()
-
-	participants := make([]models.ExchangeParticipant, 0)
-	for rows.Next() {
-		p, err := getExchangeParticipant(rows)
-		if err != nil {
-			return nil, fmt.Errorf("%s, %w", op, err)
-		}
-
-		participants = append(participants, *p)
+		return fmt.Errorf("%s, %w", op, err)
 	}
 
-	return participants, nil
-}
-
-func (s *Postgres) UpdateExchangeWithParticipants(exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error) {
-	const op = "Postgres.UpdateExchangeWithParticipants"
-	
-	return runInTx(s.db, func(tx *sql.Tx) ([]models.ExchangeParticipant, error) {
-
-		stmt, err := s.db.Prepare(kUpdateExchangeStatus)
-
-		if err != nil {
-			return nil, fmt.Errorf("%s, %w", op, err)
-		}
-		defer stmt.Close()
-
-		ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
-		defer cancel()
-
-		_, err = stmt.ExecContext(ctx, exchangeId, userId, status)
-		if err != nil {
-			return nil, fmt.Errorf("%s, %w", op, err)
-		}
-
-		return s.SelectExchangeWithParticipants(exchangeId)
-	})
+	return nil
 }
 
-func (s *Postgres) SelectExchangeList(query *models.QueryExchanges, userId string, cursor *string, limit int64) ([]models.ExchangeParticipant, *string, error) {
-	const op = "Postgres.SelectExchangeList"
-
-	var (
-		whereClauses []string
-		queryParams  []interface{}
-		paramIndex   = 2
-	)
-
-	queryParams = append(queryParams, userId)
+func (s *Postgres) DeleteUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	const op = "Postgres.DeleteUserBlock"
 
-	if query.Statuses != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND e.status = ANY($%d)", paramIndex))
-		queryParams = append(queryParams, pq.Array(query.Statuses))
-		paramIndex++
-	}
+	stmt, err := s.stmt(kDeleteUserBlock)
 
-	if cursor != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("AND e.exchange_id >= $%d", paramIndex))
-		queryParams = append(queryParams, *cursor)
-		paramIndex++
+	if err != nil {
+		return fmt.Errorf("%s, %w", op, err)
 	}
 
-	whereClauses = append(whereClauses, "ORDER BY e.exchange_id, e.updated_at DESC")
-	whereClauses = append(whereClauses, fmt.Sprintf("LIMIT $%d", paramIndex))
-	queryParams = append(queryParams, limit+1)
-
-	sqlQuery := fmt.Sprintf("%s%s", kSelectExchangeIdList, strings.Join(whereClauses, "\n"))
-
-	ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(
-		ctx,
-		sqlQuery,
-		queryParams...,
-	)
-
+	_, err = stmt.ExecContext(ctx, userId, blockedUserId)
 	if err != nil {
-		return nil, nil, fmt.Errorf("2 %s, %w", op, err)
-	}
-	defer rows.Close()
-
-	exchangeIds := make([]string, 0)
-	for rows.Next() {
-		var exchangeId string
-		err := rows.Scan(&exchangeId)
-		if err != nil {
-			return nil, nil, fmt.Errorf("3 %s: %w", op, err)
-		}
-
-		exchangeIds = append(exchangeIds, exchangeId)
+		return fmt.Errorf("%s, %w", op, err)
 	}
 
-	fmt.Println(exchangeIds)
+	return nil
+}
 
-	var nextCursor *string = nil
-	if int64(len(exchangeIds)) == limit+1 {
-		nextCursor = &exchangeIds[len(exchangeIds)-1]
-		exchangeIds = exchangeIds[:len(exchangeIds)-1]
-	}
+func (s *Postgres) HasUserBlock(ctx context.Context, userId1 string, userId2 string) (bool, error) {
+	const op = "Postgres.HasUserBlock"
 
-	stmt, err := s.db.Prepare(kSelectExchangeList)
+	stmt, err := s.stmt(kSelectHasUserBlock)
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s, %w", op, err)
+		return false, fmt.Errorf("%s, %w", op, err)
 	}
-	defer stmt.Close()
 
-	ctx2, cancel2 := context.WithTimeout(context.Background(), s.cnf.Timeout)
-	defer cancel2()
+	ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+	defer cancel()
 
-	rows2, err := stmt.QueryContext(ctx2, pq.Array(exchangeIds))
+	var blocked bool
+	err = stmt.QueryRowContext(ctx, userId1, userId2).Scan(&blocked)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s, %w", op, err)
 	}
-	defer rows2.Close()
 
-	participants := make([]models.ExchangeParticipant, 0)
-	for rows2.Next() {
-		p, err := getExchangeParticipant(rows2)
-		if err != nil {
-			return nil, nil, fmt.Errorf("%s, %w", op, err)
-		}
-
-		participants = append(participants, *p)
-	}
-
-	return participants, nextCursor, nil
+	return blocked, nil
 }
 
-func (s *Postgres) CreateUser(user *models.User) (*models.User, error) {
+func (s *Postgres) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
     const op = "Postgres.CreateUser"
 
-    stmt, err := s.db.Prepare(kInsertUser)
+    stmt, err := s.stmt(kInsertUser)
     if err != nil {
         return nil, fmt.Errorf("%s: %w", op, err)
     }
-    defer stmt.Close()
 
-    ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+    ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
     defer cancel()
 
     var dbUser models.User
-    var middleName sql.NullString
+    var middleName, city sql.NullString
+    var lat, lon sql.NullFloat64
     
     err = stmt.QueryRowContext(
         ctx,
@@ -774,6 +1994,9 @@ func (s *Postgres) CreateUser(user *models.User) (*models.User, error) {
 		&dbUser.HashPassword,
         &dbUser.CreatedAt,
         &dbUser.UpdatedAt,
+        &lat,
+        &lon,
+        &city,
     )
 
     if err == sql.ErrNoRows {
@@ -788,23 +2011,25 @@ func (s *Postgres) CreateUser(user *models.User) (*models.User, error) {
 		dbUser.UserName.MiddleName = &middleName.String
 	}
 
+	dbUser.Location = getLocation(lat, lon, city)
+
     return &dbUser, nil
 }
 
-func (s *Postgres) SelectUserByEmail(user *models.User) (*models.User, error) {
+func (s *Postgres) SelectUserByEmail(ctx context.Context, user *models.User) (*models.User, error) {
     const op = "Postgres.SelectUserByEmail"
 
-    stmt, err := s.db.Prepare(kSelectUserByEmail)
+    stmt, err := s.stmt(kSelectUserByEmail)
     if err != nil {
         return nil, fmt.Errorf("%s: %w", op, err)
     }
-    defer stmt.Close()
 
-    ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+    ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
     defer cancel()
 
     var dbUser models.User
-    var middleName sql.NullString
+    var middleName, city sql.NullString
+    var lat, lon sql.NullFloat64
     
     err = stmt.QueryRowContext(
         ctx,
@@ -818,6 +2043,9 @@ func (s *Postgres) SelectUserByEmail(user *models.User) (*models.User, error) {
 		&dbUser.HashPassword,
         &dbUser.CreatedAt,
         &dbUser.UpdatedAt,
+        &lat,
+        &lon,
+        &city,
     )
 
     if err == sql.ErrNoRows {
@@ -832,23 +2060,25 @@ func (s *Postgres) SelectUserByEmail(user *models.User) (*models.User, error) {
 		dbUser.UserName.MiddleName = &middleName.String
 	}
 
+	dbUser.Location = getLocation(lat, lon, city)
+
     return &dbUser, nil
 }
 
-func (s *Postgres) SelectUserById(user *models.User) (*models.User, error) {
+func (s *Postgres) SelectUserById(ctx context.Context, user *models.User) (*models.User, error) {
     const op = "Postgres.SelectUserById"
 
-    stmt, err := s.db.Prepare(kSelectUserById)
+    stmt, err := s.stmt(kSelectUserById)
     if err != nil {
         return nil, fmt.Errorf("%s: %w", op, err)
     }
-    defer stmt.Close()
 
-    ctx, cancel := context.WithTimeout(context.Background(), s.cnf.Timeout)
+    ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
     defer cancel()
 
     var dbUser models.User
-    var middleName sql.NullString
+    var middleName, city sql.NullString
+    var lat, lon sql.NullFloat64
     
     err = stmt.QueryRowContext(
         ctx,
@@ -862,6 +2092,61 @@ func (s *Postgres) SelectUserById(user *models.User) (*models.User, error) {
 		&dbUser.HashPassword,
         &dbUser.CreatedAt,
         &dbUser.UpdatedAt,
+        &lat,
+        &lon,
+        &city,
+    )
+
+    if err == sql.ErrNoRows {
+		return nil, nil
+    }
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if middleName.Valid {
+		dbUser.UserName.MiddleName = &middleName.String
+	}
+
+	dbUser.Location = getLocation(lat, lon, city)
+
+    return &dbUser, nil
+}
+
+func (s *Postgres) UpdateUserLocation(ctx context.Context, userId string, location *models.Location) (*models.User, error) {
+    const op = "Postgres.UpdateUserLocation"
+
+    stmt, err := s.stmt(kUpdateUserLocation)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", op, err)
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, s.cnf.Timeout)
+    defer cancel()
+
+    var dbUser models.User
+    var middleName, city sql.NullString
+    var lat, lon sql.NullFloat64
+
+    err = stmt.QueryRowContext(
+        ctx,
+        userId,
+        location.Lat,
+        location.Lon,
+        location.City,
+    ).Scan(
+        &dbUser.UserId,
+        &dbUser.UserName.FirstName,
+        &middleName,
+        &dbUser.UserName.LastName,
+        &dbUser.Email,
+		&dbUser.HashPassword,
+        &dbUser.CreatedAt,
+        &dbUser.UpdatedAt,
+        &lat,
+        &lon,
+        &city,
     )
 
     if err == sql.ErrNoRows {
@@ -876,5 +2161,7 @@ func (s *Postgres) SelectUserById(user *models.User) (*models.User, error) {
 		dbUser.UserName.MiddleName = &middleName.String
 	}
 
+	dbUser.Location = getLocation(lat, lon, city)
+
     return &dbUser, nil
 }
\ No newline at end of file
@@ -2,34 +2,65 @@ package postgres
 
 const (
 // TOY
-	kSelectToysList = 
+	kToyPhotosJson = 
+	`
+				json_build_object(
+					'photo_id', p.photo_id,
+					'position', p.position,
+					'thumbnail', p.thumbnail_key,
+					'medium', p.medium_key,
+					'full', p.full_key
+				)
+	`
+
+	// фотографии собираются подзапросом по toys.toy_id, поэтому таблица (или подзапрос) должна называться toys
+	kToyColumns = 
 	`
-		SELECT 
 			toy_id,
 			user_id,
 			name,
 			description,
 			idempotency_token,
-			photo_url,
+			COALESCE((
+				SELECT json_agg(` + kToyPhotosJson + ` ORDER BY p.position)
+				FROM toy_photos p
+				WHERE p.toy_id = toys.toy_id
+			), '[]') AS photos,
 			status,
 			created_at,
-			updated_at
-		FROM toys
+			updated_at,
+			category_id,
+			tags,
+			age_min,
+			age_max,
+			condition,
+			lat,
+			lon,
+			city
+	`
+
+	// подзапрос назван toys, чтобы фильтры из SelectToysList ссылались на те же колонки.
+	// %s: score, snippet, distance и FROM (с условием поиска по тексту)
+	kSelectToysList = 
+	`
+		SELECT ` + kToyColumns + `,
+			score,
+			snippet,
+			distance
+		FROM (
+			SELECT 
+				toys.*,
+				%s AS score,
+				%s AS snippet,
+				%s AS distance
+			%s
+		) toys
 		WHERE true
 	`
 
 	kSelectToyById = 
 	`
-		SELECT 
-			toy_id,
-			user_id,
-			name,
-			description,
-			idempotency_token,
-			photo_url,
-			status,
-			created_at,
-			updated_at
+		SELECT ` + kToyColumns + `
 		FROM toys
 		WHERE true
 			AND toy_id = $1
@@ -39,16 +70,7 @@ const (
 
 	kSelectToyByUserId = 
 	`
-		SELECT 
-			toy_id,
-			user_id,
-			name,
-			description,
-			idempotency_token,
-			photo_url,
-			status,
-			created_at,
-			updated_at
+		SELECT ` + kToyColumns + `
 		FROM toys
 		WHERE true
 			AND toy_id = $1
@@ -59,19 +81,11 @@ const (
 
 	kSelectToyByToken = 
 	`
-		SELECT 
-			toy_id,
-			user_id,
-			name,
-			description,
-			idempotency_token,
-			photo_url,
-			status,
-			created_at,
-			updated_at
+		SELECT ` + kToyColumns + `
 		FROM toys
 		WHERE true
 			AND idempotency_token = $1
+			AND user_id = $2
 		;
 	`
 
@@ -82,23 +96,31 @@ const (
     		name,
     		description,
     		idempotency_token,
-			photo_url,
-    		status
+    		status,
+			category_id,
+			tags,
+			age_min,
+			age_max,
+			condition,
+			lat,
+			lon,
+			city
 		) 
-		VALUES ($1, $2, $3, $4, $5, $6)
-		ON CONFLICT (idempotency_token)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, COALESCE($7, '{}'::TEXT[]), $8, $9, $10,
+			-- без своих координат игрушка находится там же, где владелец
+			COALESCE($11, (SELECT lat FROM users WHERE user_id = $1)),
+			COALESCE($12, (SELECT lon FROM users WHERE user_id = $1)),
+			COALESCE($13, (SELECT city FROM users WHERE user_id = $1))
+		)
+		-- повтор возвращает только игрушку того же владельца; WHERE не дает вернуть чужую игрушку,
+		-- даже если ограничение на токен снова станет глобальным: тогда вставка ничего не вернет
+		ON CONFLICT (user_id, idempotency_token)
 		DO UPDATE SET
         	idempotency_token = EXCLUDED.idempotency_token
-		RETURNING 
-			toy_id,
-    		user_id, 
-    		name,
-    		description,
-    		idempotency_token,
-			photo_url,
-    		status,
-    		created_at,
-    		updated_at
+		WHERE toys.user_id = EXCLUDED.user_id
+		-- xmax <> 0 - строка уже была и вернулась через DO UPDATE, то есть это повтор
+		RETURNING ` + kToyColumns + `, (xmax <> 0)
 		;
 	`
 
@@ -112,41 +134,186 @@ const (
 			AND toy_id = $1
     		AND user_id = $2
 			AND status != 'removed'
-		RETURNING 
-			toy_id,
-    		user_id, 
-    		name,
-    		description,
-    		idempotency_token,
-			photo_url,
-    		status,
-    		created_at,
-    		updated_at
+		RETURNING ` + kToyColumns + `
 		;
 	`
 
+	// поля заменяются целиком, не переданные очищаются. Место тоже заменяется целиком, вместе с городом;
+	// без места в запросе ($10 IS NULL) игрушка остается там же
 	kUpdateToy =
 	`
 		UPDATE toys 
 		SET 
 			name = $3,
 			description = $4,
-			photo_url = COALESCE($5, photo_url),
+			category_id = $5,
+			tags = COALESCE($6, '{}'::TEXT[]),
+			age_min = $7,
+			age_max = $8,
+			condition = $9,
+			lat = COALESCE($10, lat),
+			lon = COALESCE($11, lon),
+			city = CASE WHEN $10 IS NULL THEN city ELSE $12 END,
 			updated_at = NOW()
 		WHERE true
 			AND toy_id = $1 
 			AND user_id = $2
 			AND status != 'removed'
-		RETURNING 
-			toy_id,
-    		user_id, 
-    		name,
-    		description,
-    		idempotency_token,
-			photo_url,
-    		status,
-    		created_at,
-    		updated_at
+		RETURNING ` + kToyColumns + `
+		;
+	`
+
+	kSelectCategories = 
+	`
+		SELECT 
+			category_id,
+			parent_id,
+			name
+		FROM categories
+		ORDER BY parent_id NULLS FIRST, name
+		;
+	`
+
+// TOY PHOTO
+	kSelectToyPhotos = 
+	`
+		SELECT
+			p.photo_id,
+			p.position,
+			p.thumbnail_key,
+			p.medium_key,
+			p.full_key
+		FROM toy_photos p
+		WHERE true
+			AND p.toy_id = $1
+		ORDER BY p.position
+		;
+	`
+
+	// изменения фотографий идут в транзакции под блокировкой строки игрушки,
+	// чтобы параллельные запросы не заняли одну позицию и не превысили лимит
+	kSelectToyForUpdate = 
+	`
+		SELECT status
+		FROM toys
+		WHERE true
+			AND toy_id = $1
+			AND user_id = $2
+			AND status != 'removed'
+		FOR UPDATE
+		;
+	`
+
+	// новая фотография добавляется в конец, если их меньше $5
+	kInsertToyPhoto = 
+	`
+		INSERT INTO toy_photos (toy_id, position, thumbnail_key, medium_key, full_key)
+		SELECT $1, COUNT(*), $2, $3, $4
+		FROM toy_photos
+		WHERE toy_id = $1
+		HAVING COUNT(*) < $5
+		RETURNING photo_id
+		;
+	`
+
+	kDeleteToyPhoto = 
+	`
+		DELETE FROM toy_photos
+		WHERE true
+			AND toy_id = $1
+			AND photo_id = $2
+		RETURNING position, thumbnail_key, medium_key, full_key
+		;
+	`
+
+	kShiftToyPhotos = 
+	`
+		UPDATE toy_photos
+		SET position = position - 1
+		WHERE true
+			AND toy_id = $1
+			AND position > $2
+		;
+	`
+
+	// $2 - все фотографии игрушки в новом порядке
+	kUpdateToyPhotosOrder = 
+	`
+		UPDATE toy_photos p
+		SET position = o.ord - 1
+		FROM unnest($2::TEXT[]) WITH ORDINALITY o(photo_id, ord)
+		WHERE true
+			AND p.photo_id = o.photo_id
+			AND p.toy_id = $1
+		;
+	`
+
+// UPLOAD
+	kInsertUploads = 
+	`
+		INSERT INTO uploads (key)
+		SELECT unnest($1::TEXT[])
+		ON CONFLICT (key) DO NOTHING
+		;
+	`
+
+	// файлы привязываются к игрушке, которой принадлежит фотография
+	kAttachUploads = 
+	`
+		UPDATE uploads
+		SET
+			toy_id = $1,
+			released_at = NULL
+		WHERE key = ANY($2::TEXT[])
+		;
+	`
+
+	// файл освобождается, только если на него не ссылаются копии фотографии (например, у копии игрушки после обмена)
+	kReleaseUploads = 
+	`
+		UPDATE uploads u
+		SET released_at = NOW()
+		WHERE true
+			AND u.key = ANY($1::TEXT[])
+			AND u.released_at IS NULL
+			AND NOT ` + kUploadReferenced + `
+		;
+	`
+
+	// фотографии удаленных игрушек не держат файлы: удаление игрушки необратимо
+	kUploadReferenced = 
+	`
+		(
+			EXISTS (SELECT 1 FROM toy_photos p JOIN toys t ON t.toy_id = p.toy_id WHERE p.thumbnail_key = u.key AND t.status != 'removed')
+			OR EXISTS (SELECT 1 FROM toy_photos p JOIN toys t ON t.toy_id = p.toy_id WHERE p.medium_key = u.key AND t.status != 'removed')
+			OR EXISTS (SELECT 1 FROM toy_photos p JOIN toys t ON t.toy_id = p.toy_id WHERE p.full_key = u.key AND t.status != 'removed')
+		)
+	`
+
+	// $2 = NULL - без ограничения
+	kSelectOrphanUploads = 
+	`
+		SELECT
+			u.key,
+			u.toy_id,
+			u.created_at,
+			u.released_at
+		FROM uploads u
+		WHERE true
+			AND u.released_at < $1
+			AND NOT ` + kUploadReferenced + `
+		ORDER BY u.released_at, u.key
+		LIMIT $2
+		;
+	`
+
+	kDeleteUpload = 
+	`
+		DELETE FROM uploads u
+		WHERE true
+			AND u.key = $1
+			AND u.released_at IS NOT NULL
+			AND NOT ` + kUploadReferenced + `
 		;
 	`
 
@@ -202,12 +369,25 @@ const (
             t.toy_id,
             t.name AS toy_name,
             t.description AS toy_description,
-            t.photo_url AS toy_photo_url,
+            COALESCE((
+                SELECT json_agg(` + kToyPhotosJson + ` ORDER BY p.position)
+                FROM toy_photos p
+                WHERE p.toy_id = t.toy_id
+            ), '[]') AS toy_photos,
+            COALESCE(t.lat, u.lat) AS toy_lat,
+            COALESCE(t.lon, u.lon) AS toy_lon,
+            COALESCE(t.city, u.city) AS toy_city,
+            distance_km(
+                COALESCE(t.lat, u.lat), COALESCE(t.lon, u.lon),
+                COALESCE(ot.lat, ou.lat), COALESCE(ot.lon, ou.lon)
+            ) AS toy_distance_km,
             
             u.user_id,
             u.first_name,
             u.middle_name,
             u.last_name,
+            COALESCE(r.average, 0) AS user_rating_average,
+            COALESCE(r.count, 0) AS user_rating_count,
             
             ed.status AS user_exchange_status
 
@@ -215,6 +395,14 @@ const (
         INNER JOIN exchange_details ed ON e.exchange_id = ed.exchange_id
         INNER JOIN toys t ON ed.toy_id = t.toy_id
         INNER JOIN users u ON ed.user_id = u.user_id
+        LEFT JOIN LATERAL (
+            SELECT AVG(rating)::float8 AS average, COUNT(*) AS count
+            FROM reviews
+            WHERE reviews.user_id = u.user_id
+        ) r ON true
+        LEFT JOIN exchange_details od ON od.exchange_id = ed.exchange_id AND od.user_id != ed.user_id
+        LEFT JOIN toys ot ON od.toy_id = ot.toy_id
+        LEFT JOIN users ou ON od.user_id = ou.user_id
         WHERE e.exchange_id = $1
         ORDER BY e.exchange_id, u.user_id
 	`
@@ -230,6 +418,119 @@ const (
 			AND exchange_id = $1;
 	`
 
+	// NO KEY UPDATE не мешает вставке сделок и сообщений, которые ссылаются на игрушку внешним ключом
+	kLockToys = 
+	`
+		SELECT toy_id
+		FROM toys
+		WHERE toy_id = ANY($1::TEXT[])
+		ORDER BY toy_id
+		FOR NO KEY UPDATE
+		;
+	`
+
+	kSelectExchangeForUpdate = 
+	`
+		SELECT
+			exchange_id,
+			src_toy_id,
+			dst_toy_id,
+			status,
+			idempotency_token,
+			created_at,
+			updated_at
+		FROM exchange
+		WHERE exchange_id = $1
+		FOR UPDATE
+		;
+	`
+
+	kSelectExchangeDetails = 
+	`
+		SELECT
+			exchange_id,
+			toy_id,
+			user_id,
+			status,
+			created_at,
+			updated_at
+		FROM exchange_details
+		WHERE exchange_id = $1
+		ORDER BY user_id
+		;
+	`
+
+	kSelectOpenExchangeIds = 
+	`
+		SELECT DISTINCT exchange_id
+		FROM exchange_details
+		WHERE true
+			AND toy_id = ANY($1::TEXT[])
+			AND status NOT IN ('failed', 'success')
+		ORDER BY exchange_id
+		;
+	`
+
+	kUpdateExchangeStatusById = 
+	`
+		UPDATE exchange
+		SET
+			status = $2,
+			updated_at = NOW()
+		WHERE exchange_id = $1
+		;
+	`
+
+	// игрушка переходит к новому владельцу с его местоположением и снова доступна для обмена
+	kTransferToy = 
+	`
+		UPDATE toys t
+		SET
+			user_id = u.user_id,
+			lat = u.lat,
+			lon = u.lon,
+			city = u.city,
+			status = 'created',
+			updated_at = NOW()
+		FROM users u
+		WHERE true
+			AND t.toy_id = $1
+			AND u.user_id = $2
+		;
+	`
+
+	kReleaseToyOwnership = 
+	`
+		UPDATE toy_ownership_history
+		SET released_at = NOW()
+		WHERE true
+			AND toy_id = $1
+			AND released_at IS NULL
+		;
+	`
+
+	// повтор создания игрушки по idempotency_token не добавляет второго владельца
+	kInsertToyOwnership = 
+	`
+		INSERT INTO toy_ownership_history (toy_id, user_id, exchange_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (toy_id) WHERE released_at IS NULL DO NOTHING
+		;
+	`
+
+	kSelectToyOwnershipHistory = 
+	`
+		SELECT
+			user_id,
+			exchange_id,
+			acquired_at,
+			released_at
+		FROM toy_ownership_history
+		WHERE toy_id = $1
+		ORDER BY acquired_at, released_at NULLS LAST
+		;
+	`
+
 	kSelectExchangeIdList = 
 	`
 		SELECT 
@@ -240,32 +541,199 @@ const (
 			AND ed.user_id = $1
 	`
 
+	// failed в ExchangeDetailsStatus стоит между created и confirm_1, поэтому продвижение
+	// сравнивается по позиции в массиве, а не по порядку enum
+	kWhereExchangeAwaitingUser = 
+	`
+			AND e.status IN ('created', 'confirm')
+			AND ed.status != 'failed'
+			AND EXISTS (
+				SELECT 1 FROM exchange_details other
+				WHERE other.exchange_id = e.exchange_id
+					AND other.user_id != ed.user_id
+					AND other.status != 'failed'
+					AND array_position(ARRAY['created', 'confirm_1', 'confirm_2', 'success']::ExchangeDetailsStatus[], ed.status)
+						< array_position(ARRAY['created', 'confirm_1', 'confirm_2', 'success']::ExchangeDetailsStatus[], other.status)
+			)
+	`
+
+	// участники собираются в details одним подзапросом: первым идет инициатор (его игрушка src_toy_id),
+	// distance_km - расстояние до игрушки второй стороны, если у обеих известно место
 	kSelectExchangeList = 
 	`
-        SELECT 
-            e.exchange_id,
-            e.status AS exchange_status,
-            e.idempotency_token,
-            e.created_at AS exchange_created_at,
-            e.updated_at AS exchange_updated_at,
-            
-            t.toy_id,
-            t.name AS toy_name,
-            t.description AS toy_description,
-            t.photo_url AS toy_photo_url,
-            
-            u.user_id,
-            u.first_name,
-            u.middle_name,
-            u.last_name,
-            
-            ed.status AS user_exchange_status
+		SELECT
+			e.exchange_id,
+			e.status,
+			e.idempotency_token,
+			e.created_at,
+			e.updated_at,
+			(
+				SELECT json_agg(json_build_object(
+					'toy', json_build_object(
+						'toy_id', t.toy_id,
+						'user_id', d.user_id,
+						'name', t.name,
+						'description', t.description,
+						'photos', COALESCE((
+							SELECT json_agg(` + kToyPhotosJson + ` ORDER BY p.position)
+							FROM toy_photos p
+							WHERE p.toy_id = t.toy_id
+						), '[]')
+					),
+					'user', json_build_object(
+						'first_name', u.first_name,
+						'middle_name', u.middle_name,
+						'last_name', u.last_name,
+						'rating', json_build_object(
+							'average', COALESCE(r.average, 0),
+							'count', COALESCE(r.count, 0)
+						)
+					),
+					'status', d.status,
+					'distance_km', distance_km(
+						COALESCE(t.lat, u.lat), COALESCE(t.lon, u.lon),
+						COALESCE(ot.lat, ou.lat), COALESCE(ot.lon, ou.lon)
+					)
+				) ORDER BY d.toy_id = e.src_toy_id DESC)
+				FROM exchange_details d
+				INNER JOIN toys t ON d.toy_id = t.toy_id
+				INNER JOIN users u ON d.user_id = u.user_id
+				LEFT JOIN LATERAL (
+					SELECT AVG(rating)::float8 AS average, COUNT(*) AS count
+					FROM reviews
+					WHERE reviews.user_id = u.user_id
+				) r ON true
+				LEFT JOIN exchange_details od ON od.exchange_id = d.exchange_id AND od.user_id != d.user_id
+				LEFT JOIN toys ot ON od.toy_id = ot.toy_id
+				LEFT JOIN users ou ON od.user_id = ou.user_id
+				WHERE d.exchange_id = e.exchange_id
+			) AS details
+		FROM exchange e
+		INNER JOIN exchange_details ed ON e.exchange_id = ed.exchange_id
+		WHERE true
+			AND ed.user_id = $1
+	`
 
-        FROM exchange e
-        INNER JOIN exchange_details ed ON e.exchange_id = ed.exchange_id
-        INNER JOIN toys t ON ed.toy_id = t.toy_id
-        INNER JOIN users u ON ed.user_id = u.user_id
-        WHERE e.exchange_id = ANY($1);
+// MESSAGE
+	kInsertExchangeMessage = 
+	`
+		INSERT INTO exchange_messages
+			(exchange_id, user_id, text, idempotency_token)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT (exchange_id, user_id, idempotency_token)
+		DO UPDATE SET
+			idempotency_token = EXCLUDED.idempotency_token
+		RETURNING
+			message_id,
+			exchange_id,
+			user_id,
+			text,
+			idempotency_token,
+			created_at
+		;
+	`
+
+	kSelectExchangeMessages = 
+	`
+		SELECT
+			m.message_id,
+			m.exchange_id,
+			m.user_id,
+			m.text,
+			m.idempotency_token,
+			m.created_at
+		FROM exchange_messages m
+		WHERE true
+			AND m.exchange_id = $1
+	`
+
+// REVIEW
+	kInsertReview = 
+	`
+		INSERT INTO reviews
+			(exchange_id, reviewer_id, user_id, rating, comment)
+		VALUES
+			($1, $2, $3, $4, $5)
+		ON CONFLICT (exchange_id, reviewer_id) DO NOTHING
+		RETURNING
+			exchange_id,
+			reviewer_id,
+			user_id,
+			rating,
+			comment,
+			created_at,
+			updated_at
+		;
+	`
+
+	kSelectReviewsByUserId = 
+	`
+		SELECT
+			r.exchange_id,
+			r.reviewer_id,
+			r.user_id,
+			r.rating,
+			r.comment,
+			r.created_at,
+			r.updated_at
+		FROM reviews r
+		WHERE true
+			AND r.user_id = $1
+	`
+
+	kSelectUserRating = 
+	`
+		SELECT
+			COALESCE(AVG(rating)::float8, 0),
+			COUNT(*)
+		FROM reviews
+		WHERE user_id = $1
+	`
+
+// BLOCK
+	kInsertUserReport = 
+	`
+		INSERT INTO user_reports
+			(reporter_id, user_id, reason)
+		VALUES
+			($1, $2, $3)
+		RETURNING
+			report_id,
+			reporter_id,
+			user_id,
+			reason,
+			created_at
+		;
+	`
+
+	kInsertUserBlock = 
+	`
+		INSERT INTO user_blocks
+			(user_id, blocked_user_id)
+		VALUES
+			($1, $2)
+		ON CONFLICT (user_id, blocked_user_id) DO NOTHING
+		;
+	`
+
+	kDeleteUserBlock = 
+	`
+		DELETE FROM user_blocks
+		WHERE true
+			AND user_id = $1
+			AND blocked_user_id = $2
+		;
+	`
+
+	kSelectHasUserBlock = 
+	`
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_blocks
+			WHERE (user_id = $1 AND blocked_user_id = $2)
+				OR (user_id = $2 AND blocked_user_id = $1)
+		)
 	`
 
 // USER
@@ -275,19 +743,31 @@ const (
 			(first_name, middle_name, last_name, email, password_hash)
         VALUES ($1, $2, $3, $4, $5)
         ON CONFLICT (email) DO NOTHING
-        RETURNING user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at
+        RETURNING user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at, lat, lon, city
 	`
 
 	kSelectUserByEmail = 
 	`
-		SELECT user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at
+		SELECT user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at, lat, lon, city
 		FROM users
 		WHERE email = $1
 	`
 
+	kUpdateUserLocation = 
+	`
+		UPDATE users
+		SET
+			lat = $2,
+			lon = $3,
+			city = $4,
+			updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at, lat, lon, city
+	`
+
 	kSelectUserById = 
 	`
-		SELECT user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at
+		SELECT user_id, first_name, middle_name, last_name, email, password_hash, created_at, updated_at, lat, lon, city
 		FROM users
 		WHERE user_id = $1
 	`
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// kPreparedQueries готовятся при старте сервиса. Запросы списков собираются из фильтров
+// и выполняются без подготовки, чтобы кэш не рос от каждой новой комбинации фильтров
+var kPreparedQueries = []string{
+	kSelectToyById,
+	kSelectToyByUserId,
+	kSelectToyByToken,
+	kInsertToy,
+	kUpdateToyStatus,
+	kUpdateToy,
+	kSelectCategories,
+	kSelectToyPhotos,
+	kSelectToyForUpdate,
+	kInsertToyPhoto,
+	kDeleteToyPhoto,
+	kShiftToyPhotos,
+	kUpdateToyPhotosOrder,
+	kInsertUploads,
+	kAttachUploads,
+	kReleaseUploads,
+	kSelectOrphanUploads,
+	kDeleteUpload,
+	kInsertExchange,
+	kInsertExchangeDetails,
+	kSelectExchangeWithParticipants,
+	kUpdateExchangeStatus,
+	kLockToys,
+	kSelectExchangeForUpdate,
+	kSelectExchangeDetails,
+	kSelectOpenExchangeIds,
+	kUpdateExchangeStatusById,
+	kTransferToy,
+	kReleaseToyOwnership,
+	kInsertToyOwnership,
+	kSelectToyOwnershipHistory,
+	kInsertExchangeMessage,
+	kInsertReview,
+	kSelectUserRating,
+	kInsertUserReport,
+	kInsertUserBlock,
+	kDeleteUserBlock,
+	kSelectHasUserBlock,
+	kInsertUser,
+	kSelectUserByEmail,
+	kUpdateUserLocation,
+	kSelectUserById,
+}
+
+// statements - подготовленные запросы, общие для всего пула.
+// database/sql сам готовит запрос на соединении при первом использовании и запоминает это
+type statements struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	cache map[string]*sql.Stmt
+}
+
+func newStatements(ctx context.Context, db *sql.DB, queries []string) (*statements, error) {
+	s := &statements{
+		db:    db,
+		cache: make(map[string]*sql.Stmt, len(queries)),
+	}
+
+	for _, query := range queries {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("prepare %q: %w", query, err)
+		}
+
+		s.cache[query] = stmt
+	}
+
+	return s, nil
+}
+
+// get возвращает подготовленный запрос; запрос не из kPreparedQueries готовится при первом вызове.
+// Передавать можно только запросы с постоянным текстом
+func (s *statements) get(query string) (*sql.Stmt, error) {
+	s.mu.RLock()
+	stmt, ok := s.cache[query]
+	s.mu.RUnlock()
+
+	if ok {
+		return stmt, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stmt, ok := s.cache[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache[query] = stmt
+	return stmt, nil
+}
+
+func (s *statements) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range s.cache {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		delete(s.cache, query)
+	}
+
+	return firstErr
+}
+
+// preparedTx - транзакция, которая выполняет запросы через подготовленные запросы пула.
+// Если подготовить запрос не удалось, он выполняется как обычно и вернет ту же ошибку из базы
+type preparedTx struct {
+	*sql.Tx
+	stmts *statements
+}
+
+func (t *preparedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := t.stmts.get(query)
+	if err != nil {
+		return t.Tx.ExecContext(ctx, query, args...)
+	}
+
+	return t.Tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+}
+
+func (t *preparedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := t.stmts.get(query)
+	if err != nil {
+		return t.Tx.QueryContext(ctx, query, args...)
+	}
+
+	return t.Tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+}
+
+func (t *preparedTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := t.stmts.get(query)
+	if err != nil {
+		return t.Tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return t.Tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+}
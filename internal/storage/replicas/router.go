@@ -0,0 +1,391 @@
+package replicas
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Node - отдельная база: основная или реплика
+type Node interface {
+	service.Storage
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type replica struct {
+	node    Node
+	healthy atomic.Bool
+}
+
+// Router направляет запросы на чтение для просмотра в доступные реплики по кругу, остальное - в основную базу.
+// Пользователь, который недавно что-то записал, readYourWrites читает из основной базы,
+// чтобы увидеть свои изменения до того, как они дойдут до реплик. Записи запоминаются в памяти процесса,
+// поэтому гарантия действует только в пределах одного экземпляра сервиса: чтение, которое балансировщик
+// отправил на другой экземпляр, может прийти в реплику и не увидеть запись.
+// Методы, на которых построены проверки перед записью (обмен с участниками, игрушка по id и владельцу,
+// idempotency token, блокировки, пользователи), и сборщик файлов всегда читают основную базу:
+// отставание реплики там приводит к ошибкам, а не к устаревшей выдаче. Реплика, которая еще не получила
+// строку, возвращает пустой результат без ошибки, поэтому повтор в основной базе из read это не исправит
+type Router struct {
+	Node
+
+	replicas       []*replica
+	next           atomic.Uint64
+	readYourWrites time.Duration
+	healthInterval time.Duration
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+// NewRouter считает все реплики доступными до первой проверки в Run
+func NewRouter(primary Node, replicaNodes []Node, readYourWrites time.Duration, healthInterval time.Duration) *Router {
+	r := &Router{
+		Node:           primary,
+		replicas:       make([]*replica, 0, len(replicaNodes)),
+		readYourWrites: readYourWrites,
+		healthInterval: healthInterval,
+		writes:         make(map[string]time.Time),
+	}
+
+	for _, node := range replicaNodes {
+		rep := &replica{node: node}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+
+	return r
+}
+
+// Run проверяет реплики раз в healthInterval и забывает записи старше readYourWrites до отмены ctx
+func (r *Router) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkReplicas(ctx)
+			r.forgetWrites(time.Now())
+		}
+	}
+}
+
+func (r *Router) checkReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, rep := range r.replicas {
+		wg.Add(1)
+		go func(rep *replica) {
+			defer wg.Done()
+			rep.healthy.Store(rep.node.Ping(ctx) == nil)
+		}(rep)
+	}
+
+	wg.Wait()
+}
+
+func (r *Router) forgetWrites(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userId, writtenAt := range r.writes {
+		if now.Sub(writtenAt) > r.readYourWrites {
+			delete(r.writes, userId)
+		}
+	}
+}
+
+// wrote запоминает время записи пользователя из ctx
+func (r *Router) wrote(ctx context.Context) {
+	userId, ok := service.UserIdFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	r.writes[userId] = time.Now()
+	r.mu.Unlock()
+}
+
+func (r *Router) recentlyWrote(ctx context.Context) bool {
+	userId, ok := service.UserIdFromContext(ctx)
+	if !ok {
+		return false
+	}
+
+	r.mu.Lock()
+	writtenAt, found := r.writes[userId]
+	r.mu.Unlock()
+
+	return found && time.Since(writtenAt) <= r.readYourWrites
+}
+
+// pick возвращает следующую доступную реплику, nil - читать из основной базы
+func (r *Router) pick(ctx context.Context) Node {
+	if len(r.replicas) == 0 || r.recentlyWrote(ctx) {
+		return nil
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.healthy.Load() {
+			return rep.node
+		}
+	}
+
+	return nil
+}
+
+// read выполняет fn на реплике; если реплика вернула ошибку, запрос повторяется в основной базе
+func read[T any](r *Router, ctx context.Context, fn func(s service.Storage) (T, error)) (T, error) {
+	if node := r.pick(ctx); node != nil {
+		object, err := fn(node)
+		if err == nil || ctx.Err() != nil {
+			return object, err
+		}
+	}
+
+	return fn(r.Node)
+}
+
+// write выполняет fn в основной базе и после успешной записи переключает чтения пользователя на нее
+func write[T any](r *Router, ctx context.Context, fn func(s service.Storage) (T, error)) (T, error) {
+	object, err := fn(r.Node)
+	if err == nil {
+		r.wrote(ctx)
+	}
+
+	return object, err
+}
+
+func writeErr(r *Router, ctx context.Context, fn func(s service.Storage) error) error {
+	_, err := write(r, ctx, func(s service.Storage) (struct{}, error) {
+		return struct{}{}, fn(s)
+	})
+
+	return err
+}
+
+// Close закрывает основную базу и все реплики
+func (r *Router) Close() error {
+	errs := []error{r.Node.Close()}
+	for _, rep := range r.replicas {
+		errs = append(errs, rep.node.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// TOY
+
+func (r *Router) InsertToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	return write(r, ctx, func(s service.Storage) (*models.Toy, error) {
+		return s.InsertToy(ctx, newToy)
+	})
+}
+
+// SelectToyById читает основную базу: игрушку только что мог создать или получить по обмену другой пользователь
+func (r *Router) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	return r.Node.SelectToyById(ctx, toyId)
+}
+
+func (r *Router) UpdateToyStatus(ctx context.Context, toyId string, userId string, status models.ToyStatus) (*models.Toy, error) {
+	return write(r, ctx, func(s service.Storage) (*models.Toy, error) {
+		return s.UpdateToyStatus(ctx, toyId, userId, status)
+	})
+}
+
+func (r *Router) UpdateToy(ctx context.Context, newToy *models.Toy) (*models.Toy, error) {
+	return write(r, ctx, func(s service.Storage) (*models.Toy, error) {
+		return s.UpdateToy(ctx, newToy)
+	})
+}
+
+type toysPage struct {
+	toys   []models.Toy
+	cursor *models.Keyset
+	total  *models.Total
+}
+
+func (r *Router) SelectToysList(ctx context.Context, query *models.QueryToys, userId string, sort *models.ToysSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.Toy, *models.Keyset, *models.Total, error) {
+	page, err := read(r, ctx, func(s service.Storage) (toysPage, error) {
+		toys, next, total, err := s.SelectToysList(ctx, query, userId, sort, cursor, limit, withTotal)
+		return toysPage{toys: toys, cursor: next, total: total}, err
+	})
+
+	return page.toys, page.cursor, page.total, err
+}
+
+func (r *Router) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	return read(r, ctx, func(s service.Storage) ([]models.Category, error) {
+		return s.SelectCategories(ctx)
+	})
+}
+
+func (r *Router) SelectToyOwnershipHistory(ctx context.Context, toyId string) ([]models.ToyOwnership, error) {
+	return read(r, ctx, func(s service.Storage) ([]models.ToyOwnership, error) {
+		return s.SelectToyOwnershipHistory(ctx, toyId)
+	})
+}
+
+// TOY PHOTO
+
+func (r *Router) InsertToyPhoto(ctx context.Context, toyId string, userId string, photo *models.PhotoSet) ([]models.ToyPhoto, error) {
+	return write(r, ctx, func(s service.Storage) ([]models.ToyPhoto, error) {
+		return s.InsertToyPhoto(ctx, toyId, userId, photo)
+	})
+}
+
+func (r *Router) DeleteToyPhoto(ctx context.Context, toyId string, userId string, photoId string) ([]models.ToyPhoto, error) {
+	return write(r, ctx, func(s service.Storage) ([]models.ToyPhoto, error) {
+		return s.DeleteToyPhoto(ctx, toyId, userId, photoId)
+	})
+}
+
+func (r *Router) UpdateToyPhotosOrder(ctx context.Context, toyId string, userId string, photoIds []string) ([]models.ToyPhoto, error) {
+	return write(r, ctx, func(s service.Storage) ([]models.ToyPhoto, error) {
+		return s.UpdateToyPhotosOrder(ctx, toyId, userId, photoIds)
+	})
+}
+
+// UPLOAD
+
+func (r *Router) InsertUploads(ctx context.Context, keys []string) error {
+	return writeErr(r, ctx, func(s service.Storage) error {
+		return s.InsertUploads(ctx, keys)
+	})
+}
+
+func (r *Router) DeleteUpload(ctx context.Context, key string) (bool, error) {
+	return write(r, ctx, func(s service.Storage) (bool, error) {
+		return s.DeleteUpload(ctx, key)
+	})
+}
+
+// EXCHANGE
+
+func (r *Router) InsertExchange(ctx context.Context, exchange *models.Exchange, exchangeDetails []models.ExchangeDetails) (*models.Exchange, error) {
+	return write(r, ctx, func(s service.Storage) (*models.Exchange, error) {
+		return s.InsertExchange(ctx, exchange, exchangeDetails)
+	})
+}
+
+// SelectExchangeWithParticipants читает основную базу: по нему проверяют участника перед сообщением
+// и отзывом, а обмен создает и завершает вторая сторона, чьи записи readYourWrites не учитывает
+func (r *Router) SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error) {
+	return r.Node.SelectExchangeWithParticipants(ctx, exchangeId)
+}
+
+func (r *Router) UpdateExchangeWithParticipants(ctx context.Context, exchangeId string, userId string, status models.ExchangeDetailsStatus) ([]models.ExchangeParticipant, error) {
+	return write(r, ctx, func(s service.Storage) ([]models.ExchangeParticipant, error) {
+		return s.UpdateExchangeWithParticipants(ctx, exchangeId, userId, status)
+	})
+}
+
+type exchangesPage struct {
+	exchanges []models.ExchangeInfo
+	cursor    *models.Keyset
+	total     *models.Total
+}
+
+func (r *Router) SelectExchangeList(ctx context.Context, query *models.QueryExchanges, userId string, sort *models.ExchangesSort, cursor *models.Keyset, limit int64, withTotal *string) ([]models.ExchangeInfo, *models.Keyset, *models.Total, error) {
+	page, err := read(r, ctx, func(s service.Storage) (exchangesPage, error) {
+		exchanges, next, total, err := s.SelectExchangeList(ctx, query, userId, sort, cursor, limit, withTotal)
+		return exchangesPage{exchanges: exchanges, cursor: next, total: total}, err
+	})
+
+	return page.exchanges, page.cursor, page.total, err
+}
+
+// MESSAGE
+
+func (r *Router) InsertExchangeMessage(ctx context.Context, message *models.ExchangeMessage) (*models.ExchangeMessage, error) {
+	return write(r, ctx, func(s service.Storage) (*models.ExchangeMessage, error) {
+		return s.InsertExchangeMessage(ctx, message)
+	})
+}
+
+type messagesPage struct {
+	messages []models.ExchangeMessage
+	cursor   *string
+}
+
+func (r *Router) SelectExchangeMessages(ctx context.Context, exchangeId string, cursor *string, limit int64) ([]models.ExchangeMessage, *string, error) {
+	page, err := read(r, ctx, func(s service.Storage) (messagesPage, error) {
+		messages, next, err := s.SelectExchangeMessages(ctx, exchangeId, cursor, limit)
+		return messagesPage{messages: messages, cursor: next}, err
+	})
+
+	return page.messages, page.cursor, err
+}
+
+// REVIEW
+
+func (r *Router) InsertReview(ctx context.Context, review *models.Review) (*models.Review, error) {
+	return write(r, ctx, func(s service.Storage) (*models.Review, error) {
+		return s.InsertReview(ctx, review)
+	})
+}
+
+type reviewsPage struct {
+	reviews []models.Review
+	cursor  *string
+}
+
+func (r *Router) SelectReviewsByUserId(ctx context.Context, userId string, cursor *string, limit int64) ([]models.Review, *string, error) {
+	page, err := read(r, ctx, func(s service.Storage) (reviewsPage, error) {
+		reviews, next, err := s.SelectReviewsByUserId(ctx, userId, cursor, limit)
+		return reviewsPage{reviews: reviews, cursor: next}, err
+	})
+
+	return page.reviews, page.cursor, err
+}
+
+func (r *Router) SelectUserRating(ctx context.Context, userId string) (*models.UserRating, error) {
+	return read(r, ctx, func(s service.Storage) (*models.UserRating, error) {
+		return s.SelectUserRating(ctx, userId)
+	})
+}
+
+// BLOCK
+
+func (r *Router) InsertUserReport(ctx context.Context, report *models.UserReport) (*models.UserReport, error) {
+	return write(r, ctx, func(s service.Storage) (*models.UserReport, error) {
+		return s.InsertUserReport(ctx, report)
+	})
+}
+
+func (r *Router) InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	return writeErr(r, ctx, func(s service.Storage) error {
+		return s.InsertUserBlock(ctx, userId, blockedUserId)
+	})
+}
+
+func (r *Router) DeleteUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	return writeErr(r, ctx, func(s service.Storage) error {
+		return s.DeleteUserBlock(ctx, userId, blockedUserId)
+	})
+}
+
+// USER
+
+func (r *Router) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	return write(r, ctx, func(s service.Storage) (*models.User, error) {
+		return s.CreateUser(ctx, user)
+	})
+}
+
+func (r *Router) UpdateUserLocation(ctx context.Context, userId string, location *models.Location) (*models.User, error) {
+	return write(r, ctx, func(s service.Storage) (*models.User, error) {
+		return s.UpdateUserLocation(ctx, userId, location)
+	})
+}
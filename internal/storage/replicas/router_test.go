@@ -0,0 +1,188 @@
+package replicas
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeNode записывает, в какую базу пришел запрос; остальные методы Storage не вызываются
+type fakeNode struct {
+	service.Storage
+	name  string
+	down  bool
+	calls *[]string
+}
+
+func (f *fakeNode) Ping(ctx context.Context) error {
+	if f.down {
+		return errors.New("down")
+	}
+
+	return nil
+}
+
+func (f *fakeNode) Close() error {
+	return nil
+}
+
+func (f *fakeNode) SelectCategories(ctx context.Context) ([]models.Category, error) {
+	*f.calls = append(*f.calls, f.name)
+
+	if f.down {
+		return nil, errors.New("down")
+	}
+
+	return []models.Category{}, nil
+}
+
+func (f *fakeNode) SelectToyById(ctx context.Context, toyId string) (*models.Toy, error) {
+	*f.calls = append(*f.calls, f.name)
+	return nil, nil
+}
+
+func (f *fakeNode) SelectExchangeWithParticipants(ctx context.Context, exchangeId string) ([]models.ExchangeParticipant, error) {
+	*f.calls = append(*f.calls, f.name)
+	return []models.ExchangeParticipant{}, nil
+}
+
+func (f *fakeNode) InsertUserBlock(ctx context.Context, userId string, blockedUserId string) error {
+	*f.calls = append(*f.calls, f.name)
+	return nil
+}
+
+func newTestRouter(calls *[]string, replicaNames ...string) (*Router, []*fakeNode) {
+	fakes := make([]*fakeNode, 0, len(replicaNames))
+	nodes := make([]Node, 0, len(replicaNames))
+	for _, name := range replicaNames {
+		node := &fakeNode{name: name, calls: calls}
+		fakes = append(fakes, node)
+		nodes = append(nodes, node)
+	}
+
+	return NewRouter(&fakeNode{name: "primary", calls: calls}, nodes, time.Minute, time.Minute), fakes
+}
+
+func TestRouterRoundRobin(t *testing.T) {
+	var calls []string
+	router, _ := newTestRouter(&calls, "r1", "r2")
+
+	for i := 0; i < 4; i++ {
+		if _, err := router.SelectCategories(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"r2", "r1", "r2", "r1"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRouterSkipsUnhealthyReplicas(t *testing.T) {
+	var calls []string
+	router, fakes := newTestRouter(&calls, "r1", "r2")
+
+	fakes[1].down = true
+	router.checkReplicas(context.Background())
+
+	for i := 0; i < 2; i++ {
+		router.SelectCategories(context.Background())
+	}
+
+	fakes[0].down = true
+	router.checkReplicas(context.Background())
+
+	router.SelectCategories(context.Background())
+
+	want := []string{"r1", "r1", "primary"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRouterFallsBackToPrimaryOnReplicaError(t *testing.T) {
+	var calls []string
+	router, fakes := newTestRouter(&calls, "r1")
+
+	// реплика упала между проверками
+	fakes[0].down = true
+
+	if _, err := router.SelectCategories(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"r1", "primary"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRouterReadYourWrites(t *testing.T) {
+	var calls []string
+	router, _ := newTestRouter(&calls, "r1")
+
+	writer := service.WithUserId(context.Background(), "user_1")
+	other := service.WithUserId(context.Background(), "user_2")
+
+	if err := router.InsertUserBlock(writer, "user_1", "user_3"); err != nil {
+		t.Fatal(err)
+	}
+
+	router.SelectCategories(writer)
+	router.SelectCategories(other)
+
+	// окно закончилось
+	router.forgetWrites(time.Now().Add(2 * time.Minute))
+	router.SelectCategories(writer)
+
+	want := []string{"primary", "primary", "r1", "r1"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+// TestRouterReadYourWritesPerInstance - запись видна только тому Router, через который она прошла:
+// другой экземпляр сервиса над теми же базами читает из реплики
+func TestRouterReadYourWritesPerInstance(t *testing.T) {
+	var calls []string
+	primary := &fakeNode{name: "primary", calls: &calls}
+	replica := &fakeNode{name: "r1", calls: &calls}
+
+	first := NewRouter(primary, []Node{replica}, time.Minute, time.Minute)
+	second := NewRouter(primary, []Node{replica}, time.Minute, time.Minute)
+
+	ctx := service.WithUserId(context.Background(), "user_1")
+	if err := first.InsertUserBlock(ctx, "user_1", "user_2"); err != nil {
+		t.Fatal(err)
+	}
+
+	first.SelectCategories(ctx)
+	second.SelectCategories(ctx)
+
+	want := []string{"primary", "primary", "r1"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+// TestRouterPreWriteChecksReadPrimary - проверки перед записью не видят отставания реплик,
+// даже если пользователь сам ничего не записывал
+func TestRouterPreWriteChecksReadPrimary(t *testing.T) {
+	var calls []string
+	router, _ := newTestRouter(&calls, "r1", "r2")
+
+	ctx := service.WithUserId(context.Background(), "user_1")
+	router.SelectExchangeWithParticipants(ctx, "exchange_1")
+	router.SelectToyById(ctx, "toy_1")
+
+	want := []string{"primary", "primary"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
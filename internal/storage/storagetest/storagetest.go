@@ -0,0 +1,821 @@
+// Package storagetest - общий набор проверок service.Storage. Один и тот же набор запускается
+// для Postgres, Pgx и хранилища в памяти, чтобы их поведение не расходилось.
+// Данные каждой проверки создаются с уникальными id и email, поэтому набор можно запускать на непустой базе
+package storagetest
+
+import (
+	"service/internal/models"
+	"service/internal/service"
+
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func newToken(t *testing.T) string {
+	return fmt.Sprintf("%s-%s", t.Name(), uuid.NewString())
+}
+
+// NewUser создает пользователя с уникальным email
+func NewUser(t *testing.T, storage service.Storage) *models.User {
+	t.Helper()
+
+	user, err := storage.CreateUser(context.Background(), &models.User{
+		UserName:     models.UserName{FirstName: "Иван", LastName: "Иванов"},
+		HashPassword: "hash",
+		Email:        fmt.Sprintf("%s@example.com", uuid.NewString()),
+	})
+	if err != nil || user == nil {
+		t.Fatalf("CreateUser: %v, %v", user, err)
+	}
+
+	return user
+}
+
+// NewToy создает игрушку пользователя в статусе created
+func NewToy(t *testing.T, storage service.Storage, userId string, name string) *models.Toy {
+	t.Helper()
+
+	toy, err := storage.InsertToy(context.Background(), &models.Toy{
+		UserId:           userId,
+		Name:             name,
+		IdempotencyToken: newToken(t),
+		Status:           models.KCreatedToyStatus,
+		Tags:             []string{},
+	})
+	if err != nil || toy == nil {
+		t.Fatalf("InsertToy: %v, %v", toy, err)
+	}
+
+	return toy
+}
+
+// InsertExchange - владелец src предлагает обменять ее на игрушку dst; ошибка возвращается вызывающему
+func InsertExchange(t *testing.T, storage service.Storage, src *models.Toy, dst *models.Toy) (*models.Exchange, error) {
+	return storage.InsertExchange(context.Background(), &models.Exchange{
+		SrcToyId:         src.ToyId,
+		DstToyId:         dst.ToyId,
+		IdempotencyToken: newToken(t),
+	}, []models.ExchangeDetails{
+		{ToyId: src.ToyId, UserId: src.UserId},
+		{ToyId: dst.ToyId, UserId: dst.UserId},
+	})
+}
+
+// NewExchange - то же, что InsertExchange, но ошибка завершает тест
+func NewExchange(t *testing.T, storage service.Storage, src *models.Toy, dst *models.Toy) *models.Exchange {
+	t.Helper()
+
+	exchange, err := InsertExchange(t, storage, src, dst)
+	if err != nil || exchange == nil {
+		t.Fatalf("InsertExchange: %v, %v", exchange, err)
+	}
+
+	return exchange
+}
+
+// SetStatus меняет статус участника, ошибка завершает тест
+func SetStatus(t *testing.T, storage service.Storage, exchangeId string, userId string, status models.ExchangeDetailsStatus) []models.ExchangeParticipant {
+	t.Helper()
+
+	participants, err := storage.UpdateExchangeWithParticipants(context.Background(), exchangeId, userId, status)
+	if err != nil {
+		t.Fatalf("UpdateExchangeWithParticipants %s: %v", status, err)
+	}
+
+	return participants
+}
+
+// ExchangeStatus - статус обмена и статусы участников по user_id
+func ExchangeStatus(t *testing.T, storage service.Storage, exchangeId string) (models.ExchangeStatus, map[string]models.ExchangeDetailsStatus) {
+	t.Helper()
+
+	participants, err := storage.SelectExchangeWithParticipants(context.Background(), exchangeId)
+	if err != nil || len(participants) != 2 {
+		t.Fatalf("SelectExchangeWithParticipants: %v, %v", participants, err)
+	}
+
+	statuses := make(map[string]models.ExchangeDetailsStatus, len(participants))
+	for _, participant := range participants {
+		statuses[participant.UserId] = participant.UserExchangeStatus
+	}
+
+	return participants[0].ExchangeStatus, statuses
+}
+
+// Run запускает все проверки для storage
+func Run(t *testing.T, storage service.Storage) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, storage) })
+	t.Run("Toys", func(t *testing.T) { testToys(t, storage) })
+	t.Run("Photos", func(t *testing.T) { testPhotos(t, storage) })
+	t.Run("ToysList", func(t *testing.T) { testToysList(t, storage) })
+	t.Run("ExchangeFlow", func(t *testing.T) { testExchangeFlow(t, storage) })
+	t.Run("ExchangeFailed", func(t *testing.T) { testExchangeFailed(t, storage) })
+	t.Run("ToyRemoval", func(t *testing.T) { testToyRemoval(t, storage) })
+	t.Run("ExchangeList", func(t *testing.T) { testExchangeList(t, storage) })
+	t.Run("Messages", func(t *testing.T) { testMessages(t, storage) })
+	t.Run("Reviews", func(t *testing.T) { testReviews(t, storage) })
+	t.Run("Blocks", func(t *testing.T) { testBlocks(t, storage) })
+}
+
+func testUsers(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	user := NewUser(t, storage)
+
+	duplicate, err := storage.CreateUser(ctx, &models.User{
+		UserName:     user.UserName,
+		HashPassword: "other",
+		Email:        user.Email,
+	})
+	if err != nil || duplicate != nil {
+		t.Fatalf("CreateUser with taken email = %v, %v, want nil", duplicate, err)
+	}
+
+	byEmail, err := storage.SelectUserByEmail(ctx, &models.User{Email: user.Email})
+	if err != nil || byEmail == nil || byEmail.UserId != user.UserId {
+		t.Fatalf("SelectUserByEmail = %v, %v", byEmail, err)
+	}
+
+	missing, err := storage.SelectUserById(ctx, &models.User{UserId: uuid.NewString()})
+	if err != nil || missing != nil {
+		t.Fatalf("SelectUserById of unknown user = %v, %v, want nil", missing, err)
+	}
+
+	updated, err := storage.UpdateUserLocation(ctx, user.UserId, &models.Location{Lat: 55.75, Lon: 37.62, City: strPtr("Москва")})
+	if err != nil || updated == nil || updated.Location == nil || *updated.Location.City != "Москва" {
+		t.Fatalf("UpdateUserLocation = %v, %v", updated, err)
+	}
+
+	byId, err := storage.SelectUserById(ctx, &models.User{UserId: user.UserId})
+	if err != nil || byId == nil || byId.Location == nil || byId.Location.Lat != 55.75 {
+		t.Fatalf("SelectUserById = %v, %v", byId, err)
+	}
+}
+
+func testToys(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	owner := NewUser(t, storage)
+	other := NewUser(t, storage)
+
+	if _, err := storage.UpdateUserLocation(ctx, owner.UserId, &models.Location{Lat: 59.94, Lon: 30.31}); err != nil {
+		t.Fatal(err)
+	}
+
+	newToy := &models.Toy{
+		UserId:           owner.UserId,
+		Name:             "Паровоз",
+		IdempotencyToken: newToken(t),
+		Status:           models.KCreatedToyStatus,
+		CategoryId:       strPtr("vehicles"),
+		Tags:             []string{"дерево"},
+	}
+
+	toy, err := storage.InsertToy(ctx, newToy)
+	if err != nil || toy == nil {
+		t.Fatalf("InsertToy: %v, %v", toy, err)
+	}
+
+	// игрушка без своего места находится там же, где владелец
+	if toy.Location == nil || toy.Location.Lat != 59.94 {
+		t.Errorf("toy location = %v, want owner location", toy.Location)
+	}
+
+	repeated, err := storage.InsertToy(ctx, newToy)
+	if err != nil || repeated == nil || repeated.ToyId != toy.ToyId {
+		t.Fatalf("InsertToy with the same token = %v, %v, want toy %s", repeated, err, toy.ToyId)
+	}
+
+	byToken, err := storage.SelectToyByToken(ctx, newToy.IdempotencyToken, owner.UserId)
+	if err != nil || byToken == nil || byToken.ToyId != toy.ToyId {
+		t.Fatalf("SelectToyByToken = %v, %v", byToken, err)
+	}
+
+	foreign, err := storage.SelectToyByUserId(ctx, toy.ToyId, other.UserId)
+	if err != nil || foreign != nil {
+		t.Fatalf("SelectToyByUserId of other user = %v, %v, want nil", foreign, err)
+	}
+
+	toy.Name = "Паровозик"
+	updated, err := storage.UpdateToy(ctx, toy)
+	if err != nil || updated == nil || updated.Name != "Паровозик" {
+		t.Fatalf("UpdateToy = %v, %v", updated, err)
+	}
+
+	// UpdateToy заменяет игрушку целиком: не переданные поля очищаются, а без места она остается там же
+	categoryId, ageMin, condition := "puzzles", 3, models.KNewToyCondition
+	toy.CategoryId, toy.Tags, toy.AgeMin, toy.Condition = &categoryId, []string{"дерево"}, &ageMin, &condition
+	toy.Location = &models.Location{Lat: 55.75, Lon: 37.62, City: strPtr("Москва")}
+	if _, err := storage.UpdateToy(ctx, toy); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err = storage.UpdateToy(ctx, &models.Toy{ToyId: toy.ToyId, UserId: owner.UserId, Name: "Поезд"})
+	if err != nil || updated == nil || updated.Name != "Поезд" {
+		t.Fatalf("UpdateToy with name only = %v, %v", updated, err)
+	}
+
+	if updated.CategoryId != nil || len(updated.Tags) != 0 || updated.AgeMin != nil || updated.Condition != nil {
+		t.Errorf("UpdateToy with name only = %+v, want other fields cleared", updated)
+	}
+
+	if updated.Location == nil || updated.Location.Lat != 55.75 || updated.Location.City == nil {
+		t.Errorf("location after UpdateToy without location = %+v, want unchanged", updated.Location)
+	}
+
+	// новое место без города не оставляет старый город
+	updated, err = storage.UpdateToy(ctx, &models.Toy{ToyId: toy.ToyId, UserId: owner.UserId, Name: "Поезд", Location: &models.Location{Lat: 59.94, Lon: 30.31}})
+	if err != nil || updated == nil || updated.Location == nil || updated.Location.Lat != 59.94 || updated.Location.City != nil {
+		t.Fatalf("UpdateToy with a new location = %+v, %v, want the city cleared", updated, err)
+	}
+
+	history, err := storage.SelectToyOwnershipHistory(ctx, toy.ToyId)
+	if err != nil || len(history) != 1 || history[0].UserId != owner.UserId || history[0].ReleasedAt != nil {
+		t.Fatalf("SelectToyOwnershipHistory = %v, %v", history, err)
+	}
+
+	categories, err := storage.SelectCategories(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parents := make(map[string]*string, len(categories))
+	for _, category := range categories {
+		parents[category.CategoryId] = category.ParentId
+	}
+
+	if parent, ok := parents["puzzles"]; !ok || parent == nil || *parent != "games" {
+		t.Errorf("category puzzles parent = %v, want games", parent)
+	}
+}
+
+func testPhotos(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	owner := NewUser(t, storage)
+	toy := NewToy(t, storage, owner.UserId, "Кукла")
+
+	photoSet := func() *models.PhotoSet {
+		prefix := uuid.NewString()
+		return &models.PhotoSet{Thumbnail: prefix + "_t", Medium: prefix + "_m", Full: prefix + "_f"}
+	}
+
+	first, second := photoSet(), photoSet()
+	if err := storage.InsertUploads(ctx, append(first.Keys(), second.Keys()...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.InsertToyPhoto(ctx, toy.ToyId, owner.UserId, first); err != nil {
+		t.Fatal(err)
+	}
+
+	photos, err := storage.InsertToyPhoto(ctx, toy.ToyId, owner.UserId, second)
+	if err != nil || len(photos) != 2 || photos[0].Full != first.Full || photos[1].Position != 1 {
+		t.Fatalf("InsertToyPhoto = %v, %v", photos, err)
+	}
+
+	photos, err = storage.UpdateToyPhotosOrder(ctx, toy.ToyId, owner.UserId, []string{photos[1].PhotoId, photos[0].PhotoId})
+	if err != nil || len(photos) != 2 || photos[0].Full != second.Full {
+		t.Fatalf("UpdateToyPhotosOrder = %v, %v", photos, err)
+	}
+
+	photos, err = storage.DeleteToyPhoto(ctx, toy.ToyId, owner.UserId, photos[0].PhotoId)
+	if err != nil || len(photos) != 1 || photos[0].Full != first.Full || photos[0].Position != 0 {
+		t.Fatalf("DeleteToyPhoto = %v, %v", photos, err)
+	}
+
+	orphans, err := storage.SelectOrphanUploads(ctx, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := make(map[string]bool)
+	for _, upload := range orphans {
+		released[upload.Key] = true
+	}
+
+	if !released[second.Full] || released[first.Full] {
+		t.Errorf("orphan uploads: deleted photo released = %v, kept photo released = %v", released[second.Full], released[first.Full])
+	}
+
+	if deleted, err := storage.DeleteUpload(ctx, second.Full); err != nil || !deleted {
+		t.Fatalf("DeleteUpload of a released file = %v, %v, want deleted", deleted, err)
+	}
+
+	if deleted, err := storage.DeleteUpload(ctx, first.Full); err != nil || deleted {
+		t.Fatalf("DeleteUpload of a referenced file = %v, %v, want kept", deleted, err)
+	}
+
+	// фотографии игрушки в обмене не меняются
+	if _, err := storage.UpdateToyStatus(ctx, toy.ToyId, owner.UserId, models.KExchangingToyStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.InsertToyPhoto(ctx, toy.ToyId, owner.UserId, photoSet()); !errors.Is(err, models.ErrToyNotEditable) {
+		t.Errorf("InsertToyPhoto to exchanging toy: %v, want ErrToyNotEditable", err)
+	}
+
+	if _, err := storage.DeleteToyPhoto(ctx, toy.ToyId, owner.UserId, photos[0].PhotoId); !errors.Is(err, models.ErrToyNotEditable) {
+		t.Errorf("DeleteToyPhoto of exchanging toy: %v, want ErrToyNotEditable", err)
+	}
+
+	if _, err := storage.UpdateToyPhotosOrder(ctx, toy.ToyId, owner.UserId, []string{photos[0].PhotoId}); !errors.Is(err, models.ErrToyNotEditable) {
+		t.Errorf("UpdateToyPhotosOrder of exchanging toy: %v, want ErrToyNotEditable", err)
+	}
+
+	withPhoto := *toy
+	withPhoto.Photos = []models.ToyPhoto{{PhotoSet: *photoSet()}}
+	if _, err := storage.UpdateToy(ctx, &withPhoto); !errors.Is(err, models.ErrToyNotEditable) {
+		t.Errorf("UpdateToy with a photo of exchanging toy: %v, want ErrToyNotEditable", err)
+	}
+
+	// фотографии удаленной игрушки больше не держат файлы
+	if _, err := storage.UpdateToyStatus(ctx, toy.ToyId, owner.UserId, models.KRemovedToyStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err = storage.SelectOrphanUploads(ctx, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released = make(map[string]bool)
+	for _, upload := range orphans {
+		released[upload.Key] = true
+	}
+
+	if !released[first.Full] {
+		t.Errorf("photo of a removed toy is not released")
+	}
+
+	// повтор создания игрушки не добавляет фотографию повтора, ее файлы остаются освобожденными
+	created, retried := photoSet(), photoSet()
+	if err := storage.InsertUploads(ctx, append(created.Keys(), retried.Keys()...)); err != nil {
+		t.Fatal(err)
+	}
+
+	newToy := &models.Toy{
+		UserId:           owner.UserId,
+		Name:             "Юла",
+		IdempotencyToken: newToken(t),
+		Status:           models.KCreatedToyStatus,
+		Tags:             []string{},
+		Photos:           []models.ToyPhoto{{PhotoSet: *created}},
+	}
+
+	if _, err := storage.InsertToy(ctx, newToy); err != nil {
+		t.Fatal(err)
+	}
+
+	newToy.Photos = []models.ToyPhoto{{PhotoSet: *retried}}
+	replayed, err := storage.InsertToy(ctx, newToy)
+	if err != nil || replayed == nil || len(replayed.Photos) != 1 || replayed.Photos[0].Full != created.Full {
+		t.Fatalf("InsertToy retry with another photo = %+v, %v, want only the first photo", replayed, err)
+	}
+
+	orphans, err = storage.SelectOrphanUploads(ctx, time.Now().Add(time.Hour), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released = make(map[string]bool)
+	for _, upload := range orphans {
+		released[upload.Key] = true
+	}
+
+	if !released[retried.Full] || released[created.Full] {
+		t.Errorf("orphan uploads after retry: retried photo released = %v, created photo released = %v", released[retried.Full], released[created.Full])
+	}
+}
+
+func testToysList(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	owner := NewUser(t, storage)
+	viewer := NewUser(t, storage)
+
+	for _, name := range []string{"Волчок", "Азбука", "Бубен"} {
+		NewToy(t, storage, owner.UserId, name)
+	}
+
+	query := &models.QueryToys{UserIds: []string{owner.UserId}}
+	sort := &models.ToysSort{Field: models.KSortName, Direction: models.KSortAsc}
+
+	toys, cursor, total, err := storage.SelectToysList(ctx, query, viewer.UserId, sort, nil, 2, strPtr(models.KTotalExact))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(toys) != 2 || toys[0].Name != "Азбука" || toys[1].Name != "Бубен" || cursor == nil {
+		t.Fatalf("first page = %v, cursor %v", toys, cursor)
+	}
+
+	if total == nil || total.Count != 3 {
+		t.Errorf("total = %v, want 3", total)
+	}
+
+	toys, cursor, _, err = storage.SelectToysList(ctx, query, viewer.UserId, sort, cursor, 2, nil)
+	if err != nil || len(toys) != 1 || toys[0].Name != "Волчок" || cursor != nil {
+		t.Fatalf("second page = %v, cursor %v, %v", toys, cursor, err)
+	}
+
+	// игрушки того, кто заблокировал зрителя, не показываются
+	if err := storage.InsertUserBlock(ctx, owner.UserId, viewer.UserId); err != nil {
+		t.Fatal(err)
+	}
+
+	toys, _, _, err = storage.SelectToysList(ctx, query, viewer.UserId, sort, nil, 10, nil)
+	if err != nil || len(toys) != 0 {
+		t.Fatalf("list with block = %v, %v, want empty", toys, err)
+	}
+}
+
+func testExchangeFlow(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+
+	aliceToy := NewToy(t, storage, alice.UserId, "Мяч")
+	bobToy := NewToy(t, storage, bob.UserId, "Юла")
+	aliceOther := NewToy(t, storage, alice.UserId, "Кубики")
+
+	exchange := NewExchange(t, storage, aliceToy, bobToy)
+	competing := NewExchange(t, storage, aliceOther, bobToy)
+
+	// та же пара игрушек в обратную сторону, пока сделка не завершена
+	_, err := InsertExchange(t, storage, bobToy, aliceToy)
+	if !errors.Is(err, models.ErrExchangeExists) {
+		t.Fatalf("InsertExchange for the same pair: %v, want ErrExchangeExists", err)
+	}
+
+	SetStatus(t, storage, exchange.ExchangeId, alice.UserId, models.KConfirm1ExchangeDetailsStatus)
+	if status, _ := ExchangeStatus(t, storage, exchange.ExchangeId); status != models.KCreatedExchangeStatus {
+		t.Fatalf("status after one confirm_1 = %s", status)
+	}
+
+	SetStatus(t, storage, exchange.ExchangeId, bob.UserId, models.KConfirm1ExchangeDetailsStatus)
+	if status, _ := ExchangeStatus(t, storage, exchange.ExchangeId); status != models.KConfirmExchangeStatus {
+		t.Fatalf("status after both confirm_1 = %s", status)
+	}
+
+	SetStatus(t, storage, exchange.ExchangeId, alice.UserId, models.KConfirm2ExchangeDetailsStatus)
+	participants := SetStatus(t, storage, exchange.ExchangeId, bob.UserId, models.KConfirm2ExchangeDetailsStatus)
+
+	for _, participant := range participants {
+		if participant.ExchangeStatus != models.KSuccessExchangeStatus || participant.UserExchangeStatus != models.KSuccessExchangeDetailsStatus {
+			t.Fatalf("participant after both confirm_2 = %+v", participant)
+		}
+	}
+
+	// игрушки поменялись владельцами
+	swapped, err := storage.SelectToyById(ctx, aliceToy.ToyId)
+	if err != nil || swapped == nil || swapped.UserId != bob.UserId {
+		t.Fatalf("toy %s owner = %v, %v, want %s", aliceToy.ToyId, swapped, err, bob.UserId)
+	}
+
+	swapped, err = storage.SelectToyById(ctx, bobToy.ToyId)
+	if err != nil || swapped == nil || swapped.UserId != alice.UserId {
+		t.Fatalf("toy %s owner = %v, %v, want %s", bobToy.ToyId, swapped, err, alice.UserId)
+	}
+
+	// сделка с уже отданной игрушкой проваливается
+	status, statuses := ExchangeStatus(t, storage, competing.ExchangeId)
+	if status != models.KFailedExchangeStatus || statuses[alice.UserId] != models.KFailedExchangeDetailsStatus || statuses[bob.UserId] != models.KFailedExchangeDetailsStatus {
+		t.Fatalf("competing exchange = %s %v, want failed", status, statuses)
+	}
+
+	history, err := storage.SelectToyOwnershipHistory(ctx, aliceToy.ToyId)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("SelectToyOwnershipHistory = %v, %v", history, err)
+	}
+
+	if history[0].UserId != alice.UserId || history[0].ReleasedAt == nil {
+		t.Errorf("first owner = %+v, want released %s", history[0], alice.UserId)
+	}
+
+	if history[1].UserId != bob.UserId || history[1].ExchangeId == nil || *history[1].ExchangeId != exchange.ExchangeId {
+		t.Errorf("current owner = %+v, want %s by exchange %s", history[1], bob.UserId, exchange.ExchangeId)
+	}
+
+	// повтор создания отданной игрушки не возвращает игрушку нового владельца
+	byToken, err := storage.SelectToyByToken(ctx, aliceToy.IdempotencyToken, alice.UserId)
+	if err != nil || byToken != nil {
+		t.Fatalf("SelectToyByToken of a transferred toy = %v, %v, want nil", byToken, err)
+	}
+
+	retried, err := storage.InsertToy(ctx, &models.Toy{
+		UserId:           alice.UserId,
+		Name:             aliceToy.Name,
+		IdempotencyToken: aliceToy.IdempotencyToken,
+		Status:           models.KCreatedToyStatus,
+		Tags:             []string{},
+	})
+	if err != nil || retried == nil || retried.ToyId == aliceToy.ToyId || retried.UserId != alice.UserId {
+		t.Fatalf("InsertToy retry after transfer = %v, %v, want a new toy of %s", retried, err, alice.UserId)
+	}
+
+	byToken, err = storage.SelectToyByToken(ctx, aliceToy.IdempotencyToken, bob.UserId)
+	if err != nil || byToken == nil || byToken.ToyId != aliceToy.ToyId {
+		t.Fatalf("SelectToyByToken of the new owner = %v, %v, want %s", byToken, err, aliceToy.ToyId)
+	}
+}
+
+func testExchangeFailed(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+
+	aliceToy := NewToy(t, storage, alice.UserId, "Мяч")
+	bobToy := NewToy(t, storage, bob.UserId, "Юла")
+
+	exchange := NewExchange(t, storage, aliceToy, bobToy)
+
+	repeated, err := storage.InsertExchange(ctx, exchange, []models.ExchangeDetails{
+		{ToyId: aliceToy.ToyId, UserId: alice.UserId},
+		{ToyId: bobToy.ToyId, UserId: bob.UserId},
+	})
+	if err != nil || repeated == nil || repeated.ExchangeId != exchange.ExchangeId {
+		t.Fatalf("InsertExchange with the same token = %v, %v", repeated, err)
+	}
+
+	SetStatus(t, storage, exchange.ExchangeId, alice.UserId, models.KConfirm1ExchangeDetailsStatus)
+	SetStatus(t, storage, exchange.ExchangeId, bob.UserId, models.KFailedExchangeDetailsStatus)
+
+	status, statuses := ExchangeStatus(t, storage, exchange.ExchangeId)
+	if status != models.KFailedExchangeStatus || statuses[alice.UserId] != models.KFailedExchangeDetailsStatus {
+		t.Fatalf("exchange after failed = %s %v", status, statuses)
+	}
+
+	// статус завершенного участника больше не меняется
+	SetStatus(t, storage, exchange.ExchangeId, alice.UserId, models.KConfirm2ExchangeDetailsStatus)
+	if _, statuses := ExchangeStatus(t, storage, exchange.ExchangeId); statuses[alice.UserId] != models.KFailedExchangeDetailsStatus {
+		t.Fatalf("failed participant changed status to %s", statuses[alice.UserId])
+	}
+
+	// после провала ту же пару можно предложить снова
+	NewExchange(t, storage, bobToy, aliceToy)
+}
+
+func testToyRemoval(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+
+	aliceToy := NewToy(t, storage, alice.UserId, "Мяч")
+	bobToy := NewToy(t, storage, bob.UserId, "Юла")
+
+	exchange := NewExchange(t, storage, aliceToy, bobToy)
+
+	removed, err := storage.UpdateToyStatus(ctx, bobToy.ToyId, bob.UserId, models.KRemovedToyStatus)
+	if err != nil || removed == nil || removed.Status != models.KRemovedToyStatus {
+		t.Fatalf("UpdateToyStatus = %v, %v", removed, err)
+	}
+
+	status, statuses := ExchangeStatus(t, storage, exchange.ExchangeId)
+	if status != models.KFailedExchangeStatus || statuses[alice.UserId] != models.KFailedExchangeDetailsStatus || statuses[bob.UserId] != models.KFailedExchangeDetailsStatus {
+		t.Fatalf("exchange with removed toy = %s %v, want failed", status, statuses)
+	}
+}
+
+func testExchangeList(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+
+	aliceToy := NewToy(t, storage, alice.UserId, "Мяч")
+	bobToy := NewToy(t, storage, bob.UserId, "Юла")
+	bobOther := NewToy(t, storage, bob.UserId, "Кубики")
+
+	offered := NewExchange(t, storage, aliceToy, bobToy)
+	received := NewExchange(t, storage, bobOther, aliceToy)
+
+	sort := &models.ExchangesSort{Field: models.KSortCreatedAt, Direction: models.KSortAsc}
+	list := func(userId string, query *models.QueryExchanges) []string {
+		t.Helper()
+
+		infos, _, _, err := storage.SelectExchangeList(ctx, query, userId, sort, nil, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exchangeIds := make([]string, 0, len(infos))
+		for _, info := range infos {
+			exchangeIds = append(exchangeIds, info.ExchangeId)
+		}
+
+		return exchangeIds
+	}
+
+	if ids := list(alice.UserId, &models.QueryExchanges{}); len(ids) != 2 || ids[0] != offered.ExchangeId {
+		t.Fatalf("all exchanges = %v", ids)
+	}
+
+	if ids := list(alice.UserId, &models.QueryExchanges{Role: strPtr(models.KRoleInitiator)}); len(ids) != 1 || ids[0] != offered.ExchangeId {
+		t.Errorf("initiator exchanges = %v, want %s", ids, offered.ExchangeId)
+	}
+
+	if ids := list(alice.UserId, &models.QueryExchanges{Role: strPtr(models.KRoleRecipient)}); len(ids) != 1 || ids[0] != received.ExchangeId {
+		t.Errorf("recipient exchanges = %v, want %s", ids, received.ExchangeId)
+	}
+
+	if ids := list(alice.UserId, &models.QueryExchanges{ToyId: &bobOther.ToyId}); len(ids) != 1 || ids[0] != received.ExchangeId {
+		t.Errorf("exchanges with toy = %v, want %s", ids, received.ExchangeId)
+	}
+
+	// bob подтвердил, теперь ход за alice
+	SetStatus(t, storage, offered.ExchangeId, bob.UserId, models.KConfirm1ExchangeDetailsStatus)
+
+	if ids := list(alice.UserId, &models.QueryExchanges{AwaitingMyAction: true}); len(ids) != 1 || ids[0] != offered.ExchangeId {
+		t.Errorf("alice awaiting exchanges = %v, want %s", ids, offered.ExchangeId)
+	}
+
+	if ids := list(bob.UserId, &models.QueryExchanges{AwaitingMyAction: true}); len(ids) != 0 {
+		t.Errorf("bob awaiting exchanges = %v, want none", ids)
+	}
+
+	infos, cursor, total, err := storage.SelectExchangeList(ctx, &models.QueryExchanges{}, alice.UserId, sort, nil, 1, strPtr(models.KTotalExact))
+	if err != nil || len(infos) != 1 || cursor == nil || total == nil || total.Count != 2 {
+		t.Fatalf("first page = %v, cursor %v, total %v, %v", infos, cursor, total, err)
+	}
+
+	if len(infos[0].Details) != 2 || infos[0].Details[0].Toy.ToyId != aliceToy.ToyId {
+		t.Errorf("details = %+v, want initiator toy first", infos[0].Details)
+	}
+
+	infos, cursor, _, err = storage.SelectExchangeList(ctx, &models.QueryExchanges{}, alice.UserId, sort, cursor, 1, nil)
+	if err != nil || len(infos) != 1 || infos[0].ExchangeId != received.ExchangeId || cursor != nil {
+		t.Fatalf("second page = %v, cursor %v, %v", infos, cursor, err)
+	}
+
+	// расстояние между игрушками участников считает хранилище; игрушки без своего места находятся у владельцев
+	participants, err := storage.SelectExchangeWithParticipants(ctx, offered.ExchangeId)
+	if err != nil || len(participants) != 2 || participants[0].ToyDistance != nil {
+		t.Fatalf("participants without locations = %+v, %v, want no distance", participants, err)
+	}
+
+	if _, err := storage.UpdateUserLocation(ctx, alice.UserId, &models.Location{Lat: 55.75, Lon: 37.62}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.UpdateUserLocation(ctx, bob.UserId, &models.Location{Lat: 59.94, Lon: 30.31}); err != nil {
+		t.Fatal(err)
+	}
+
+	participants, err = storage.SelectExchangeWithParticipants(ctx, offered.ExchangeId)
+	if err != nil || len(participants) != 2 {
+		t.Fatalf("SelectExchangeWithParticipants = %v, %v", participants, err)
+	}
+
+	for _, participant := range participants {
+		if participant.ToyDistance == nil || *participant.ToyDistance < 600 || *participant.ToyDistance > 670 {
+			t.Errorf("distance of %s = %v, want about 634 km", participant.UserId, participant.ToyDistance)
+		}
+	}
+}
+
+func testMessages(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+	exchange := NewExchange(t, storage, NewToy(t, storage, alice.UserId, "Мяч"), NewToy(t, storage, bob.UserId, "Юла"))
+
+	token := newToken(t)
+	sent := make([]string, 0, 3)
+	for i := 0; i < 3; i++ {
+		message := &models.ExchangeMessage{
+			ExchangeId:       exchange.ExchangeId,
+			UserId:           alice.UserId,
+			Text:             fmt.Sprintf("сообщение %d", i),
+			IdempotencyToken: fmt.Sprintf("%s-%d", token, i),
+		}
+
+		stored, err := storage.InsertExchangeMessage(ctx, message)
+		if err != nil || stored == nil {
+			t.Fatalf("InsertExchangeMessage: %v, %v", stored, err)
+		}
+
+		repeated, err := storage.InsertExchangeMessage(ctx, message)
+		if err != nil || repeated == nil || repeated.MessageId != stored.MessageId {
+			t.Fatalf("InsertExchangeMessage with the same token = %v, %v", repeated, err)
+		}
+
+		sent = append(sent, stored.MessageId)
+	}
+
+	messages, cursor, err := storage.SelectExchangeMessages(ctx, exchange.ExchangeId, nil, 2)
+	if err != nil || len(messages) != 2 || messages[0].MessageId != sent[0] || cursor == nil || *cursor != sent[2] {
+		t.Fatalf("first page = %v, cursor %v, %v", messages, cursor, err)
+	}
+
+	messages, cursor, err = storage.SelectExchangeMessages(ctx, exchange.ExchangeId, cursor, 2)
+	if err != nil || len(messages) != 1 || messages[0].MessageId != sent[2] || cursor != nil {
+		t.Fatalf("second page = %v, cursor %v, %v", messages, cursor, err)
+	}
+
+	// тот же токен у другого автора или в другом обмене - другое сообщение
+	other := NewExchange(t, storage, NewToy(t, storage, bob.UserId, "Кубики"), NewToy(t, storage, alice.UserId, "Кукла"))
+	for _, reused := range []models.ExchangeMessage{
+		{ExchangeId: exchange.ExchangeId, UserId: bob.UserId},
+		{ExchangeId: other.ExchangeId, UserId: alice.UserId},
+	} {
+		reused.Text = "ответ"
+		reused.IdempotencyToken = fmt.Sprintf("%s-%d", token, 0)
+
+		stored, err := storage.InsertExchangeMessage(ctx, &reused)
+		if err != nil || stored == nil || stored.MessageId == sent[0] || stored.ExchangeId != reused.ExchangeId || stored.UserId != reused.UserId {
+			t.Fatalf("InsertExchangeMessage with a token used in another exchange or by another author = %v, %v", stored, err)
+		}
+	}
+}
+
+func testReviews(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	reviewed := NewUser(t, storage)
+
+	rating, err := storage.SelectUserRating(ctx, reviewed.UserId)
+	if err != nil || rating.Count != 0 || rating.Average != 0 {
+		t.Fatalf("rating without reviews = %v, %v", rating, err)
+	}
+
+	exchangeIds := make([]string, 0, 2)
+	for _, score := range []int{5, 4} {
+		reviewer := NewUser(t, storage)
+		exchange := NewExchange(t, storage, NewToy(t, storage, reviewer.UserId, "Мяч"), NewToy(t, storage, reviewed.UserId, "Юла"))
+
+		review := &models.Review{
+			ExchangeId: exchange.ExchangeId,
+			ReviewerId: reviewer.UserId,
+			UserId:     reviewed.UserId,
+			Rating:     score,
+		}
+
+		stored, err := storage.InsertReview(ctx, review)
+		if err != nil || stored == nil {
+			t.Fatalf("InsertReview: %v, %v", stored, err)
+		}
+
+		duplicate, err := storage.InsertReview(ctx, review)
+		if err != nil || duplicate != nil {
+			t.Fatalf("second InsertReview for the exchange = %v, %v, want nil", duplicate, err)
+		}
+
+		exchangeIds = append(exchangeIds, exchange.ExchangeId)
+	}
+
+	rating, err = storage.SelectUserRating(ctx, reviewed.UserId)
+	if err != nil || rating.Count != 2 || rating.Average != 4.5 {
+		t.Fatalf("rating = %v, %v, want 4.5 of 2", rating, err)
+	}
+
+	// сначала новые отзывы
+	reviews, cursor, err := storage.SelectReviewsByUserId(ctx, reviewed.UserId, nil, 1)
+	if err != nil || len(reviews) != 1 || reviews[0].ExchangeId != exchangeIds[1] || cursor == nil {
+		t.Fatalf("first page = %v, cursor %v, %v", reviews, cursor, err)
+	}
+
+	reviews, cursor, err = storage.SelectReviewsByUserId(ctx, reviewed.UserId, cursor, 1)
+	if err != nil || len(reviews) != 1 || reviews[0].ExchangeId != exchangeIds[0] || cursor != nil {
+		t.Fatalf("second page = %v, cursor %v, %v", reviews, cursor, err)
+	}
+}
+
+func testBlocks(t *testing.T, storage service.Storage) {
+	ctx := context.Background()
+	alice := NewUser(t, storage)
+	bob := NewUser(t, storage)
+
+	report, err := storage.InsertUserReport(ctx, &models.UserReport{ReporterId: alice.UserId, UserId: bob.UserId, Reason: "спам"})
+	if err != nil || report == nil || report.ReportId == "" {
+		t.Fatalf("InsertUserReport = %v, %v", report, err)
+	}
+
+	if err := storage.InsertUserBlock(ctx, alice.UserId, alice.UserId); err == nil {
+		t.Error("InsertUserBlock of self must fail")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := storage.InsertUserBlock(ctx, alice.UserId, bob.UserId); err != nil {
+			t.Fatalf("InsertUserBlock #%d: %v", i+1, err)
+		}
+	}
+
+	// блокировка действует в обе стороны
+	blocked, err := storage.HasUserBlock(ctx, bob.UserId, alice.UserId)
+	if err != nil || !blocked {
+		t.Fatalf("HasUserBlock = %v, %v, want true", blocked, err)
+	}
+
+	if err := storage.DeleteUserBlock(ctx, alice.UserId, bob.UserId); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, err = storage.HasUserBlock(ctx, alice.UserId, bob.UserId)
+	if err != nil || blocked {
+		t.Fatalf("HasUserBlock after delete = %v, %v, want false", blocked, err)
+	}
+}
@@ -1,30 +1,96 @@
 package utils
 
-import(
+import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
 )
 
-func Encode(cursor *string) (*string) {
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorMismatch = errors.New("cursor does not match query")
+)
+
+// Cursor указывает на первую запись следующей страницы.
+// Клиент получает его непрозрачной строкой, подписанной HMAC, поэтому подделать или
+// переиспользовать курсор с другим запросом нельзя.
+type Cursor struct {
+	Sort 		string 	`json:"s,omitempty"`
+	Desc 		bool 	`json:"d,omitempty"`
+	Value 		*string `json:"v,omitempty"`
+	Id 			string 	`json:"id"`
+	QueryHash 	string 	`json:"q"`
+}
+
+// QueryHash - отпечаток фильтров запроса, с которыми был выдан курсор
+func QueryHash(parts ...any) string {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, part := range parts {
+		encoder.Encode(part)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:12])
+}
+
+func sign(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Encode(secret string, cursor *Cursor) (*string) {
 	if cursor == nil {
 		return nil
 	}
 
-	encoded := base64.StdEncoding.EncodeToString([]byte(*cursor))
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return nil
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	encoded := payload + "." + sign(secret, payload)
 
 	return &encoded
 }
 
-func Decode(cursor *string) (*string, error) {
+func Decode(secret string, cursor *string) (*Cursor, error) {
 	if cursor == nil {
 		return nil, nil
 	}
 
-	decoded_byte, err := base64.StdEncoding.DecodeString(*cursor)
-	if (err != nil) {
-		return nil, err
+	payload, signature, ok := strings.Cut(*cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, payload))) {
+		return nil, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
 	}
 
-	decoded := string(decoded_byte)
+	var decoded Cursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
 
 	return &decoded, nil
-}
\ No newline at end of file
+}
+
+// Verify проверяет, что курсор выдан для того же запроса и той же сортировки
+func (c *Cursor) Verify(queryHash string, sort string, desc bool) error {
+	if c.QueryHash != queryHash || c.Sort != sort || c.Desc != desc {
+		return ErrCursorMismatch
+	}
+
+	return nil
+}
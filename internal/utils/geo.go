@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"math"
+)
+
+const (
+	kEarthRadiusKm = 6371.0
+	kKmPerDegree = 111.045
+)
+
+// DistanceKm - расстояние по формуле гаверсинусов, как distance_km в базе; им считает хранилище в памяти
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * kEarthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// BoundingBox возвращает квадрат, в который гарантированно попадает круг радиусом radiusKm.
+// Около полюсов и линии перемены дат долгота не ограничивается.
+func BoundingBox(lat, lon, radiusKm float64) (float64, float64, float64, float64) {
+	dLat := radiusKm / kKmPerDegree
+	minLat := math.Max(lat-dLat, -90)
+	maxLat := math.Min(lat+dLat, 90)
+
+	cosLat := math.Cos(lat * math.Pi / 180)
+	if minLat == -90 || maxLat == 90 || cosLat < 0.01 {
+		return minLat, maxLat, -180, 180
+	}
+
+	dLon := radiusKm / (kKmPerDegree * cosLat)
+	if lon-dLon < -180 || lon+dLon > 180 {
+		return minLat, maxLat, -180, 180
+	}
+
+	return minLat, maxLat, lon - dLon, lon + dLon
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// SignKey подписывает ключ файла вместе со сроком действия ссылки
+func SignKey(secret string, key string, expires time.Time) (string, string) {
+	expiresUnix := strconv.FormatInt(expires.Unix(), 10)
+
+	return expiresUnix, sign(secret, key+"\n"+expiresUnix)
+}
+
+// VerifyKey проверяет подпись из SignKey и что срок ссылки не истек
+func VerifyKey(secret string, key string, expires string, signature string) error {
+	if !hmac.Equal([]byte(signature), []byte(sign(secret, key+"\n"+expires))) {
+		return ErrInvalidSignature
+	}
+
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > expiresUnix {
+		return ErrSignatureExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS
+    exchange_details,
+    exchange,
+    toys,
+    users;
+
+DROP FUNCTION IF EXISTS
+    prevent_update_completed_exchange_details(),
+    exchange_success_swap_owners(),
+    detail_confirm_2_update_success(),
+    detail_confirm_1_update_exchange(),
+    detail_failed_propagate(),
+    toys_removed_set_exchanges_failed();
+
+DROP TYPE IF EXISTS
+    ExchangeDetailsStatus,
+    ExchangeStatus,
+    ToyStatus;
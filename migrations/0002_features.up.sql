@@ -0,0 +1,291 @@
+-- Схема после baseline (0001): локации, категории и атрибуты игрушек, поиск, фотографии и файлы,
+-- чат, отзывы, жалобы и блокировки, уведомления об обменах
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TYPE ToyCondition AS ENUM ('new', 'like_new', 'used');
+
+ALTER TABLE users
+    ADD COLUMN lat DOUBLE PRECISION CHECK (lat BETWEEN -90 AND 90),
+    ADD COLUMN lon DOUBLE PRECISION CHECK (lon BETWEEN -180 AND 180),
+    ADD COLUMN city TEXT,
+    ADD CHECK ((lat IS NULL) = (lon IS NULL));
+
+CREATE TABLE IF NOT EXISTS categories (
+    category_id TEXT PRIMARY KEY,
+    parent_id TEXT REFERENCES categories (category_id),
+    name TEXT NOT NULL
+);
+
+INSERT INTO categories (category_id, parent_id, name) VALUES
+    ('dolls', NULL, 'Куклы'),
+    ('vehicles', NULL, 'Машинки и транспорт'),
+    ('construction', NULL, 'Конструкторы'),
+    ('plush', NULL, 'Мягкие игрушки'),
+    ('games', NULL, 'Настольные игры'),
+    ('puzzles', 'games', 'Пазлы'),
+    ('educational', NULL, 'Развивающие игрушки'),
+    ('baby', 'educational', 'Для малышей'),
+    ('outdoor', NULL, 'Для улицы и спорта')
+ON CONFLICT (category_id) DO NOTHING;
+
+ALTER TABLE toys
+    ADD COLUMN category_id TEXT REFERENCES categories (category_id),
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN age_min SMALLINT CHECK (age_min >= 0),
+    ADD COLUMN age_max SMALLINT CHECK (age_max >= 0),
+    ADD COLUMN condition ToyCondition,
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('russian', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('russian', COALESCE(description, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+    ) STORED,
+    ADD COLUMN lat DOUBLE PRECISION CHECK (lat BETWEEN -90 AND 90),
+    ADD COLUMN lon DOUBLE PRECISION CHECK (lon BETWEEN -180 AND 180),
+    ADD COLUMN city TEXT,
+    ADD CHECK (age_min IS NULL OR age_max IS NULL OR age_min <= age_max),
+    ADD CHECK ((lat IS NULL) = (lon IS NULL));
+
+CREATE INDEX IF NOT EXISTS toys_lat_lon_idx ON toys (lat, lon);
+
+-- position плотная, начиная с 0 (0 - обложка); уникальность проверяется в конце транзакции,
+-- чтобы перестановку и сдвиг после удаления можно было делать одним UPDATE
+CREATE TABLE IF NOT EXISTS toy_photos (
+    photo_id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    toy_id TEXT NOT NULL REFERENCES toys (toy_id),
+    position INTEGER NOT NULL CHECK (position >= 0),
+    thumbnail_key TEXT NOT NULL,
+    medium_key TEXT NOT NULL,
+    full_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (toy_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE INDEX IF NOT EXISTS toy_photos_thumbnail_key_idx ON toy_photos (thumbnail_key);
+CREATE INDEX IF NOT EXISTS toy_photos_medium_key_idx ON toy_photos (medium_key);
+CREATE INDEX IF NOT EXISTS toy_photos_full_key_idx ON toy_photos (full_key);
+
+-- uploads - все файлы, сохраненные в BlobStore. Запись создается до загрузки файла,
+-- toy_id - игрушка, к которой файл был привязан. released_at - с какого момента на файл нет ссылок
+-- из toy_photos (NULL - файл используется); такие файлы удаляются сборщиком после grace period
+CREATE TABLE IF NOT EXISTS uploads (
+    key TEXT PRIMARY KEY,
+    toy_id TEXT REFERENCES toys (toy_id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS uploads_released_at_idx ON uploads (released_at) WHERE released_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS toys_search_vector_idx ON toys USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS toys_name_trgm_idx ON toys USING GIN (name gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS toys_category_id_idx ON toys (category_id);
+CREATE INDEX IF NOT EXISTS toys_tags_idx ON toys USING GIN (tags);
+
+-- photo_url из baseline - URL файла в server.prefix_upload; имя файла становится ключом всех размеров фотографии,
+-- поэтому старые фотографии открываются, если blob.local.dir совпадает с прежним server.prefix_upload
+INSERT INTO toy_photos (toy_id, position, thumbnail_key, medium_key, full_key)
+SELECT toy_id, 0, key, key, key
+FROM (SELECT toy_id, regexp_replace(photo_url, '^.*/', '') AS key FROM toys WHERE photo_url IS NOT NULL) t
+WHERE key <> '';
+
+INSERT INTO uploads (key, toy_id, released_at)
+SELECT DISTINCT ON (full_key) full_key, toy_id, NULL::TIMESTAMP
+FROM toy_photos
+ON CONFLICT (key) DO NOTHING;
+
+ALTER TABLE toys DROP COLUMN photo_url;
+
+CREATE TABLE IF NOT EXISTS exchange_messages (
+    message_id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    exchange_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    text TEXT NOT NULL,
+    idempotency_token TEXT UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS exchange_messages_exchange_id_idx
+    ON exchange_messages (exchange_id, created_at, message_id);
+
+CREATE TABLE IF NOT EXISTS reviews (
+    exchange_id TEXT NOT NULL,
+    reviewer_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (exchange_id, reviewer_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx
+    ON reviews (user_id, created_at, exchange_id);
+
+CREATE TABLE IF NOT EXISTS user_reports (
+    report_id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    reporter_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_blocks (
+    user_id TEXT NOT NULL,
+    blocked_user_id TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, blocked_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_blocks_blocked_user_id_idx
+    ON user_blocks (blocked_user_id);
+
+-- расстояние в км по формуле гаверсинусов, без earthdistance/PostGIS
+CREATE OR REPLACE FUNCTION distance_km(lat1 DOUBLE PRECISION, lon1 DOUBLE PRECISION,
+                                       lat2 DOUBLE PRECISION, lon2 DOUBLE PRECISION)
+RETURNS DOUBLE PRECISION AS $$
+    SELECT 2 * 6371 * asin(sqrt(
+        power(sin(radians(lat2 - lat1) / 2), 2) +
+        cos(radians(lat1)) * cos(radians(lat2)) * power(sin(radians(lon2 - lon1) / 2), 2)
+    ))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- копии игрушек после обмена получают атрибуты, место нового владельца и фотографии
+-- 5. exchange.status → success → swap владельцев игрушек, другие сделки с ними → failed (если не уже failed/success)
+CREATE OR REPLACE FUNCTION exchange_success_swap_owners()
+RETURNS trigger AS $$
+DECLARE
+    src_copy_id TEXT;
+    dst_copy_id TEXT;
+BEGIN
+    IF NEW.status = 'success' AND (OLD.status IS DISTINCT FROM NEW.status) THEN
+        -- Создаем копию src_toy для dst_user
+        INSERT INTO toys (user_id, name, description, idempotency_token,
+                          category_id, tags, age_min, age_max, condition, lat, lon, city)
+        SELECT 
+            (SELECT user_id FROM toys WHERE toy_id = NEW.dst_toy_id),
+            name, description, gen_random_uuid()::text,
+            category_id, tags, age_min, age_max, condition,
+            (SELECT u.lat FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.dst_toy_id),
+            (SELECT u.lon FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.dst_toy_id),
+            (SELECT u.city FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.dst_toy_id)
+        FROM toys WHERE toy_id = NEW.src_toy_id
+        RETURNING toy_id INTO src_copy_id;
+
+        INSERT INTO toy_photos (toy_id, position, thumbnail_key, medium_key, full_key)
+        SELECT src_copy_id, position, thumbnail_key, medium_key, full_key
+        FROM toy_photos WHERE toy_id = NEW.src_toy_id;
+        
+        -- Создаем копию dst_toy для src_user
+        INSERT INTO toys (user_id, name, description, idempotency_token,
+                          category_id, tags, age_min, age_max, condition, lat, lon, city)
+        SELECT 
+            (SELECT user_id FROM toys WHERE toy_id = NEW.src_toy_id),
+            name, description, gen_random_uuid()::text,
+            category_id, tags, age_min, age_max, condition,
+            (SELECT u.lat FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.src_toy_id),
+            (SELECT u.lon FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.src_toy_id),
+            (SELECT u.city FROM toys t INNER JOIN users u ON u.user_id = t.user_id WHERE t.toy_id = NEW.src_toy_id)
+        FROM toys WHERE toy_id = NEW.dst_toy_id
+        RETURNING toy_id INTO dst_copy_id;
+
+        INSERT INTO toy_photos (toy_id, position, thumbnail_key, medium_key, full_key)
+        SELECT dst_copy_id, position, thumbnail_key, medium_key, full_key
+        FROM toy_photos WHERE toy_id = NEW.dst_toy_id;
+        
+        -- Помечаем оригинальные игрушки как removed
+        UPDATE toys SET status = 'exchanged'
+        WHERE toy_id IN (NEW.src_toy_id, NEW.dst_toy_id);
+        
+        -- Отменяем другие сделки с оригинальными игрушками
+        UPDATE exchange_details SET status = 'failed'
+        WHERE (toy_id = NEW.src_toy_id OR toy_id = NEW.dst_toy_id)
+            AND exchange_id != NEW.exchange_id
+            AND status NOT IN ('failed', 'success');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 7. exchange / exchange_details → pg_notify('exchange_events') для участников обмена
+CREATE OR REPLACE FUNCTION notify_exchange_event()
+RETURNS trigger AS $$
+DECLARE
+    event_type TEXT;
+    event_user_id TEXT;
+    recipients TEXT[];
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.status IS NOT DISTINCT FROM NEW.status THEN
+        RETURN NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'exchange' THEN
+        event_type := 'exchange_status';
+    ELSIF TG_OP = 'INSERT' THEN
+        event_type := 'exchange_offer';
+        event_user_id := NEW.user_id;
+    ELSE
+        event_type := 'exchange_details_status';
+        event_user_id := NEW.user_id;
+    END IF;
+
+    -- новое предложение видит только его получатель, остальные события - все участники
+    IF event_type = 'exchange_offer' THEN
+        recipients := ARRAY[NEW.user_id];
+    ELSE
+        SELECT array_agg(DISTINCT user_id) INTO recipients
+        FROM exchange_details
+        WHERE exchange_id = NEW.exchange_id;
+    END IF;
+
+    PERFORM pg_notify('exchange_events', json_build_object(
+        'type', event_type,
+        'exchange_id', NEW.exchange_id,
+        'user_id', event_user_id,
+        'status', NEW.status,
+        'user_ids', COALESCE(recipients, ARRAY[]::TEXT[])
+    )::text);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 7
+CREATE TRIGGER tg_exchange_notify
+AFTER UPDATE OF status ON exchange
+FOR EACH ROW
+EXECUTE FUNCTION notify_exchange_event();
+
+CREATE TRIGGER tg_details_notify
+AFTER INSERT OR UPDATE OF status ON exchange_details
+FOR EACH ROW
+EXECUTE FUNCTION notify_exchange_event();
+
+-- 8. exchange_messages → pg_notify('exchange_events') для участников обмена
+CREATE OR REPLACE FUNCTION notify_exchange_message()
+RETURNS trigger AS $$
+DECLARE
+    recipients TEXT[];
+BEGIN
+    SELECT array_agg(DISTINCT user_id) INTO recipients
+    FROM exchange_details
+    WHERE exchange_id = NEW.exchange_id;
+
+    PERFORM pg_notify('exchange_events', json_build_object(
+        'type', 'exchange_message',
+        'exchange_id', NEW.exchange_id,
+        'user_id', NEW.user_id,
+        'message_id', NEW.message_id,
+        'user_ids', COALESCE(recipients, ARRAY[]::TEXT[])
+    )::text);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 8
+CREATE TRIGGER tg_messages_notify
+AFTER INSERT ON exchange_messages
+FOR EACH ROW
+EXECUTE FUNCTION notify_exchange_message();
@@ -0,0 +1,52 @@
+DROP INDEX IF EXISTS
+    uploads_toy_id_idx,
+    user_reports_reporter_id_idx,
+    user_reports_user_id_idx,
+    reviews_reviewer_id_idx,
+    exchange_messages_user_id_idx,
+    exchange_updated_at_idx,
+    exchange_created_at_idx,
+    exchange_dst_toy_id_idx,
+    exchange_src_toy_id_idx,
+    exchange_details_toy_id_idx,
+    exchange_details_user_id_idx,
+    categories_parent_id_idx,
+    toys_name_idx,
+    toys_updated_at_idx,
+    toys_created_at_idx,
+    toys_status_idx,
+    toys_user_id_status_idx,
+    exchange_active_toy_pair_idx;
+
+ALTER TABLE user_blocks
+    DROP CONSTRAINT IF EXISTS user_blocks_user_id_check,
+    DROP CONSTRAINT IF EXISTS user_blocks_blocked_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS user_blocks_user_id_fkey;
+
+ALTER TABLE user_reports
+    DROP CONSTRAINT IF EXISTS user_reports_user_id_check,
+    DROP CONSTRAINT IF EXISTS user_reports_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS user_reports_reporter_id_fkey;
+
+ALTER TABLE reviews
+    DROP CONSTRAINT IF EXISTS reviews_user_id_check,
+    DROP CONSTRAINT IF EXISTS reviews_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS reviews_reviewer_id_fkey,
+    DROP CONSTRAINT IF EXISTS reviews_exchange_id_fkey;
+
+ALTER TABLE exchange_messages
+    DROP CONSTRAINT IF EXISTS exchange_messages_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS exchange_messages_exchange_id_fkey;
+
+ALTER TABLE exchange_details
+    DROP CONSTRAINT IF EXISTS exchange_details_user_id_fkey,
+    DROP CONSTRAINT IF EXISTS exchange_details_toy_id_fkey,
+    DROP CONSTRAINT IF EXISTS exchange_details_exchange_id_fkey;
+
+ALTER TABLE exchange
+    DROP CONSTRAINT IF EXISTS exchange_toys_check,
+    DROP CONSTRAINT IF EXISTS exchange_dst_toy_id_fkey,
+    DROP CONSTRAINT IF EXISTS exchange_src_toy_id_fkey;
+
+ALTER TABLE toys
+    DROP CONSTRAINT IF EXISTS toys_user_id_fkey;
@@ -0,0 +1,73 @@
+-- Foreign Keys
+ALTER TABLE toys
+    ADD CONSTRAINT toys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE exchange
+    ADD CONSTRAINT exchange_src_toy_id_fkey FOREIGN KEY (src_toy_id) REFERENCES toys (toy_id),
+    ADD CONSTRAINT exchange_dst_toy_id_fkey FOREIGN KEY (dst_toy_id) REFERENCES toys (toy_id);
+
+ALTER TABLE exchange_details
+    ADD CONSTRAINT exchange_details_exchange_id_fkey FOREIGN KEY (exchange_id) REFERENCES exchange (exchange_id),
+    ADD CONSTRAINT exchange_details_toy_id_fkey FOREIGN KEY (toy_id) REFERENCES toys (toy_id),
+    ADD CONSTRAINT exchange_details_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE exchange_messages
+    ADD CONSTRAINT exchange_messages_exchange_id_fkey FOREIGN KEY (exchange_id) REFERENCES exchange (exchange_id),
+    ADD CONSTRAINT exchange_messages_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE reviews
+    ADD CONSTRAINT reviews_exchange_id_fkey FOREIGN KEY (exchange_id) REFERENCES exchange (exchange_id),
+    ADD CONSTRAINT reviews_reviewer_id_fkey FOREIGN KEY (reviewer_id) REFERENCES users (user_id),
+    ADD CONSTRAINT reviews_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE user_reports
+    ADD CONSTRAINT user_reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users (user_id),
+    ADD CONSTRAINT user_reports_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE user_blocks
+    ADD CONSTRAINT user_blocks_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id),
+    ADD CONSTRAINT user_blocks_blocked_user_id_fkey FOREIGN KEY (blocked_user_id) REFERENCES users (user_id);
+
+-- Check Constraints
+ALTER TABLE exchange
+    ADD CONSTRAINT exchange_toys_check CHECK (src_toy_id <> dst_toy_id);
+
+ALTER TABLE reviews
+    ADD CONSTRAINT reviews_user_id_check CHECK (reviewer_id <> user_id);
+
+ALTER TABLE user_reports
+    ADD CONSTRAINT user_reports_user_id_check CHECK (reporter_id <> user_id);
+
+ALTER TABLE user_blocks
+    ADD CONSTRAINT user_blocks_user_id_check CHECK (user_id <> blocked_user_id);
+
+-- одна незавершенная сделка на пару игрушек, в какую бы сторону ее ни предложили
+CREATE UNIQUE INDEX exchange_active_toy_pair_idx
+    ON exchange (LEAST(src_toy_id, dst_toy_id), GREATEST(src_toy_id, dst_toy_id))
+    WHERE status IN ('created', 'confirm');
+
+-- Indexes
+-- SelectToysList: фильтры по владельцу и статусу, сортировки keyset (колонка, toy_id)
+CREATE INDEX toys_user_id_status_idx ON toys (user_id, status);
+CREATE INDEX toys_status_idx ON toys (status);
+CREATE INDEX toys_created_at_idx ON toys (created_at, toy_id);
+CREATE INDEX toys_updated_at_idx ON toys (updated_at, toy_id);
+CREATE INDEX toys_name_idx ON toys (name, toy_id);
+
+-- рекурсивный обход вложенных категорий
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+-- SelectExchangeList: обмены пользователя, фильтр по игрушке, сортировки keyset
+CREATE INDEX exchange_details_user_id_idx ON exchange_details (user_id, exchange_id);
+CREATE INDEX exchange_details_toy_id_idx ON exchange_details (toy_id);
+CREATE INDEX exchange_src_toy_id_idx ON exchange (src_toy_id);
+CREATE INDEX exchange_dst_toy_id_idx ON exchange (dst_toy_id);
+CREATE INDEX exchange_created_at_idx ON exchange (created_at, exchange_id);
+CREATE INDEX exchange_updated_at_idx ON exchange (updated_at, exchange_id);
+
+-- внешние ключи, по которым ищут или удаляют
+CREATE INDEX exchange_messages_user_id_idx ON exchange_messages (user_id);
+CREATE INDEX reviews_reviewer_id_idx ON reviews (reviewer_id);
+CREATE INDEX user_reports_user_id_idx ON user_reports (user_id);
+CREATE INDEX user_reports_reporter_id_idx ON user_reports (reporter_id);
+CREATE INDEX uploads_toy_id_idx ON uploads (toy_id);
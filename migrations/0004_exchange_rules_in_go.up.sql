@@ -0,0 +1,16 @@
+-- Правила сделки перенесены в пакет exchange сервиса и выполняются в транзакции хранилища.
+-- Триггеры уведомлений (notify_exchange_event, notify_exchange_message) остаются
+DROP TRIGGER IF EXISTS tg_toys_removed ON toys;
+DROP TRIGGER IF EXISTS tg_details_failed ON exchange_details;
+DROP TRIGGER IF EXISTS tg_details_confirm1 ON exchange_details;
+DROP TRIGGER IF EXISTS tg_details_confirm2 ON exchange_details;
+DROP TRIGGER IF EXISTS tg_exchange_success ON exchange;
+DROP TRIGGER IF EXISTS prevent_update_completed_exchange_details_trigger ON exchange_details;
+
+DROP FUNCTION IF EXISTS
+    toys_removed_set_exchanges_failed(),
+    detail_failed_propagate(),
+    detail_confirm_1_update_exchange(),
+    detail_confirm_2_update_success(),
+    exchange_success_swap_owners(),
+    prevent_update_completed_exchange_details();
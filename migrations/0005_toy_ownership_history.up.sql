@@ -0,0 +1,26 @@
+-- История владельцев игрушки. При успешном обмене игрушка сохраняет toy_id и переходит к новому владельцу:
+-- запись текущего владельца закрывается (released_at), для нового добавляется запись с exchange_id сделки.
+-- exchange_id = NULL - игрушка создана владельцем
+CREATE TABLE IF NOT EXISTS toy_ownership_history (
+    toy_id TEXT NOT NULL REFERENCES toys (toy_id),
+    user_id TEXT NOT NULL REFERENCES users (user_id),
+    exchange_id TEXT REFERENCES exchange (exchange_id),
+    acquired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    released_at TIMESTAMP
+);
+
+-- у игрушки один текущий владелец
+CREATE UNIQUE INDEX IF NOT EXISTS toy_ownership_history_current_idx
+    ON toy_ownership_history (toy_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS toy_ownership_history_toy_id_idx ON toy_ownership_history (toy_id, acquired_at);
+CREATE INDEX IF NOT EXISTS toy_ownership_history_user_id_idx ON toy_ownership_history (user_id);
+CREATE INDEX IF NOT EXISTS toy_ownership_history_exchange_id_idx ON toy_ownership_history (exchange_id);
+
+-- Игрушки, обмененные до этой миграции, уже скопированы новым владельцам: их владение закрыто
+INSERT INTO toy_ownership_history (toy_id, user_id, acquired_at, released_at)
+SELECT
+    toy_id,
+    user_id,
+    COALESCE(created_at, CURRENT_TIMESTAMP),
+    CASE WHEN status = 'exchanged' THEN updated_at END
+FROM toys;
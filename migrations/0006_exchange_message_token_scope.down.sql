@@ -0,0 +1,3 @@
+-- Откат не пройдет, если один токен уже использован в разных обменах или разными авторами
+ALTER TABLE exchange_messages DROP CONSTRAINT IF EXISTS exchange_messages_idempotency_token_key;
+ALTER TABLE exchange_messages ADD CONSTRAINT exchange_messages_idempotency_token_key UNIQUE (idempotency_token);
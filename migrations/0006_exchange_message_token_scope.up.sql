@@ -0,0 +1,5 @@
+-- Токен идемпотентности сообщения уникален в пределах автора и обмена: повтор запроса с чужим токеном
+-- создает свое сообщение, а не возвращает сообщение другого пользователя из другого обмена
+ALTER TABLE exchange_messages DROP CONSTRAINT IF EXISTS exchange_messages_idempotency_token_key;
+ALTER TABLE exchange_messages ADD CONSTRAINT exchange_messages_idempotency_token_key
+    UNIQUE (exchange_id, user_id, idempotency_token);
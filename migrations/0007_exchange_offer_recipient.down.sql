@@ -0,0 +1,41 @@
+CREATE OR REPLACE FUNCTION notify_exchange_event()
+RETURNS trigger AS $$
+DECLARE
+    event_type TEXT;
+    event_user_id TEXT;
+    recipients TEXT[];
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.status IS NOT DISTINCT FROM NEW.status THEN
+        RETURN NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'exchange' THEN
+        event_type := 'exchange_status';
+    ELSIF TG_OP = 'INSERT' THEN
+        event_type := 'exchange_offer';
+        event_user_id := NEW.user_id;
+    ELSE
+        event_type := 'exchange_details_status';
+        event_user_id := NEW.user_id;
+    END IF;
+
+    -- новое предложение видит только его получатель, остальные события - все участники
+    IF event_type = 'exchange_offer' THEN
+        recipients := ARRAY[NEW.user_id];
+    ELSE
+        SELECT array_agg(DISTINCT user_id) INTO recipients
+        FROM exchange_details
+        WHERE exchange_id = NEW.exchange_id;
+    END IF;
+
+    PERFORM pg_notify('exchange_events', json_build_object(
+        'type', event_type,
+        'exchange_id', NEW.exchange_id,
+        'user_id', event_user_id,
+        'status', NEW.status,
+        'user_ids', COALESCE(recipients, ARRAY[]::TEXT[])
+    )::text);
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,3 @@
+-- Откат не пройдет, если один токен уже использован разными владельцами
+ALTER TABLE toys DROP CONSTRAINT IF EXISTS toys_idempotency_token_key;
+ALTER TABLE toys ADD CONSTRAINT toys_idempotency_token_key UNIQUE (idempotency_token);
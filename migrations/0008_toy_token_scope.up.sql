@@ -0,0 +1,5 @@
+-- Токен идемпотентности игрушки уникален в пределах владельца. Токен переходит вместе с игрушкой
+-- к новому владельцу: повтор запроса прежнего владельца создает его игрушку, а не возвращает игрушку,
+-- которая теперь принадлежит другому пользователю
+ALTER TABLE toys DROP CONSTRAINT IF EXISTS toys_idempotency_token_key;
+ALTER TABLE toys ADD CONSTRAINT toys_idempotency_token_key UNIQUE (user_id, idempotency_token);
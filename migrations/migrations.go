@@ -0,0 +1,8 @@
+// Package migrations содержит схему базы в виде пронумерованных миграций
+// NNNN_name.up.sql / NNNN_name.down.sql, которые встраиваются в бинарник сервиса
+package migrations
+
+import "embed"
+
+//go:embed *.up.sql *.down.sql
+var FS embed.FS
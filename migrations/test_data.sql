@@ -13,26 +13,45 @@ INSERT INTO users (user_id, first_name, middle_name, last_name, email, password_
 ON CONFLICT (user_id) DO NOTHING;
 
 -- Вставляем тестовые игрушки
-INSERT INTO toys (toy_id, user_id, name, description, photo_url, idempotency_token, status) VALUES
+INSERT INTO toys (toy_id, user_id, name, description, idempotency_token, status) VALUES
 -- Пользователь 1: несколько игрушек
-('toy_1', 'user_1', 'Машинка', 'Красная машинка', '/photos/car.jpg', 'token_toy_1', 'created'),
-('toy_2', 'user_1', 'Кукла', 'Барби', '/photos/doll.jpg', 'token_toy_2', 'created'),
-('toy_3', 'user_1', 'Конструктор', 'Лего', '/photos/lego.jpg', 'token_toy_3', 'created'),
+('toy_1', 'user_1', 'Машинка', 'Красная машинка', 'token_toy_1', 'created'),
+('toy_2', 'user_1', 'Кукла', 'Барби', 'token_toy_2', 'created'),
+('toy_3', 'user_1', 'Конструктор', 'Лего', 'token_toy_3', 'created'),
 
 -- Пользователь 2: несколько игрушек  
-('toy_4', 'user_2', 'Мяч', 'Футбольный мяч', '/photos/ball.jpg', 'token_toy_4', 'created'),
-('toy_5', 'user_2', 'Пазл', 'Детский пазл', '/photos/puzzle.jpg', 'token_toy_5', 'created'),
+('toy_4', 'user_2', 'Мяч', 'Футбольный мяч', 'token_toy_4', 'created'),
+('toy_5', 'user_2', 'Пазл', 'Детский пазл', 'token_toy_5', 'created'),
 
 -- Пользователь 3: несколько игрушек
-('toy_6', 'user_3', 'Кубики', 'Деревянные кубики', '/photos/blocks.jpg', 'token_toy_6', 'created'),
-('toy_7', 'user_3', 'Мишка', 'Плюшевый мишка', '/photos/bear.jpg', 'token_toy_7', 'created'),
-('toy_8', 'user_3', 'Раскраска', 'Детская раскраска', '/photos/coloring.jpg', 'token_toy_8', 'created'),
+('toy_6', 'user_3', 'Кубики', 'Деревянные кубики', 'token_toy_6', 'created'),
+('toy_7', 'user_3', 'Мишка', 'Плюшевый мишка', 'token_toy_7', 'created'),
+('toy_8', 'user_3', 'Раскраска', 'Детская раскраска', 'token_toy_8', 'created'),
 
 -- Пользователь 4: несколько игрушек
-('toy_9', 'user_4', 'Матрёшка', 'Русская матрёшка', '/photos/matryoshka.jpg', 'token_toy_9', 'created'),
-('toy_10', 'user_4', 'Юла', 'Игрушка-юла', '/photos/spinner.jpg', 'token_toy_10', 'created')
+('toy_9', 'user_4', 'Матрёшка', 'Русская матрёшка', 'token_toy_9', 'created'),
+('toy_10', 'user_4', 'Юла', 'Игрушка-юла', 'token_toy_10', 'created')
 ON CONFLICT (toy_id) DO NOTHING;
 
+-- Фотографии игрушек (ключи в BlobStore)
+INSERT INTO toy_photos (toy_id, position, thumbnail_key, medium_key, full_key) VALUES
+('toy_1', 0, 'toys/car_thumbnail.jpg', 'toys/car_medium.jpg', 'toys/car_full.jpg'),
+('toy_2', 0, 'toys/doll_thumbnail.jpg', 'toys/doll_medium.jpg', 'toys/doll_full.jpg'),
+('toy_3', 0, 'toys/lego_thumbnail.jpg', 'toys/lego_medium.jpg', 'toys/lego_full.jpg'),
+('toy_4', 0, 'toys/ball_thumbnail.jpg', 'toys/ball_medium.jpg', 'toys/ball_full.jpg'),
+('toy_5', 0, 'toys/puzzle_thumbnail.jpg', 'toys/puzzle_medium.jpg', 'toys/puzzle_full.jpg'),
+('toy_6', 0, 'toys/blocks_thumbnail.jpg', 'toys/blocks_medium.jpg', 'toys/blocks_full.jpg'),
+('toy_7', 0, 'toys/bear_thumbnail.jpg', 'toys/bear_medium.jpg', 'toys/bear_full.jpg'),
+('toy_8', 0, 'toys/coloring_thumbnail.jpg', 'toys/coloring_medium.jpg', 'toys/coloring_full.jpg'),
+('toy_9', 0, 'toys/matryoshka_thumbnail.jpg', 'toys/matryoshka_medium.jpg', 'toys/matryoshka_full.jpg'),
+('toy_10', 0, 'toys/spinner_thumbnail.jpg', 'toys/spinner_medium.jpg', 'toys/spinner_full.jpg')
+ON CONFLICT (toy_id, position) DO NOTHING;
+
+-- Текущие владельцы игрушек
+INSERT INTO toy_ownership_history (toy_id, user_id)
+SELECT toy_id, user_id FROM toys
+ON CONFLICT (toy_id) WHERE released_at IS NULL DO NOTHING;
+
 -- 1) Несколько обменов с одной игрушкой (toy_1 участвует в нескольких обменах)
 INSERT INTO exchange (exchange_id, src_toy_id, dst_toy_id, idempotency_token, status) VALUES
 ('exchange_1', 'toy_1', 'toy_4', 'token_exchange_1', 'created'), -- user_1 отдает toy_1 за toy_4 user_2